@@ -0,0 +1,51 @@
+/*
+Copyright SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"github.com/Masterminds/log-go"
+	logio "github.com/Masterminds/log-go/io"
+	"github.com/spf13/cobra"
+
+	"github.com/rancher-sandbox/hypper/cmd/hypper/require"
+)
+
+var cacheHelp = `
+This command consists of multiple subcommands to manage the local chart cache.
+
+Charts installed from repositories are stored in the cache, keyed by their
+digest, so they are not downloaded again. The cache location can be set with
+--chart-cache or $HYPPER_CHART_CACHE, for example to persist it between CI runs.
+`
+
+func newCacheCmd(logger log.Logger) *cobra.Command {
+	wInfo := logio.NewWriter(logger, log.InfoLevel)
+	cmd := &cobra.Command{
+		Use:   "cache list|prune|clean",
+		Short: "list, prune, and clean the local chart cache",
+		Long:  cacheHelp,
+		Args:  require.NoArgs,
+	}
+
+	cmd.AddCommand(
+		newCacheListCmd(wInfo),
+		newCachePruneCmd(wInfo),
+		newCacheCleanCmd(wInfo),
+	)
+
+	return cmd
+}
@@ -0,0 +1,43 @@
+/*
+Copyright SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/spf13/cobra"
+
+	"github.com/rancher-sandbox/hypper/cmd/hypper/require"
+	"github.com/rancher-sandbox/hypper/pkg/chartcache"
+)
+
+func newCacheCleanCmd(out io.Writer) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "clean",
+		Short: "remove all the charts from the local chart cache",
+		Args:  require.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := chartcache.New(settings.ChartCache).Clean(); err != nil {
+				return err
+			}
+			fmt.Fprintf(out, "chart cache %s has been cleaned\n", settings.ChartCache)
+			return nil
+		},
+	}
+	return cmd
+}
@@ -0,0 +1,70 @@
+/*
+Copyright SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"io"
+
+	"github.com/gosuri/uitable"
+	"github.com/spf13/cobra"
+	"helm.sh/helm/v3/pkg/cli/output"
+
+	"github.com/rancher-sandbox/hypper/cmd/hypper/require"
+	"github.com/rancher-sandbox/hypper/pkg/chartcache"
+)
+
+func newCacheListCmd(out io.Writer) *cobra.Command {
+	var outfmt output.Format
+	cmd := &cobra.Command{
+		Use:     "list",
+		Aliases: []string{"ls"},
+		Short:   "list the charts in the local chart cache",
+		Args:    require.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			entries, err := chartcache.New(settings.ChartCache).List()
+			if err != nil {
+				return err
+			}
+			return outfmt.Write(out, &cacheListWriter{entries})
+		},
+	}
+
+	bindOutputFlag(cmd, &outfmt)
+
+	return cmd
+}
+
+type cacheListWriter struct {
+	entries []*chartcache.Entry
+}
+
+func (c *cacheListWriter) WriteTable(out io.Writer) error {
+	table := uitable.New()
+	table.AddRow("NAME", "VERSION", "DIGEST", "SIZE", "LAST USED")
+	for _, e := range c.entries {
+		table.AddRow(e.Name, e.Version, e.Digest, e.Size, e.LastUsed.Format("2006-01-02 15:04:05"))
+	}
+	return output.EncodeTable(out, table)
+}
+
+func (c *cacheListWriter) WriteJSON(out io.Writer) error {
+	return output.EncodeJSON(out, c.entries)
+}
+
+func (c *cacheListWriter) WriteYAML(out io.Writer) error {
+	return output.EncodeYAML(out, c.entries)
+}
@@ -0,0 +1,116 @@
+/*
+Copyright SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/rancher-sandbox/hypper/cmd/hypper/require"
+	"github.com/rancher-sandbox/hypper/pkg/chartcache"
+	"github.com/rancher-sandbox/hypper/pkg/hypperpath"
+	"github.com/rancher-sandbox/hypper/pkg/repo"
+)
+
+const cachePruneDesc = `
+Remove the charts from the local chart cache that are no longer listed in the
+index of any configured repository.
+
+With --older-than, charts that have not been used for that long are removed too.
+`
+
+type cachePruneOptions struct {
+	olderThan  time.Duration
+	chartCache string
+	repoFile   string
+	repoCache  string
+}
+
+func newCachePruneCmd(out io.Writer) *cobra.Command {
+	o := &cachePruneOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "prune",
+		Short: "remove unreferenced or unused charts from the local chart cache",
+		Long:  cachePruneDesc,
+		Args:  require.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			o.chartCache = settings.ChartCache
+			o.repoFile = settings.RepositoryConfig
+			o.repoCache = settings.RepositoryCache
+			return o.run(out)
+		},
+	}
+
+	f := cmd.Flags()
+	f.DurationVar(&o.olderThan, "older-than", 0, "also remove charts not used for this long (e.g. 720h)")
+
+	return cmd
+}
+
+func (o *cachePruneOptions) run(out io.Writer) error {
+	referenced, err := o.referencedDigests()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+
+	removed, err := chartcache.New(o.chartCache).Prune(func(e *chartcache.Entry) bool {
+		if !referenced[chartcache.NormalizeDigest(e.Digest)] {
+			return true
+		}
+		return o.olderThan > 0 && now.Sub(e.LastUsed) > o.olderThan
+	})
+	for _, e := range removed {
+		fmt.Fprintf(out, "removed %s %s (%s)\n", e.Name, e.Version, e.Digest)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "%d charts removed from the cache\n", len(removed))
+	return nil
+}
+
+// referencedDigests returns the digests of all the charts listed in the cached
+// indexes of the configured repositories.
+//
+// Any index that cannot be loaded is an error: the charts it lists would
+// otherwise be taken as unreferenced and removed.
+func (o *cachePruneOptions) referencedDigests() (map[string]bool, error) {
+	f, err := repo.LoadFile(o.repoFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot tell which cached charts are referenced")
+	}
+	digests := map[string]bool{}
+	for _, re := range f.Repositories {
+		idx, err := repo.LoadIndexFile(filepath.Join(o.repoCache, hypperpath.CacheIndexFile(re.Name)))
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot load the cached index of repository %q, try 'hypper repo update'", re.Name)
+		}
+		for _, cvs := range idx.Entries {
+			for _, cv := range cvs {
+				digests[chartcache.NormalizeDigest(cv.Digest)] = true
+			}
+		}
+	}
+	return digests, nil
+}
@@ -0,0 +1,104 @@
+/*
+Copyright SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"helm.sh/helm/v3/pkg/provenance"
+
+	"github.com/rancher-sandbox/hypper/internal/test/ensure"
+	"github.com/rancher-sandbox/hypper/pkg/chartcache"
+)
+
+func TestCacheCmds(t *testing.T) {
+	defer resetEnv()()
+
+	tmpdir := ensure.TempDir(t)
+	defer os.RemoveAll(tmpdir)
+	chartCache := filepath.Join(tmpdir, "charts")
+	repoFile := filepath.Join(tmpdir, "repositories.yaml")
+
+	c := chartcache.New(chartCache)
+	for _, v := range []string{"0.1.0", "0.2.0"} {
+		src := fmt.Sprintf("testdata/testcharts/vanilla-helm-compressedchart-%s.tgz", v)
+		digest, err := provenance.DigestFile(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := c.Add(src, digest); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, out, err := executeActionCommandC(storageFixture(), "cache list --chart-cache "+chartCache)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "compressedchart") || !strings.Contains(out, "0.2.0") {
+		t.Errorf("expected cached charts to be listed, got %q", out)
+	}
+
+	// a missing repositories file is not taken as "no chart is referenced"
+	if _, _, err := executeActionCommandC(storageFixture(), fmt.Sprintf("cache prune --chart-cache %s --repository-config %s", chartCache, repoFile)); err == nil {
+		t.Error("expected an error when the repositories file cannot be loaded")
+	}
+
+	// neither is a repository whose index is not cached
+	if err := ioutil.WriteFile(repoFile, []byte("repositories:\n- name: test\n  url: https://example.com/charts\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	repoCache := filepath.Join(tmpdir, "repository")
+	if _, _, err := executeActionCommandC(storageFixture(), fmt.Sprintf("cache prune --chart-cache %s --repository-config %s --repository-cache %s", chartCache, repoFile, repoCache)); err == nil {
+		t.Error("expected an error when a cached index cannot be loaded")
+	}
+	entries, err := c.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("expected no chart to be pruned on errors, got %d charts", len(entries))
+	}
+
+	// without repositories, no chart is referenced anymore
+	if err := ioutil.WriteFile(repoFile, []byte("repositories: []\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, out, err = executeActionCommandC(storageFixture(), fmt.Sprintf("cache prune --chart-cache %s --repository-config %s", chartCache, repoFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "2 charts removed from the cache") {
+		t.Errorf("expected 2 charts to be pruned, got %q", out)
+	}
+
+	if _, _, err := executeActionCommandC(storageFixture(), "cache clean --chart-cache "+chartCache); err != nil {
+		t.Fatal(err)
+	}
+	entries, err = c.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("expected an empty cache, got %d charts", len(entries))
+	}
+}
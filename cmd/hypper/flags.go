@@ -18,17 +18,83 @@ package main
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
 	"strings"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"k8s.io/client-go/util/homedir"
 
+	helmAction "helm.sh/helm/v3/pkg/action"
 	"helm.sh/helm/v3/pkg/cli/output"
+	"helm.sh/helm/v3/pkg/cli/values"
 
 	"github.com/Masterminds/log-go"
+	"github.com/rancher-sandbox/hypper/pkg/hypperpath"
+	"github.com/rancher-sandbox/hypper/pkg/repo"
 )
 
 const outputFlag = "output"
 
+func addValueOptionsFlags(f *pflag.FlagSet, v *values.Options) {
+	f.StringSliceVarP(&v.ValueFiles, "values", "f", []string{}, "specify values in a YAML file or a URL (can specify multiple)")
+	f.StringArrayVar(&v.Values, "set", []string{}, "set values on the command line (can specify multiple or separate values with commas: key1=val1,key2=val2)")
+	f.StringArrayVar(&v.StringValues, "set-string", []string{}, "set STRING values on the command line (can specify multiple or separate values with commas: key1=val1,key2=val2)")
+	f.StringArrayVar(&v.FileValues, "set-file", []string{}, "set values from respective files specified via the command line (can specify multiple or separate values with commas: key1=path1,key2=path2)")
+}
+
+func addChartPathOptionsFlags(f *pflag.FlagSet, c *helmAction.ChartPathOptions) {
+	f.StringVar(&c.Version, "version", "", "specify the exact chart version to use. If this is not specified, the latest version is used")
+	f.BoolVar(&c.Verify, "verify", false, "verify the package before using it")
+	f.StringVar(&c.Keyring, "keyring", defaultKeyring(), "location of public keys used for verification")
+	f.StringVar(&c.RepoURL, "repo", "", "chart repository url where to locate the requested chart")
+	f.StringVar(&c.Username, "username", "", "chart repository username where to locate the requested chart")
+	f.StringVar(&c.Password, "password", "", "chart repository password where to locate the requested chart")
+	f.StringVar(&c.CertFile, "cert-file", "", "identify HTTPS client using this SSL certificate file")
+	f.StringVar(&c.KeyFile, "key-file", "", "identify HTTPS client using this SSL key file")
+	f.BoolVar(&c.InsecureSkipTLSverify, "insecure-skip-tls-verify", false, "skip tls certificate checks for the chart download")
+	f.StringVar(&c.CaFile, "ca-file", "", "verify certificates of HTTPS-enabled servers using this CA bundle")
+}
+
+// compVersionFlag completes the versions of a chart from the cached indexes.
+// Charts referenced only by name are looked up in all the repositories.
+func compVersionFlag(chartRef string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	name := chartRef
+	var indexes []string
+	if p := strings.SplitN(chartRef, "/", 2); len(p) == 2 {
+		name = p[1]
+		indexes = append(indexes, filepath.Join(settings.RepositoryCache, hypperpath.CacheIndexFile(p[0])))
+	} else if f, err := repo.LoadFile(settings.RepositoryConfig); err == nil {
+		for _, re := range f.Repositories {
+			if re.IsEnabled() {
+				indexes = append(indexes, filepath.Join(settings.RepositoryCache, hypperpath.CacheIndexFile(re.Name)))
+			}
+		}
+	}
+
+	var versions []string
+	seen := map[string]bool{}
+	for _, path := range indexes {
+		idx, err := repo.OpenChartIndex(path)
+		if err != nil {
+			continue
+		}
+		cvs, err := idx.ChartVersions(name)
+		if err != nil {
+			continue
+		}
+		for _, cv := range cvs {
+			if strings.HasPrefix(cv.Version, toComplete) && !seen[cv.Version] {
+				seen[cv.Version] = true
+				versions = append(versions, cv.Version)
+			}
+		}
+	}
+
+	return versions, cobra.ShellCompDirectiveNoFileComp
+}
+
 // bindOutputFlag will add the output flag to the given command and bind the
 // value to the given format pointer
 func bindOutputFlag(cmd *cobra.Command, varRef *output.Format) {
@@ -76,3 +142,11 @@ func (o *outputValue) Set(s string) error {
 	*o = outputValue(outfmt)
 	return nil
 }
+
+// defaultKeyring returns the expanded path to the default keyring.
+func defaultKeyring() string {
+	if v, ok := os.LookupEnv("GNUPGHOME"); ok {
+		return filepath.Join(v, "pubring.gpg")
+	}
+	return filepath.Join(homedir.HomeDir(), ".gnupg", "pubring.gpg")
+}
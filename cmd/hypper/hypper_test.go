@@ -107,6 +107,7 @@ func executeActionCommandStdinC(store *storage.Storage, in *os.File, cmd string)
 	buf := new(bytes.Buffer)
 	logger := logcli.NewStandard()
 	logger.InfoOut = buf
+	logger.WarnOut = buf
 	logger.ErrorOut = buf
 	log.Current = logger
 
@@ -174,6 +175,7 @@ func executeCommandStdinC(cmd string) (*cobra.Command, string, error) {
 	buf := new(bytes.Buffer)
 	logger := logcli.NewStandard()
 	logger.InfoOut = buf
+	logger.WarnOut = buf
 	logger.ErrorOut = buf
 	log.Current = logger
 
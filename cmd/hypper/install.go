@@ -1,9 +1,15 @@
 package main
 
 import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
+	"golang.org/x/term"
 	"helm.sh/helm/v3/cmd/helm/require"
 	"helm.sh/helm/v3/pkg/chart"
 	"helm.sh/helm/v3/pkg/chart/loader"
@@ -17,6 +23,7 @@ import (
 	logio "github.com/Masterminds/log-go/io"
 	"github.com/rancher-sandbox/hypper/pkg/action"
 	"github.com/rancher-sandbox/hypper/pkg/eyecandy"
+	"github.com/rancher-sandbox/hypper/pkg/questions"
 )
 
 const installDesc = `
@@ -25,6 +32,13 @@ This command installs a chart.
 The install argument must be a chart reference, a path to a packaged chart,
 a path to an unpacked chart directory or a URL.
 
+A chart reference without a repository (e.g: 'hypper install mariadb') is
+searched for in the cached indexes of all the configured repositories, as charts
+of the same name are considered the same chart. The chart is installed from the
+repositories with the highest priority (see 'hypper repo modify --priority'),
+using the newest version found; when several repositories provide it, the first
+repository by name is used.
+
 There are four different ways you can select the release name and namespace
 where the chart will be installed. By priority order:
 
@@ -32,11 +46,32 @@ where the chart will be installed. By priority order:
 2. By using hypper.cattle.io annotations in the Chart.yaml
 3. By using catalog.cattle.io annotations in the Chart.yaml
 4. By using the current namespace as configured with the kubeconfig, or the flag --generate-name
+
+Charts may require other charts to be installed first, as Rancher charts do
+with their CRDs using the catalog.cattle.io/auto-install annotation (e.g:
+'fleet-crd=match' for the version of fleet-crd matching the chart version).
+Those charts are installed first from the same repository, unless they are
+already installed or --skip-auto-install is set.
+
+Charts are only installed if the version of the cluster satisfies their
+kubeVersion and catalog.cattle.io/kube-version annotation and, when Rancher runs
+on the cluster, if the version of Rancher satisfies their
+catalog.cattle.io/rancher-version annotation.
+
+Rancher charts describe how to prompt for their values in a questions.yaml
+file. With --interactive, the questions are asked and their answers set in the
+values, defaulting to the values already given. For charts without
+questions.yaml, the required values of their values.schema.json that are
+missing are asked instead. The answers can be saved with
+--save-answers, and given again with --answers to install without prompts.
+Those answers are checked as if they were typed, and the answers to questions
+not shown are ignored.
 `
 
 func newInstallCmd(actionConfig *action.Configuration, logger log.Logger) *cobra.Command {
 	client := action.NewInstall(actionConfig)
 	valueOpts := &values.Options{}
+	answerOpts := &answerOptions{}
 	var outfmt output.Format
 
 	cmd := &cobra.Command{
@@ -44,9 +79,14 @@ func newInstallCmd(actionConfig *action.Configuration, logger log.Logger) *cobra
 		Short: "install a chart",
 		Long:  installDesc,
 		Args:  require.MinimumNArgs(1),
-		RunE: func(_ *cobra.Command, args []string) error {
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if answerOpts.saveAnswers != "" && !answerOpts.interactive && answerOpts.answersFile == "" {
+				return errors.New("--save-answers requires --interactive or --answers")
+			}
+			answerOpts.in = cmd.InOrStdin()
+			answerOpts.out = cmd.OutOrStdout()
 			// TODO decide how to use returned rel:
-			_, err := runInstall(args, client, valueOpts, logger)
+			_, err := runInstall(args, client, valueOpts, answerOpts, logger)
 			if err != nil {
 				return err
 			}
@@ -55,16 +95,62 @@ func newInstallCmd(actionConfig *action.Configuration, logger log.Logger) *cobra
 		},
 	}
 	addInstallFlags(cmd, cmd.Flags(), client, valueOpts)
+	addAnswerFlags(cmd.Flags(), answerOpts)
 	bindOutputFlag(cmd, &outfmt)
 	return cmd
 }
 
+// answerOptions are the options answering the questions of a chart
+type answerOptions struct {
+	interactive bool
+	answersFile string
+	saveAnswers string
+
+	in  io.Reader
+	out io.Writer
+}
+
+func addAnswerFlags(f *pflag.FlagSet, o *answerOptions) {
+	f.BoolVar(&o.interactive, "interactive", false, "prompt for the values of the chart described in its questions.yaml, or for the required values of its values.schema.json")
+	f.StringVar(&o.answersFile, "answers", "", "answer the questions of the chart with the answers in a file, as saved with --save-answers")
+	f.StringVar(&o.saveAnswers, "save-answers", "", "save the answers to the questions of the chart to a file")
+}
+
 func addInstallFlags(cmd *cobra.Command, f *pflag.FlagSet, client *action.Install, valueOpts *values.Options) {
-	f.BoolVarP(&client.GenerateName, "generate-name", "g", false, "generate the name (and omit the NAME parameter)")
 	f.BoolVar(&client.CreateNamespace, "create-namespace", false, "create the release namespace if not present")
+	f.BoolVar(&client.DryRun, "dry-run", false, "simulate an install")
+	f.BoolVar(&client.DisableHooks, "no-hooks", false, "prevent hooks from running during install")
+	f.BoolVar(&client.Replace, "replace", false, "re-use the given name, only if that name is a deleted release which remains in the history. This is unsafe in production")
+	f.DurationVar(&client.Timeout, "timeout", 300*time.Second, "time to wait for any individual Kubernetes operation (like Jobs for hooks)")
+	f.BoolVar(&client.Wait, "wait", false, "if set, will wait until all Pods, PVCs, Services, and minimum number of Pods of a Deployment, StatefulSet, or ReplicaSet are in a ready state before marking the release as successful. It will wait for as long as --timeout")
+	f.BoolVar(&client.WaitForJobs, "wait-for-jobs", false, "if set and --wait enabled, will wait until all Jobs have been completed before marking the release as successful. It will wait for as long as --timeout")
+	f.BoolVarP(&client.GenerateName, "generate-name", "g", false, "generate the name (and omit the NAME parameter)")
+	f.StringVar(&client.NameTemplate, "name-template", "", "specify template used to name the release")
+	f.StringVar(&client.Description, "description", "", "add a custom description")
+	f.BoolVar(&client.Devel, "devel", false, "use development versions, too. Equivalent to version '>0.0.0-0'. If --version is set, this is ignored")
+	f.BoolVar(&client.DependencyUpdate, "dependency-update", false, "update the dependencies of the chart before installing it")
+	f.BoolVar(&client.DisableOpenAPIValidation, "disable-openapi-validation", false, "if set, the installation process will not validate rendered templates against the Kubernetes OpenAPI Schema")
+	f.BoolVar(&client.Atomic, "atomic", false, "if set, the installation process deletes the installation on failure. The --wait flag will be set automatically if --atomic is used")
+	f.BoolVar(&client.SkipCRDs, "skip-crds", false, "if set, no CRDs will be installed. By default, CRDs are installed if not already present")
+	f.BoolVar(&client.SubNotes, "render-subchart-notes", false, "if set, render subchart notes along with the parent")
+	f.BoolVar(&client.SkipAutoInstall, "skip-auto-install", false, "do not install the charts of the catalog.cattle.io/auto-install annotation first")
+	addValueOptionsFlags(f, valueOpts)
+	addChartPathOptionsFlags(f, &client.ChartPathOptions)
+
+	err := cmd.RegisterFlagCompletionFunc("version", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		// the chart is the last argument, with or without a release name
+		if len(args) < 1 || len(args) > 2 {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		return compVersionFlag(args[len(args)-1], toComplete)
+	})
+
+	if err != nil {
+		log.Fatal(err)
+	}
 }
 
-func runInstall(args []string, client *action.Install, valueOpts *values.Options, logger log.Logger) (*release.Release, error) {
+func runInstall(args []string, client *action.Install, valueOpts *values.Options, answerOpts *answerOptions, logger log.Logger) (*release.Release, error) {
 
 	// Get an io.Writer compliant logger instance at the info level.
 	wInfo := logio.NewWriter(logger, log.InfoLevel)
@@ -79,7 +165,19 @@ func runInstall(args []string, client *action.Install, valueOpts *values.Options
 		return nil, err
 	}
 
-	cp, err := client.ChartPathOptions.LocateChart(chart, settings.EnvSettings)
+	// Plan the install from the index of the chart repository when possible,
+	// so the chart is only downloaded once it is known to be installable
+	md, chart, err := client.LookupChart(chart, settings)
+	if err != nil {
+		return nil, err
+	}
+	if md != nil {
+		if err := planInstall(client, md, args); err != nil {
+			return nil, err
+		}
+	}
+
+	cp, err := client.LocateChart(chart, settings)
 	if err != nil {
 		return nil, err
 	}
@@ -98,22 +196,10 @@ func runInstall(args []string, client *action.Install, valueOpts *values.Options
 		return nil, err
 	}
 
-	if settings.NamespaceFromFlag {
-		client.Namespace = settings.Namespace()
-	} else {
-		client.SetNamespace(chartRequested, settings.Namespace())
-	}
-
-	client.Config.SetNamespace(client.Namespace)
-
-	name, err := client.Name(chartRequested, args)
-	if err != nil {
-		return nil, err
-	}
-	client.ReleaseName = name
-
-	if err := checkIfInstallable(chartRequested); err != nil {
-		return nil, err
+	if md == nil {
+		if err := planInstall(client, chartRequested.Metadata, args); err != nil {
+			return nil, err
+		}
 	}
 
 	if chartRequested.Metadata.Deprecated {
@@ -149,16 +235,184 @@ func runInstall(args []string, client *action.Install, valueOpts *values.Options
 		}
 	}
 
+	if err := answerQuestions(chartRequested, vals, answerOpts, logger); err != nil {
+		return nil, err
+	}
+
+	if !client.SkipAutoInstall {
+		if err := installAutoInstallCharts(client, chartRequested.Metadata, logger); err != nil {
+			return nil, err
+		}
+	}
+
 	return client.Run(chartRequested, vals)
 }
 
+// installAutoInstallCharts installs the charts of the auto-install annotation
+// of the chart metadata, unless they are already installed. They are looked up
+// in the repository of the chart, or in all the repositories if the chart does
+// not come from one.
+func installAutoInstallCharts(client *action.Install, md *chart.Metadata, logger log.Logger) error {
+	charts, err := action.AutoInstallCharts(md)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range charts {
+		sub := action.NewInstall(client.Config)
+		sub.ChartPathOptions = client.ChartPathOptions
+		sub.Version = c.Version
+		sub.DryRun = client.DryRun
+		sub.CreateNamespace = client.CreateNamespace
+		sub.Wait = client.Wait
+		sub.WaitForJobs = client.WaitForJobs
+		sub.Timeout = client.Timeout
+		sub.Atomic = client.Atomic
+		sub.SkipAutoInstall = true
+		sub.ReleaseName = c.Name
+
+		ref := c.Name
+		if client.Source != nil {
+			ref = client.Source.Repo + "/" + c.Name
+		} else if client.RepoURL == "" {
+			// the credentials of the chart are not those of another repository
+			sub.Username = ""
+			sub.Password = ""
+		}
+
+		rmd, ref, err := sub.LookupChart(ref, settings)
+		if err != nil {
+			return errors.Wrapf(err, "cannot find chart %q, required by chart %q", c.Name, md.Name)
+		}
+		name := c.Name
+		if rmd != nil {
+			if name, err = sub.NameFromMetadata(rmd, []string{ref}); err != nil {
+				return err
+			}
+			// the release is looked up in the namespace it is installed in
+			setInstallNamespace(sub, rmd)
+		} else if sub.RepoURL == "" {
+			return errors.Errorf("cannot find chart %q, required by chart %q", ref, md.Name)
+		}
+		if sub.IsInstalled(name) {
+			logger.Infof("Chart \"%s\", required by chart \"%s\", is already installed as release \"%s\"", c.Name, md.Name, name)
+			continue
+		}
+
+		logger.Infof("Installing chart \"%s\" first, as required by chart \"%s\"", ref, md.Name)
+		if _, err := runInstall([]string{name, ref}, sub, &values.Options{}, &answerOptions{}, logger); err != nil {
+			return errors.Wrapf(err, "failed installing chart %q, required by chart %q", ref, md.Name)
+		}
+	}
+
+	// the namespace was changed by the installs
+	client.Config.SetNamespace(client.Namespace)
+	return nil
+}
+
+// answerQuestions sets in vals the answers to the questions of the chart,
+// read from an answers file or asked interactively. Values already set are
+// the default answers.
+func answerQuestions(ch *chart.Chart, vals map[string]interface{}, o *answerOptions, logger log.Logger) error {
+	if !o.interactive && o.answersFile == "" {
+		return nil
+	}
+
+	// Charts without questions are asked for the required values of their
+	// schema that are missing
+	qs, err := questions.Load(ch)
+	if err == nil && qs == nil {
+		qs, err = questions.FromSchema(ch, vals)
+	}
+	if err != nil {
+		return err
+	}
+	if qs == nil {
+		logger.Warnf("Chart %s has neither questions.yaml nor values.schema.json, no values to prompt for", ch.Name())
+		return nil
+	}
+
+	answers := questions.Answers{}
+	if o.answersFile != "" {
+		if answers, err = questions.LoadAnswers(o.answersFile); err != nil {
+			return err
+		}
+	}
+	if o.interactive {
+		p := questions.NewPrompter(o.in, o.out, settings.NoEmojis)
+		if f, ok := o.in.(*os.File); ok && term.IsTerminal(int(f.Fd())) {
+			p.ReadPassword = func() (string, error) {
+				b, err := term.ReadPassword(int(f.Fd()))
+				return string(b), err
+			}
+		}
+		defaults := func(q *questions.Question) string {
+			for _, v := range []map[string]interface{}{vals, ch.Values} {
+				if val, ok := questions.GetValue(v, q.Variable); ok {
+					switch val.(type) {
+					case map[string]interface{}, []interface{}, nil:
+					default:
+						return fmt.Sprint(val)
+					}
+				}
+			}
+			return ""
+		}
+		if answers, err = p.Ask(qs, answers, defaults); err != nil {
+			return err
+		}
+	} else if answers, err = qs.Check(answers); err != nil {
+		return err
+	}
+	qs.Apply(answers, vals)
+
+	if o.saveAnswers != "" {
+		if err := answers.Save(o.saveAnswers); err != nil {
+			return errors.Wrap(err, "cannot save answers")
+		}
+		logger.Infof("Answers saved to %s", o.saveAnswers)
+	}
+	return nil
+}
+
+// planInstall sets the namespace and the release name of the install from the
+// chart metadata, and checks that the chart can be installed with them
+func planInstall(client *action.Install, md *chart.Metadata, args []string) error {
+	setInstallNamespace(client, md)
+
+	name, err := client.NameFromMetadata(md, args)
+	if err != nil {
+		return err
+	}
+	client.ReleaseName = name
+
+	if err := checkIfInstallable(md); err != nil {
+		return err
+	}
+	if err := client.Config.CheckCompatibility(md); err != nil {
+		return err
+	}
+	return client.CheckReleaseName()
+}
+
+// setInstallNamespace sets the namespace of the install, and of its
+// configuration, from the flag or else from the chart metadata
+func setInstallNamespace(client *action.Install, md *chart.Metadata) {
+	if settings.NamespaceFromFlag {
+		client.Namespace = settings.Namespace()
+	} else {
+		client.SetNamespaceFromMetadata(md, settings.Namespace())
+	}
+	client.Config.SetNamespace(client.Namespace)
+}
+
 // checkIfInstallable validates if a chart can be installed
 //
 // Application chart type is only installable
-func checkIfInstallable(ch *chart.Chart) error {
-	switch ch.Metadata.Type {
+func checkIfInstallable(md *chart.Metadata) error {
+	switch md.Type {
 	case "", "application":
 		return nil
 	}
-	return errors.Errorf("%s charts are not installable", ch.Metadata.Type)
+	return errors.Errorf("%s charts are not installable", md.Type)
 }
@@ -1,7 +1,24 @@
 package main
 
 import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+
+	"github.com/spf13/cobra"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/cli/values"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/repo/repotest"
+
+	"github.com/rancher-sandbox/hypper/internal/test/ensure"
+	"github.com/rancher-sandbox/hypper/pkg/action"
 )
 
 func TestInstallCmd(t *testing.T) {
@@ -53,3 +70,596 @@ func TestInstallCmd(t *testing.T) {
 	}
 	runTestActionCmd(t, tests)
 }
+
+func TestInstallPlannedFromIndex(t *testing.T) {
+	defer resetEnv()()
+
+	ch, err := loader.Load("testdata/testcharts/hypper-annot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := ensure.TempDir(t)
+	if _, err := chartutil.Save(ch, dir); err != nil {
+		t.Fatal(err)
+	}
+	srv, err := repotest.NewTempServerWithCleanup(t, filepath.Join(dir, "*.tgz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Stop()
+	if err := srv.LinkIndices(); err != nil {
+		t.Fatal(err)
+	}
+	// the archive is gone, only the index can be used
+	if err := os.Remove(filepath.Join(srv.Root(), "empty-0.1.0.tgz")); err != nil {
+		t.Fatal(err)
+	}
+
+	store := storageFixture()
+	if err := store.Create(&release.Release{
+		Name:      "my-hypper-name",
+		Namespace: "default",
+		Version:   1,
+		Info:      &release.Info{Status: release.StatusDeployed},
+		Chart:     &chart.Chart{Metadata: &chart.Metadata{Name: "empty", Version: "0.1.0"}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := fmt.Sprintf("install test/empty -n default --repository-config %s --repository-cache %s",
+		filepath.Join(srv.Root(), "repositories.yaml"), srv.Root())
+	_, out, err := executeActionCommandC(store, cmd)
+	if err == nil || !strings.Contains(err.Error(), "cannot re-use a name that is still in use") {
+		t.Errorf("expected the release name from the index annotations to be refused, got %v: %s", err, out)
+	}
+}
+
+func TestInstallAutoInstall(t *testing.T) {
+	defer resetEnv()()
+
+	dir := ensure.TempDir(t)
+	ch, err := loader.Load("testdata/testcharts/fallback-annot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch.Metadata.Name = "fleet"
+	ch.Metadata.Annotations["catalog.cattle.io/auto-install"] = "fleet-crd=match"
+	if _, err := chartutil.Save(ch, dir); err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []string{"0.1.0", "0.2.0"} {
+		crd, err := loader.Load("testdata/testcharts/vanilla-helm")
+		if err != nil {
+			t.Fatal(err)
+		}
+		crd.Metadata.Name = "fleet-crd"
+		crd.Metadata.Version = v
+		crd.Metadata.Annotations = map[string]string{"catalog.cattle.io/namespace": "fleet-system"}
+		if _, err := chartutil.Save(crd, dir); err != nil {
+			t.Fatal(err)
+		}
+	}
+	srv, err := repotest.NewTempServerWithCleanup(t, filepath.Join(dir, "*.tgz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Stop()
+	if err := srv.LinkIndices(); err != nil {
+		t.Fatal(err)
+	}
+	flags := fmt.Sprintf("--repository-config %s --repository-cache %s",
+		filepath.Join(srv.Root(), "repositories.yaml"), srv.Root())
+
+	store := storageFixture()
+	_, out, err := executeActionCommandC(store, "install test/fleet "+flags)
+	if err != nil {
+		t.Fatalf("unexpected error: %v: %s", err, out)
+	}
+	crd, err := store.Last("fleet-crd")
+	if err != nil {
+		t.Fatalf("expected fleet-crd to be installed: %v: %s", err, out)
+	}
+	if crd.Chart.Metadata.Version != "0.1.0" {
+		t.Errorf("expected the version of fleet-crd matching fleet to be installed, got %s", crd.Chart.Metadata.Version)
+	}
+	rel, err := store.Last("fleet")
+	if err != nil {
+		t.Fatalf("expected fleet to be installed: %v: %s", err, out)
+	}
+	if rel.Namespace != "fleet-system" {
+		t.Errorf("expected fleet to be installed in fleet-system, got %s", rel.Namespace)
+	}
+	if !strings.Contains(out, `Installing chart "test/fleet-crd" first, as required by chart "fleet"`) {
+		t.Errorf("expected fleet-crd to be installed first, got %s", out)
+	}
+
+	// once installed, the chart is not installed again
+	if _, err := store.Delete("fleet", 1); err != nil {
+		t.Fatal(err)
+	}
+	_, out, err = executeActionCommandC(store, "install test/fleet -n fleet-system "+flags)
+	if err != nil {
+		t.Fatalf("unexpected error: %v: %s", err, out)
+	}
+	if !strings.Contains(out, `Chart "fleet-crd", required by chart "fleet", is already installed as release "fleet-crd"`) {
+		t.Errorf("expected fleet-crd to be skipped, got %s", out)
+	}
+
+	// unless asked otherwise
+	store = storageFixture()
+	if _, out, err = executeActionCommandC(store, "install test/fleet --skip-auto-install "+flags); err != nil {
+		t.Fatalf("unexpected error: %v: %s", err, out)
+	}
+	if _, err := store.Last("fleet-crd"); err == nil {
+		t.Errorf("expected fleet-crd not to be installed with --skip-auto-install")
+	}
+}
+
+func TestInstallAutoInstallOtherNamespace(t *testing.T) {
+	defer resetEnv()()
+
+	dir := ensure.TempDir(t)
+	ch, err := loader.Load("testdata/testcharts/fallback-annot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch.Metadata.Name = "rancher"
+	ch.Metadata.Annotations["catalog.cattle.io/auto-install"] = "rancher-crd=match"
+	if _, err := chartutil.Save(ch, dir); err != nil {
+		t.Fatal(err)
+	}
+	crd, err := loader.Load("testdata/testcharts/vanilla-helm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	crd.Metadata.Name = "rancher-crd"
+	crd.Metadata.Version = "0.1.0"
+	crd.Metadata.Annotations = map[string]string{"catalog.cattle.io/namespace": "cattle-system"}
+	if _, err := chartutil.Save(crd, dir); err != nil {
+		t.Fatal(err)
+	}
+	srv, err := repotest.NewTempServerWithCleanup(t, filepath.Join(dir, "*.tgz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Stop()
+	if err := srv.LinkIndices(); err != nil {
+		t.Fatal(err)
+	}
+	flags := fmt.Sprintf("--repository-config %s --repository-cache %s",
+		filepath.Join(srv.Root(), "repositories.yaml"), srv.Root())
+
+	// the chart required is looked up in its own namespace, not in the one of
+	// the chart requiring it
+	store := storageFixture()
+	if err := store.Create(&release.Release{
+		Name:      "rancher-crd",
+		Namespace: "cattle-system",
+		Version:   1,
+		Info:      &release.Info{Status: release.StatusDeployed},
+		Chart:     crd,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	_, out, err := executeActionCommandC(store, "install test/rancher "+flags)
+	if err != nil {
+		t.Fatalf("unexpected error: %v: %s", err, out)
+	}
+	if !strings.Contains(out, `Chart "rancher-crd", required by chart "rancher", is already installed as release "rancher-crd"`) {
+		t.Errorf("expected rancher-crd to be skipped, got %s", out)
+	}
+	rel, err := store.Last("fleet")
+	if err != nil {
+		t.Fatalf("expected rancher to be installed: %v: %s", err, out)
+	}
+	if rel.Namespace != "fleet-system" {
+		t.Errorf("expected rancher to be installed in fleet-system, got %s", rel.Namespace)
+	}
+}
+
+func TestInstallIncompatibleKubeVersion(t *testing.T) {
+	defer resetEnv()()
+
+	ch, err := loader.Load("testdata/testcharts/fallback-annot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch.Metadata.Annotations["catalog.cattle.io/kube-version"] = "< 1.19.0-0"
+	dir := ensure.TempDir(t)
+	if _, err := chartutil.Save(ch, dir); err != nil {
+		t.Fatal(err)
+	}
+	srv, err := repotest.NewTempServerWithCleanup(t, filepath.Join(dir, "*.tgz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Stop()
+	if err := srv.LinkIndices(); err != nil {
+		t.Fatal(err)
+	}
+	// the archive is gone, the install is refused from the index
+	if err := os.Remove(filepath.Join(srv.Root(), "empty-0.1.0.tgz")); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := fmt.Sprintf("install test/empty --repository-config %s --repository-cache %s",
+		filepath.Join(srv.Root(), "repositories.yaml"), srv.Root())
+	_, out, err := executeActionCommandC(storageFixture(), cmd)
+	want := "chart empty 0.1.0 requires catalog.cattle.io/kube-version: < 1.19.0-0 which is incompatible with Kubernetes v1.20.0"
+	if err == nil || err.Error() != want {
+		t.Errorf("expected %q, got %v: %s", want, err, out)
+	}
+}
+
+func TestInstallInteractive(t *testing.T) {
+	defer resetEnv()()
+
+	dir := ensure.TempDir(t)
+	answersFile := filepath.Join(dir, "answers.yaml")
+	in, err := os.Create(filepath.Join(dir, "stdin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	// image.tag defaults to the values, replicas is out of range and then
+	// defaults too, the second log level, and the ingress with its host and
+	// without TLS
+	if _, err := in.WriteString("\n7\n\n2\ny\nexample.com\nn\n"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := in.Seek(0, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	wantConfig := map[string]interface{}{
+		"image":    map[string]interface{}{"tag": "1.0.0"},
+		"replicas": int64(1),
+		"logLevel": "debug",
+		"ingress":  map[string]interface{}{"enabled": true, "host": "example.com", "tls": false},
+	}
+
+	store := storageFixture()
+	_, out, err := executeActionCommandStdinC(store, in,
+		"install testdata/testcharts/questions -n questions-system --interactive --save-answers "+answersFile)
+	if err != nil {
+		t.Fatalf("unexpected error: %v: %s", err, out)
+	}
+	for _, want := range []string{"Image tag [1.0.0]: ", "the answer must be at most 5", "  2) debug\n", "Answers saved to " + answersFile} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in the output, got %s", want, out)
+		}
+	}
+	if strings.Contains(out, "TLS secret") {
+		t.Errorf("expected the TLS secret not to be asked without TLS, got %s", out)
+	}
+	rel, err := store.Last("questions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(wantConfig, rel.Config) {
+		t.Errorf("expected values %v, got %v", wantConfig, rel.Config)
+	}
+
+	// the saved answers are replayed without prompts
+	store = storageFixture()
+	_, out, err = executeActionCommandC(store, "install testdata/testcharts/questions -n questions-system --answers "+answersFile)
+	if err != nil {
+		t.Fatalf("unexpected error: %v: %s", err, out)
+	}
+	if strings.Contains(out, "Image tag") {
+		t.Errorf("expected no prompts when replaying answers, got %s", out)
+	}
+	if rel, err = store.Last("questions"); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(wantConfig, rel.Config) {
+		t.Errorf("expected values %v, got %v", wantConfig, rel.Config)
+	}
+
+	_, _, err = executeActionCommandC(storageFixture(), "install testdata/testcharts/questions --save-answers "+answersFile)
+	if err == nil || err.Error() != "--save-answers requires --interactive or --answers" {
+		t.Errorf("expected --save-answers to require answers, got %v", err)
+	}
+}
+
+func TestInstallAnswersChecked(t *testing.T) {
+	defer resetEnv()()
+
+	dir := ensure.TempDir(t)
+	answersFile := filepath.Join(dir, "answers.yaml")
+
+	// answers to questions not shown are not set
+	answers := "image.tag: 1.0.0\nreplicas: 2\nlogLevel: 2\ningress.enabled: \"false\"\ningress.host: example.com\ningress.secret: my-secret\n"
+	if err := ioutil.WriteFile(answersFile, []byte(answers), 0600); err != nil {
+		t.Fatal(err)
+	}
+	store := storageFixture()
+	_, out, err := executeActionCommandC(store, "install testdata/testcharts/questions -n questions-system --answers "+answersFile)
+	if err != nil {
+		t.Fatalf("unexpected error: %v: %s", err, out)
+	}
+	rel, err := store.Last("questions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantConfig := map[string]interface{}{
+		"image":    map[string]interface{}{"tag": "1.0.0"},
+		"replicas": int64(2),
+		"logLevel": "debug",
+		"ingress":  map[string]interface{}{"enabled": false},
+	}
+	if !reflect.DeepEqual(wantConfig, rel.Config) {
+		t.Errorf("expected values %v, got %v", wantConfig, rel.Config)
+	}
+
+	// invalid answers are an error
+	if err := ioutil.WriteFile(answersFile, []byte("replicas: abc\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = executeActionCommandC(storageFixture(), "install testdata/testcharts/questions -n questions-system --answers "+answersFile)
+	if err == nil || err.Error() != "invalid answer for replicas: the answer must be an integer" {
+		t.Errorf("expected an invalid answer error, got %v", err)
+	}
+}
+
+func TestInstallInteractiveSchema(t *testing.T) {
+	defer resetEnv()()
+
+	dir := ensure.TempDir(t)
+	in, err := os.Create(filepath.Join(dir, "stdin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	// replicas is in the values of the chart, so only the name and the
+	// engine, defaulting to the schema, are asked
+	if _, err := in.WriteString("\nmy-app\nsqlite\n\n"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := in.Seek(0, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	store := storageFixture()
+	_, out, err := executeActionCommandStdinC(store, in, "install testdata/testcharts/schema -n schema-system --interactive")
+	if err != nil {
+		t.Fatalf("unexpected error: %v: %s", err, out)
+	}
+	for _, want := range []string{"an answer is required", "Database engine [mariadb]: ", "the answer must be one of: mariadb, postgresql"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in the output, got %s", want, out)
+		}
+	}
+	if strings.Contains(out, "replicas") {
+		t.Errorf("expected replicas not to be asked, got %s", out)
+	}
+	rel, err := store.Last("schema")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"name":     "my-app",
+		"database": map[string]interface{}{"engine": "mariadb"},
+	}
+	if !reflect.DeepEqual(want, rel.Config) {
+		t.Errorf("expected values %v, got %v", want, rel.Config)
+	}
+
+	// without prompts, the schema of the chart is not satisfied
+	_, out, err = executeActionCommandC(storageFixture(), "install testdata/testcharts/schema -n schema-system")
+	if err == nil || !strings.Contains(err.Error(), "values don't meet the specifications of the schema") {
+		t.Errorf("expected the values to be refused by the schema, got %v: %s", err, out)
+	}
+}
+
+func TestInstallFlagsBinding(t *testing.T) {
+	client := action.NewInstall(&action.Configuration{})
+	valueOpts := &values.Options{}
+	cmd := &cobra.Command{Use: "install"}
+	addInstallFlags(cmd, cmd.Flags(), client, valueOpts)
+
+	err := cmd.ParseFlags([]string{
+		"--create-namespace", "--dry-run", "--no-hooks", "--replace", "--timeout", "1m",
+		"--wait", "--wait-for-jobs", "--generate-name", "--name-template", "rel-{{ randAlpha 3 }}",
+		"--description", "my description", "--devel", "--dependency-update",
+		"--disable-openapi-validation", "--atomic", "--skip-crds", "--render-subchart-notes",
+		"--skip-auto-install",
+		"-f", "a.yaml,b.yaml", "--set", "a=1", "--set-string", "b=2", "--set-file", "c=c.txt",
+		"--version", "^1.0", "--verify", "--keyring", "pubring.gpg", "--repo", "https://example.com",
+		"--username", "user", "--password", "pass", "--cert-file", "cert.pem", "--key-file", "key.pem",
+		"--insecure-skip-tls-verify", "--ca-file", "ca.pem",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for flag, got := range map[string]bool{
+		"create-namespace":           client.CreateNamespace,
+		"dry-run":                    client.DryRun,
+		"no-hooks":                   client.DisableHooks,
+		"replace":                    client.Replace,
+		"wait":                       client.Wait,
+		"wait-for-jobs":              client.WaitForJobs,
+		"generate-name":              client.GenerateName,
+		"devel":                      client.Devel,
+		"dependency-update":          client.DependencyUpdate,
+		"disable-openapi-validation": client.DisableOpenAPIValidation,
+		"atomic":                     client.Atomic,
+		"skip-crds":                  client.SkipCRDs,
+		"render-subchart-notes":      client.SubNotes,
+		"skip-auto-install":          client.SkipAutoInstall,
+		"verify":                     client.Verify,
+		"insecure-skip-tls-verify":   client.InsecureSkipTLSverify,
+	} {
+		if !got {
+			t.Errorf("expected --%s to be set", flag)
+		}
+	}
+	for flag, got := range map[string][]string{
+		"name-template": {"rel-{{ randAlpha 3 }}", client.NameTemplate},
+		"description":   {"my description", client.Description},
+		"timeout":       {"1m0s", client.Timeout.String()},
+		"values":        {"a.yaml b.yaml", strings.Join(valueOpts.ValueFiles, " ")},
+		"set":           {"a=1", strings.Join(valueOpts.Values, " ")},
+		"set-string":    {"b=2", strings.Join(valueOpts.StringValues, " ")},
+		"set-file":      {"c=c.txt", strings.Join(valueOpts.FileValues, " ")},
+		"version":       {"^1.0", client.Version},
+		"keyring":       {"pubring.gpg", client.Keyring},
+		"repo":          {"https://example.com", client.RepoURL},
+		"username":      {"user", client.Username},
+		"password":      {"pass", client.Password},
+		"cert-file":     {"cert.pem", client.CertFile},
+		"key-file":      {"key.pem", client.KeyFile},
+		"ca-file":       {"ca.pem", client.CaFile},
+	} {
+		if got[0] != got[1] {
+			t.Errorf("expected --%s to be %q, got %q", flag, got[0], got[1])
+		}
+	}
+}
+
+func TestInstallValuesFlags(t *testing.T) {
+	defer resetEnv()()
+
+	dir := ensure.TempDir(t)
+	valuesFile := filepath.Join(dir, "values.yaml")
+	if err := os.WriteFile(valuesFile, []byte("image:\n  tag: 1.0.0\nreplicas: 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	textFile := filepath.Join(dir, "motd.txt")
+	if err := os.WriteFile(textFile, []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	store := storageFixture()
+	cmd := fmt.Sprintf("install myvalues testdata/testcharts/vanilla-helm -f %s --set replicas=3 --set-string version=2 --set-file motd=%s",
+		valuesFile, textFile)
+	if _, out, err := executeActionCommandC(store, cmd); err != nil {
+		t.Fatalf("unexpected error: %v: %s", err, out)
+	}
+	rel, err := store.Last("myvalues")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"image":    map[string]interface{}{"tag": "1.0.0"},
+		"replicas": int64(3),
+		"version":  "2",
+		"motd":     "hello",
+	}
+	if !reflect.DeepEqual(want, rel.Config) {
+		t.Errorf("expected values %v, got %v", want, rel.Config)
+	}
+}
+
+func TestInstallReleaseFlags(t *testing.T) {
+	defer resetEnv()()
+
+	// --dry-run does not store the release
+	store := storageFixture()
+	if _, out, err := executeActionCommandC(store, "install dry testdata/testcharts/vanilla-helm --dry-run"); err != nil {
+		t.Fatalf("unexpected error: %v: %s", err, out)
+	}
+	if _, err := store.Last("dry"); err == nil {
+		t.Error("expected --dry-run not to install the release")
+	}
+
+	// --description, --no-hooks, --wait, --timeout and --atomic
+	if _, out, err := executeActionCommandC(store, "install described testdata/testcharts/vanilla-helm --description 'my release' --no-hooks --wait --timeout 10s --atomic"); err != nil {
+		t.Fatalf("unexpected error: %v: %s", err, out)
+	}
+	rel, err := store.Last("described")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rel.Info.Description != "my release" {
+		t.Errorf("expected the description to be set, got %q", rel.Info.Description)
+	}
+
+	// --name-template
+	if _, out, err := executeActionCommandC(store, "install testdata/testcharts/vanilla-helm --name-template 'templated-{{ print \"name\" }}'"); err != nil {
+		t.Fatalf("unexpected error: %v: %s", err, out)
+	}
+	if _, err := store.Last("templated-name"); err != nil {
+		t.Errorf("expected the release name to come from --name-template: %v", err)
+	}
+
+	// --replace re-uses the name of an uninstalled release
+	rel.Info.Status = release.StatusUninstalled
+	if err := store.Update(rel); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := executeActionCommandC(store, "install described testdata/testcharts/vanilla-helm"); err == nil {
+		t.Error("expected the release name to be in use without --replace")
+	}
+	if _, out, err := executeActionCommandC(store, "install described testdata/testcharts/vanilla-helm --replace"); err != nil {
+		t.Fatalf("unexpected error: %v: %s", err, out)
+	}
+	if rel, err = store.Last("described"); err != nil || rel.Info.Status != release.StatusDeployed {
+		t.Errorf("expected the release to be replaced: %v", err)
+	}
+}
+
+func TestInstallVersionFlags(t *testing.T) {
+	defer resetEnv()()
+
+	dir := ensure.TempDir(t)
+	for _, v := range []string{"0.1.0", "0.2.0", "0.3.0-rc.1"} {
+		ch, err := loader.Load("testdata/testcharts/vanilla-helm")
+		if err != nil {
+			t.Fatal(err)
+		}
+		ch.Metadata.Version = v
+		if _, err := chartutil.Save(ch, dir); err != nil {
+			t.Fatal(err)
+		}
+	}
+	srv, err := repotest.NewTempServerWithCleanup(t, filepath.Join(dir, "*.tgz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Stop()
+	if err := srv.LinkIndices(); err != nil {
+		t.Fatal(err)
+	}
+	flags := fmt.Sprintf("--repository-config %s --repository-cache %s",
+		filepath.Join(srv.Root(), "repositories.yaml"), srv.Root())
+
+	for _, tt := range []struct {
+		name    string
+		cmd     string
+		version string
+	}{
+		{name: "latest", cmd: "install latest test/empty", version: "0.2.0"},
+		{name: "version", cmd: "install pinned test/empty --version 0.1.0", version: "0.1.0"},
+		{name: "devel", cmd: "install devel test/empty --devel", version: "0.3.0-rc.1"},
+		{name: "by name", cmd: "install byname empty --version ~0.1", version: "0.1.0"},
+		{name: "repo", cmd: "install fromrepo empty --repo " + srv.URL() + " --version 0.1.0", version: "0.1.0"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			store := storageFixture()
+			if _, out, err := executeActionCommandC(store, tt.cmd+" "+flags); err != nil {
+				t.Fatalf("unexpected error: %v: %s", err, out)
+			}
+			name := strings.Fields(tt.cmd)[1]
+			rel, err := store.Last(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rel.Chart.Metadata.Version != tt.version {
+				t.Errorf("expected version %s, got %s", tt.version, rel.Chart.Metadata.Version)
+			}
+		})
+	}
+
+	// the versions of the chart are completed
+	for _, chart := range []string{"test/empty", "empty"} {
+		_, out, err := executeActionCommandC(storageFixture(), fmt.Sprintf("__complete install myrel %s %s --version 0.", chart, flags))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := "0.3.0-rc.1\n0.2.0\n0.1.0\n:4\n"; !strings.HasPrefix(out, want) {
+			t.Errorf("expected the versions of %s to be completed with %q, got %q", chart, want, out)
+		}
+	}
+}
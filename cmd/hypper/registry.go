@@ -0,0 +1,70 @@
+/*
+Copyright The Helm Authors, SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"io"
+
+	"github.com/Masterminds/log-go"
+	logio "github.com/Masterminds/log-go/io"
+	"github.com/spf13/cobra"
+
+	"github.com/rancher-sandbox/hypper/cmd/hypper/require"
+	"github.com/rancher-sandbox/hypper/pkg/action"
+	"github.com/rancher-sandbox/hypper/pkg/registry"
+)
+
+const registryHelp = `
+This command consists of multiple subcommands to interact with registries.
+
+Credentials are stored in the registry config file (see --registry-config).
+`
+
+func newRegistryCmd(actionConfig *action.Configuration, logger log.Logger) *cobra.Command {
+	wInfo := logio.NewWriter(logger, log.InfoLevel)
+	cmd := &cobra.Command{
+		Use:   "registry login|logout [ARGS]",
+		Short: "login to or logout from a registry",
+		Long:  registryHelp,
+		Args:  require.NoArgs,
+	}
+
+	cmd.AddCommand(
+		newRegistryLoginCmd(actionConfig, wInfo),
+		newRegistryLogoutCmd(actionConfig, wInfo),
+	)
+
+	return cmd
+}
+
+// ensureRegistryClient sets up the registry client of actionConfig, unless
+// one has been set already. It is only created by the commands that need it,
+// so that a broken registry config does not affect the rest of them.
+func ensureRegistryClient(actionConfig *action.Configuration, out io.Writer) error {
+	if actionConfig.RegistryClient != nil {
+		return nil
+	}
+	client, err := registry.NewClient(
+		registry.ClientOptWriter(out),
+		registry.ClientOptCredentialsFile(settings.RegistryConfig),
+	)
+	if err != nil {
+		return err
+	}
+	actionConfig.RegistryClient = client
+	return nil
+}
@@ -0,0 +1,130 @@
+/*
+Copyright The Helm Authors, SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/Masterminds/log-go"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+
+	"github.com/rancher-sandbox/hypper/cmd/hypper/require"
+	"github.com/rancher-sandbox/hypper/pkg/action"
+)
+
+const registryLoginDesc = `
+Authenticate to a remote registry.
+
+The credentials are stored in the registry config file.
+`
+
+type registryLoginOptions struct {
+	hostname          string
+	username          string
+	password          string
+	passwordFromStdin bool
+	insecure          bool
+}
+
+func newRegistryLoginCmd(actionConfig *action.Configuration, out io.Writer) *cobra.Command {
+	o := &registryLoginOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "login [HOST]",
+		Short: "login to a registry",
+		Long:  registryLoginDesc,
+		Args:  require.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			o.hostname = args[0]
+			return o.run(actionConfig, os.Stdin, out)
+		},
+	}
+
+	f := cmd.Flags()
+	f.StringVarP(&o.username, "username", "u", "", "registry username")
+	f.StringVarP(&o.password, "password", "p", "", "registry password or identity token")
+	f.BoolVar(&o.passwordFromStdin, "password-stdin", false, "read password or identity token from stdin")
+	f.BoolVar(&o.insecure, "insecure", false, "allow connections to TLS registry without certs")
+
+	return cmd
+}
+
+func (o *registryLoginOptions) run(actionConfig *action.Configuration, in *os.File, out io.Writer) error {
+	if err := ensureRegistryClient(actionConfig, out); err != nil {
+		return err
+	}
+	if err := o.readCredentials(in, out); err != nil {
+		return err
+	}
+	return action.NewRegistryLogin(actionConfig).Run(o.hostname, o.username, o.password, o.insecure)
+}
+
+// readCredentials fills the username and password, either from stdin or by
+// prompting for them.
+//
+// Adapted from https://github.com/deislabs/oras
+func (o *registryLoginOptions) readCredentials(in *os.File, out io.Writer) error {
+	if o.passwordFromStdin {
+		if o.password != "" {
+			return errors.New("--password and --password-stdin are mutually exclusive")
+		}
+		b, err := ioutil.ReadAll(in)
+		if err != nil {
+			return err
+		}
+		o.password = strings.TrimSuffix(string(b), "\n")
+		o.password = strings.TrimSuffix(o.password, "\r")
+		return nil
+	}
+
+	if o.password != "" {
+		log.Warn("Using --password via the CLI is insecure. Use --password-stdin.")
+		return nil
+	}
+
+	if o.username == "" {
+		fmt.Fprint(out, "Username: ")
+		username, err := bufio.NewReader(in).ReadString('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		o.username = strings.TrimSpace(username)
+	}
+
+	prompt := "Password: "
+	if o.username == "" {
+		prompt = "Token: "
+	}
+	fmt.Fprint(out, prompt)
+	password, err := term.ReadPassword(int(in.Fd()))
+	fmt.Fprintln(out)
+	if err != nil {
+		return err
+	}
+	if len(password) == 0 {
+		return errors.Errorf("%s required", strings.ToLower(strings.TrimSuffix(prompt, ": ")))
+	}
+	o.password = string(password)
+	return nil
+}
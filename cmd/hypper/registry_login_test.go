@@ -0,0 +1,125 @@
+/*
+Copyright The Helm Authors, SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rancher-sandbox/hypper/internal/test/ensure"
+)
+
+func TestRegistryLoginLogoutCmd(t *testing.T) {
+	defer resetEnv()()
+
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Docker-Distribution-API-Version", "registry/2.0")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpdir := ensure.TempDir(t)
+	defer os.RemoveAll(tmpdir)
+	registryConfig := filepath.Join(tmpdir, "registry.json")
+
+	in, err := ioutil.TempFile(tmpdir, "stdin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := in.WriteString("mypass\n"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := in.Seek(0, 0); err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+
+	cmd := fmt.Sprintf("registry login %s -u myuser --password-stdin --insecure --registry-config %s", u.Host, registryConfig)
+	_, out, err := executeActionCommandStdinC(storageFixture(), in, cmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "Login succeeded") {
+		t.Errorf("expected login message, got %q", out)
+	}
+
+	b, err := ioutil.ReadFile(registryConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), u.Host) {
+		t.Errorf("expected credentials for %s in %s, got %s", u.Host, registryConfig, b)
+	}
+
+	cmd = fmt.Sprintf("registry logout %s --registry-config %s", u.Host, registryConfig)
+	if _, out, err = executeActionCommandC(storageFixture(), cmd); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "Logout succeeded") {
+		t.Errorf("expected logout message, got %q", out)
+	}
+
+	if _, _, err = executeActionCommandC(storageFixture(), cmd); err == nil {
+		t.Error("expected an error when logging out twice")
+	}
+}
+
+func TestRegistryLoginPasswordFlags(t *testing.T) {
+	o := &registryLoginOptions{
+		password:          "secret",
+		passwordFromStdin: true,
+	}
+	if err := o.readCredentials(os.Stdin, ioutil.Discard); err == nil {
+		t.Error("expected an error when using --password and --password-stdin")
+	}
+}
+
+func TestBrokenRegistryConfigOnlyAffectsRegistryCmds(t *testing.T) {
+	defer resetEnv()()
+
+	tmpdir := ensure.TempDir(t)
+	defer os.RemoveAll(tmpdir)
+	registryConfig := filepath.Join(tmpdir, "registry.json")
+	if err := ioutil.WriteFile(registryConfig, []byte("{not json"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	repoFile := filepath.Join(tmpdir, "repositories.yaml")
+	if err := ioutil.WriteFile(repoFile, []byte("repositories:\n- name: test\n  url: https://example.com/charts\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := fmt.Sprintf("repo list --registry-config %s --repository-config %s", registryConfig, repoFile)
+	if _, _, err := executeActionCommandC(storageFixture(), cmd); err != nil {
+		t.Errorf("expected repo list to ignore the registry config, got %v", err)
+	}
+
+	cmd = fmt.Sprintf("registry logout example.com --registry-config %s", registryConfig)
+	if _, _, err := executeActionCommandC(storageFixture(), cmd); err == nil {
+		t.Error("expected an error when the registry config cannot be read")
+	}
+}
@@ -0,0 +1,45 @@
+/*
+Copyright The Helm Authors, SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"io"
+
+	"github.com/spf13/cobra"
+
+	"github.com/rancher-sandbox/hypper/cmd/hypper/require"
+	"github.com/rancher-sandbox/hypper/pkg/action"
+)
+
+const registryLogoutDesc = `
+Remove credentials stored for a remote registry.
+`
+
+func newRegistryLogoutCmd(actionConfig *action.Configuration, out io.Writer) *cobra.Command {
+	return &cobra.Command{
+		Use:   "logout [HOST]",
+		Short: "logout from a registry",
+		Long:  registryLogoutDesc,
+		Args:  require.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := ensureRegistryClient(actionConfig, out); err != nil {
+				return err
+			}
+			return action.NewRegistryLogout(actionConfig).Run(args[0])
+		},
+	}
+}
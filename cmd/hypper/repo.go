@@ -19,8 +19,8 @@ It can be used to add, remove, list, and index chart repositories.
 func newRepoCmd(logger log.Logger) *cobra.Command {
 	wInfo := logio.NewWriter(logger, log.InfoLevel)
 	cmd := &cobra.Command{
-		Use:   "repo add|remove|list|index|update [ARGS]",
-		Short: "add, list, remove, update, and index chart repositories",
+		Use:   "repo add|remove|modify|list|index|update|mirror|diff|verify|import [ARGS]",
+		Short: "add, list, remove, modify, update, index, mirror, diff, verify, and import chart repositories",
 		Long:  repoHypper,
 		Args:  require.NoArgs,
 	}
@@ -31,6 +31,11 @@ func newRepoCmd(logger log.Logger) *cobra.Command {
 		newRepoIndexCmd(wInfo),
 		newRepoUpdateCmd(wInfo),
 		newRepoRemoveCmd(wInfo),
+		newRepoModifyCmd(wInfo),
+		newRepoMirrorCmd(wInfo),
+		newRepoDiffCmd(wInfo),
+		newRepoVerifyCmd(wInfo),
+		newRepoImportCmd(wInfo),
 	)
 
 	return cmd
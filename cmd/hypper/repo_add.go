@@ -32,6 +32,7 @@ import (
 	"golang.org/x/term"
 	"sigs.k8s.io/yaml"
 
+	"github.com/rancher-sandbox/hypper/pkg/credentials"
 	"github.com/rancher-sandbox/hypper/pkg/repo"
 	"helm.sh/helm/v3/cmd/helm/require"
 	"helm.sh/helm/v3/pkg/getter"
@@ -44,11 +45,35 @@ var deprecatedRepos = map[string]string{
 	"//kubernetes-charts-incubator.storage.googleapis.com": "https://charts.helm.sh/incubator",
 }
 
+const repoAddDesc = `
+Add a chart repository.
+
+The URL can also be a local directory, or its file:// URL. Local directories
+are used as they are: if they have no index.yaml, their charts are indexed when
+the repository is added or updated.
+
+The username and password given with '--username' and '--password' are not
+written to the repositories file. They are kept by a credential helper, by
+default the built in "file" helper, which keeps them in a file of the hypper
+configuration directory encrypted with a passphrase. The passphrase is taken
+from $HYPPER_CREDENTIALS_PASSPHRASE, or asked on the terminal when it is not
+set. Any other helper speaking the protocol of the docker credential helpers
+(e.g: pass, secretservice or osxkeychain) can be used instead, by installing it
+in $PATH as hypper-credential-NAME or docker-credential-NAME:
+
+	$ hypper repo add myrepo https://charts.example.com --username me \
+		--credential-helper pass
+
+Setting '--credential-helper' to an empty string keeps the credentials in the
+repositories file, in plain text.
+`
+
 type repoAddOptions struct {
 	name                 string
 	url                  string
 	username             string
 	password             string
+	credentialHelper     string
 	forceUpdate          bool
 	allowDeprecatedRepos bool
 
@@ -57,6 +82,10 @@ type repoAddOptions struct {
 	caFile                string
 	insecureSkipTLSverify bool
 
+	verify   bool
+	keyring  string
+	priority int
+
 	repoFile  string
 	repoCache string
 
@@ -70,6 +99,7 @@ func newRepoAddCmd(out io.Writer) *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "add [NAME] [URL]",
 		Short: "add a chart repository",
+		Long:  repoAddDesc,
 		Args:  require.ExactArgs(2),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			o.name = args[0]
@@ -84,12 +114,16 @@ func newRepoAddCmd(out io.Writer) *cobra.Command {
 	f := cmd.Flags()
 	f.StringVar(&o.username, "username", "", "chart repository username")
 	f.StringVar(&o.password, "password", "", "chart repository password")
+	f.StringVar(&o.credentialHelper, "credential-helper", credentials.DefaultHelper, "credential helper keeping the username and password of the repository")
 	f.BoolVar(&o.forceUpdate, "force-update", false, "replace (overwrite) the repo if it already exists")
 	f.BoolVar(&o.deprecatedNoUpdate, "no-update", false, "Ignored. Formerly, it would disabled forced updates. It is deprecated by force-update.")
 	f.StringVar(&o.certFile, "cert-file", "", "identify HTTPS client using this SSL certificate file")
 	f.StringVar(&o.keyFile, "key-file", "", "identify HTTPS client using this SSL key file")
 	f.StringVar(&o.caFile, "ca-file", "", "verify certificates of HTTPS-enabled servers using this CA bundle")
 	f.BoolVar(&o.insecureSkipTLSverify, "insecure-skip-tls-verify", false, "skip tls certificate checks for the repository")
+	f.BoolVar(&o.verify, "verify", false, "require the repository index to be signed, and verify its signature on add and update")
+	f.StringVar(&o.keyring, "keyring", defaultKeyring(), "location of the public keys used to verify the repository index")
+	f.IntVar(&o.priority, "priority", 0, "priority of the repository when installing charts by name; higher priorities are preferred")
 	f.BoolVar(&o.allowDeprecatedRepos, "allow-deprecated-repos", false, "by default, this command will not allow adding official repos that have been permanently deleted. This disables that behavior")
 
 	return cmd
@@ -105,25 +139,20 @@ func (o *repoAddOptions) run(out io.Writer) error {
 		}
 	}
 
-	// Ensure the file directory exists as it is required for file locking
-	err := os.MkdirAll(filepath.Dir(o.repoFile), os.ModePerm)
-	if err != nil && !os.IsExist(err) {
-		return err
+	// Local directories are added as file:// repositories
+	if fi, err := os.Stat(o.url); err == nil && fi.IsDir() {
+		u, err := repo.LocalURL(o.url)
+		if err != nil {
+			return err
+		}
+		o.url = u
 	}
 
-	// Acquire a file lock for process synchronization
-	fileLock := flock.New(strings.Replace(o.repoFile, filepath.Ext(o.repoFile), ".lock", 1))
-	lockCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-	locked, err := fileLock.TryLockContext(lockCtx, time.Second)
-	if err == nil && locked {
-		defer func() {
-			_ = fileLock.Unlock()
-		}()
-	}
+	unlock, err := lockRepoFile(o.repoFile)
 	if err != nil {
 		return err
 	}
+	defer unlock()
 
 	b, err := ioutil.ReadFile(o.repoFile)
 	if err != nil && !os.IsNotExist(err) {
@@ -146,15 +175,30 @@ func (o *repoAddOptions) run(out io.Writer) error {
 		o.password = string(password)
 	}
 
-	c := helmRepo.Entry{
-		Name:                  o.name,
-		URL:                   o.url,
-		Username:              o.username,
-		Password:              o.password,
-		CertFile:              o.certFile,
-		KeyFile:               o.keyFile,
-		CAFile:                o.caFile,
-		InsecureSkipTLSverify: o.insecureSkipTLSverify,
+	c := repo.Entry{
+		Entry: helmRepo.Entry{
+			Name:                  o.name,
+			URL:                   o.url,
+			Username:              o.username,
+			Password:              o.password,
+			CertFile:              o.certFile,
+			KeyFile:               o.keyFile,
+			CAFile:                o.caFile,
+			InsecureSkipTLSverify: o.insecureSkipTLSverify,
+		},
+		Priority: o.priority,
+	}
+	if o.verify {
+		c.Verify = true
+		c.Keyring = o.keyring
+	}
+
+	// The entry as written to the repositories file
+	stored := c
+	if c.Username != "" && o.credentialHelper != "" {
+		stored.CredentialHelper = o.credentialHelper
+		stored.Username = ""
+		stored.Password = ""
 	}
 
 	// If the repo exists do one of two things:
@@ -162,7 +206,7 @@ func (o *repoAddOptions) run(out io.Writer) error {
 	// 2. When the config is different require --force-update
 	if !o.forceUpdate && f.Has(o.name) {
 		existing := f.Get(o.name)
-		if c != *existing {
+		if !stored.Equal(existing) || !sameCredentials(existing, &c) {
 
 			// The input coming in for the name is different from what is already
 			// configured. Return an error.
@@ -174,7 +218,7 @@ func (o *repoAddOptions) run(out io.Writer) error {
 		return nil
 	}
 
-	r, err := repo.NewChartRepository(&c, getter.All(settings.EnvSettings))
+	r, err := repo.NewChartRepositoryFromEntry(&c, getter.All(settings.EnvSettings))
 	if err != nil {
 		return err
 	}
@@ -186,6 +230,18 @@ func (o *repoAddOptions) run(out io.Writer) error {
 		return errors.Wrapf(err, "looks like %q is not a valid chart repository or cannot be reached", o.url)
 	}
 
+	// Forget the credentials of the replaced repository, which may have
+	// another URL or credential helper
+	if existing := f.Get(o.name); existing != nil {
+		if err := existing.EraseCredentials(); err != nil {
+			fmt.Fprintf(out, "WARNING: the credentials of the replaced %q could not be removed: %s\n", o.name, err)
+		}
+	}
+	if stored.CredentialHelper != "" {
+		if err := c.StoreCredentials(stored.CredentialHelper); err != nil {
+			return err
+		}
+	}
 	f.Update(&c)
 
 	if err := f.WriteFile(o.repoFile, 0644); err != nil {
@@ -194,3 +250,36 @@ func (o *repoAddOptions) run(out io.Writer) error {
 	fmt.Fprintf(out, "%q has been added to your repositories\n", o.name)
 	return nil
 }
+
+// lockRepoFile acquires the lock of the repositories file, for process
+// synchronization. The returned function releases it.
+func lockRepoFile(repoFile string) (func(), error) {
+	// Ensure the file directory exists as it is required for file locking
+	err := os.MkdirAll(filepath.Dir(repoFile), os.ModePerm)
+	if err != nil && !os.IsExist(err) {
+		return nil, err
+	}
+
+	fileLock := flock.New(strings.Replace(repoFile, filepath.Ext(repoFile), ".lock", 1))
+	lockCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	locked, err := fileLock.TryLockContext(lockCtx, time.Second)
+	if err != nil {
+		return nil, err
+	}
+	return func() {
+		if locked {
+			_ = fileLock.Unlock()
+		}
+	}, nil
+}
+
+// sameCredentials returns true if the credentials of the configured entry
+// are the ones of c
+func sameCredentials(entry, c *repo.Entry) bool {
+	if entry.CredentialHelper == "" {
+		return true
+	}
+	username, password, err := entry.Credentials()
+	return err == nil && username == c.Username && password == c.Password
+}
@@ -17,19 +17,24 @@ limitations under the License.
 package main
 
 import (
+	"bytes"
 	"fmt"
 	"io/ioutil"
+	"net/http"
 	"os"
 	"path/filepath"
 	"sync"
 	"testing"
 
+	"github.com/pkg/errors"
 	"sigs.k8s.io/yaml"
 
 	"github.com/rancher-sandbox/hypper/internal/test/ensure"
+	"github.com/rancher-sandbox/hypper/pkg/credentials"
 	"github.com/rancher-sandbox/hypper/pkg/hypperpath"
 	"github.com/rancher-sandbox/hypper/pkg/hypperpath/xdg"
 	"github.com/rancher-sandbox/hypper/pkg/repo"
+	"helm.sh/helm/v3/pkg/provenance"
 	"helm.sh/helm/v3/pkg/repo/repotest"
 )
 
@@ -130,6 +135,176 @@ func TestRepoAdd(t *testing.T) {
 	}
 }
 
+func TestRepoAddVerify(t *testing.T) {
+	ts, err := repotest.NewTempServerWithCleanup(t, "testdata/testserver/*.*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ts.Stop()
+
+	rootDir := ensure.TempDir(t)
+	secret, public := writeTestKeyrings(t, rootDir)
+	repoFile := filepath.Join(rootDir, "repositories.yaml")
+	os.Setenv(xdg.CacheHomeEnvVar, rootDir)
+
+	o := &repoAddOptions{
+		name:     "signed",
+		url:      ts.URL(),
+		repoFile: repoFile,
+		verify:   true,
+		keyring:  public,
+	}
+
+	if err := o.run(ioutil.Discard); err == nil {
+		t.Error("expected an error adding a repository without index signature")
+	}
+
+	// sign the index with a different key
+	otherSecret, _ := writeTestKeyrings(t, ensure.TempDir(t))
+	signer, err := provenance.NewFromKeyring(otherSecret, "hypper-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.SignIndexFile(filepath.Join(ts.Root(), "index.yaml"), signer); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.run(ioutil.Discard); err == nil {
+		t.Error("expected an error adding a repository with an invalid index signature")
+	}
+
+	signer, err = provenance.NewFromKeyring(secret, "hypper-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.SignIndexFile(filepath.Join(ts.Root(), "index.yaml"), signer); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.run(ioutil.Discard); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := repo.LoadFile(repoFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e := f.Get("signed"); e == nil || !e.Verify || e.Keyring != public {
+		t.Errorf("expected the repository to be added with verification, got %#v", e)
+	}
+}
+
+func TestRepoAddLocalDirectory(t *testing.T) {
+	rootDir := ensure.TempDir(t)
+	chartsDir := filepath.Join(rootDir, "charts")
+	if err := os.MkdirAll(chartsDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := linkOrCopy("testdata/testcharts/vanilla-helm-compressedchart-0.1.0.tgz", filepath.Join(chartsDir, "vanilla-helm-compressedchart-0.1.0.tgz")); err != nil {
+		t.Fatal(err)
+	}
+	repoFile := filepath.Join(rootDir, "repositories.yaml")
+
+	o := &repoAddOptions{
+		name:      "local",
+		url:       chartsDir,
+		repoFile:  repoFile,
+		repoCache: rootDir,
+	}
+	if err := o.run(ioutil.Discard); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := repo.LoadFile(repoFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u := f.Get("local").URL; u != "file://"+filepath.ToSlash(chartsDir) {
+		t.Errorf("expected the directory to be added as a file:// URL, got %s", u)
+	}
+
+	index, err := repo.LoadIndexFile(filepath.Join(rootDir, hypperpath.CacheIndexFile("local")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(index.Entries["compressedchart"]) != 1 {
+		t.Errorf("expected the directory to be indexed, got %#v", index.Entries)
+	}
+}
+
+func TestRepoAddCredentialHelper(t *testing.T) {
+	defer resetEnv()()
+
+	rootDir := ensure.TempDir(t)
+	os.Setenv("HYPPER_CREDENTIALS_FILE", filepath.Join(rootDir, "credentials.enc"))
+	os.Setenv("HYPPER_CREDENTIALS_PASSPHRASE", "passphrase")
+
+	ts, err := repotest.NewTempServerWithCleanup(t, "testdata/testserver/*.*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ts.Stop()
+	ts.WithMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		if username, password, ok := r.BasicAuth(); !ok || username != "user" || password != "s3cr3t" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	})
+
+	repoFile := filepath.Join(rootDir, "repositories.yaml")
+	o := &repoAddOptions{
+		name:             "auth",
+		url:              ts.URL(),
+		username:         "user",
+		password:         "s3cr3t",
+		credentialHelper: credentials.DefaultHelper,
+		repoFile:         repoFile,
+		repoCache:        rootDir,
+	}
+	if err := o.run(ioutil.Discard); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ioutil.ReadFile(repoFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(b, []byte("s3cr3t")) {
+		t.Errorf("expected the password to be kept out of the repositories file:\n%s", b)
+	}
+	f, err := repo.LoadFile(repoFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := f.Get("auth")
+	if entry.CredentialHelper != credentials.DefaultHelper {
+		t.Errorf("expected the entry to reference the credential helper, got %q", entry.CredentialHelper)
+	}
+	if username, password, err := entry.Credentials(); err != nil || username != "user" || password != "s3cr3t" {
+		t.Errorf("unexpected credentials %q %q: %v", username, password, err)
+	}
+
+	// adding the same repository again is idempotent, unless the password
+	// changed
+	out := bytes.NewBuffer(nil)
+	if err := o.run(out); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "\"auth\" already exists with the same configuration, skipping\n" {
+		t.Errorf("unexpected output: %s", out.String())
+	}
+	o.password = "other"
+	if err := o.run(ioutil.Discard); err == nil {
+		t.Error("expected an error adding the repository with another password")
+	}
+
+	// the credentials are forgotten with the repository
+	rmOpts := &repoRemoveOptions{names: []string{"auth"}, repoFile: repoFile, repoCache: rootDir}
+	if err := rmOpts.run(ioutil.Discard); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := entry.Credentials(); errors.Cause(err) != credentials.ErrCredentialsNotFound {
+		t.Errorf("expected the credentials to be removed, got %v", err)
+	}
+}
+
 func TestRepoAddConcurrentGoRoutines(t *testing.T) {
 	const testName = "test-name"
 	repoFile := filepath.Join(ensure.TempDir(t), "repositories.yaml")
@@ -0,0 +1,238 @@
+/*
+Copyright SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gosuri/uitable"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"helm.sh/helm/v3/pkg/cli/output"
+	"helm.sh/helm/v3/pkg/getter"
+
+	"github.com/rancher-sandbox/hypper/cmd/hypper/require"
+	"github.com/rancher-sandbox/hypper/pkg/hypperpath"
+	"github.com/rancher-sandbox/hypper/pkg/repo"
+)
+
+const repoDiffDesc = `
+Show the chart versions added, removed or modified between two index files:
+
+	$ hypper repo diff old/index.yaml new/index.yaml
+
+or, given the name of a configured repository, between its cached index and
+the index currently served by the repository:
+
+	$ hypper repo diff myrepo
+
+A modified chart version has a different digest, URLs or metadata in both
+indexes. Modified versions whose archive digest changed are flagged, as the
+same chart version should never be published twice with different contents.
+`
+
+type repoDiffOptions struct {
+	args   []string
+	outfmt output.Format
+
+	repoFile  string
+	repoCache string
+}
+
+func newRepoDiffCmd(out io.Writer) *cobra.Command {
+	o := &repoDiffOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "diff [OLD] [NEW] | [REPO]",
+		Short: "show the charts changed between two repository indexes",
+		Long:  repoDiffDesc,
+		Args:  require.RangeArgs(1, 2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			o.args = args
+			o.repoFile = settings.RepositoryConfig
+			o.repoCache = settings.RepositoryCache
+			return o.run(out)
+		},
+	}
+
+	bindOutputFlag(cmd, &o.outfmt)
+
+	return cmd
+}
+
+func (o *repoDiffOptions) run(out io.Writer) error {
+	var oldIndex, newIndex *repo.IndexFile
+	var err error
+	if len(o.args) == 2 {
+		oldIndex, newIndex, err = loadIndexFiles(o.args[0], o.args[1])
+	} else {
+		oldIndex, newIndex, err = o.loadRepoIndexes(o.args[0])
+	}
+	if err != nil {
+		return err
+	}
+
+	return o.outfmt.Write(out, &repoDiffWriter{repo.DiffIndex(oldIndex, newIndex)})
+}
+
+func loadIndexFiles(oldPath, newPath string) (*repo.IndexFile, *repo.IndexFile, error) {
+	oldIndex, err := repo.LoadIndexFile(oldPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	newIndex, err := repo.LoadIndexFile(newPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	return oldIndex, newIndex, nil
+}
+
+// loadRepoIndexes returns the cached index of the named repository and the
+// index it currently serves
+func (o *repoDiffOptions) loadRepoIndexes(name string) (*repo.IndexFile, *repo.IndexFile, error) {
+	f, err := repo.LoadFile(o.repoFile)
+	switch {
+	case isNotExist(err):
+		return nil, nil, errors.New("no repositories configured")
+	case err != nil:
+		return nil, nil, errors.Wrapf(err, "failed loading file: %s", o.repoFile)
+	case len(f.Repositories) == 0:
+		return nil, nil, errors.New("no repositories configured")
+	}
+	if !f.Has(name) {
+		return nil, nil, errors.Errorf("no repo named %q found", name)
+	}
+
+	cached, err := repo.LoadIndexFile(filepath.Join(o.repoCache, hypperpath.CacheIndexFile(name)))
+	if isNotExist(err) {
+		return nil, nil, errors.Errorf("no cached index for %q, use 'hypper repo update %s' to fetch it", name, name)
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	r, err := repo.NewChartRepositoryFromEntry(f.Get(name), getter.All(settings.EnvSettings))
+	if err != nil {
+		return nil, nil, err
+	}
+	// Fetch the remote index without touching the repository cache
+	cache, err := ioutil.TempDir("", "hypper-diff-")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer os.RemoveAll(cache)
+	r.CachePath = cache
+	fname, err := r.DownloadIndexFile()
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "failed fetching the index of %q", name)
+	}
+	remote, err := repo.LoadIndexFile(fname)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cached, remote, nil
+}
+
+type repoDiffElement struct {
+	Name          string   `json:"name"`
+	Version       string   `json:"version"`
+	Change        string   `json:"change"`
+	Fields        []string `json:"fields,omitempty"`
+	DigestChanged bool     `json:"digest_changed"`
+	OldDigest     string   `json:"old_digest,omitempty"`
+	NewDigest     string   `json:"new_digest,omitempty"`
+}
+
+type repoDiffWriter struct {
+	changes []*repo.ChartVersionChange
+}
+
+func (r *repoDiffWriter) WriteTable(out io.Writer) error {
+	if len(r.changes) == 0 {
+		_, err := fmt.Fprintln(out, "No differences found")
+		return err
+	}
+	table := uitable.New()
+	table.AddRow("NAME", "VERSION", "CHANGE", "DETAILS")
+	for _, c := range r.changes {
+		table.AddRow(c.Name, c.Version, c.Change, changeDetails(c))
+	}
+	return output.EncodeTable(out, table)
+}
+
+func (r *repoDiffWriter) WriteJSON(out io.Writer) error {
+	return r.encodeByFormat(out, output.JSON)
+}
+
+func (r *repoDiffWriter) WriteYAML(out io.Writer) error {
+	return r.encodeByFormat(out, output.YAML)
+}
+
+func (r *repoDiffWriter) encodeByFormat(out io.Writer, format output.Format) error {
+	// Initialize the array so no results returns an empty array instead of null
+	changes := make([]repoDiffElement, 0, len(r.changes))
+
+	for _, c := range r.changes {
+		changes = append(changes, repoDiffElement{
+			Name:          c.Name,
+			Version:       c.Version,
+			Change:        string(c.Change),
+			Fields:        c.Fields,
+			DigestChanged: c.DigestChanged(),
+			OldDigest:     c.OldDigest,
+			NewDigest:     c.NewDigest,
+		})
+	}
+
+	switch format {
+	case output.JSON:
+		return output.EncodeJSON(out, changes)
+	case output.YAML:
+		return output.EncodeYAML(out, changes)
+	}
+
+	// Because this is a non-exported function and only called internally by
+	// WriteJSON and WriteYAML, we shouldn't get invalid types
+	return nil
+}
+
+// changeDetails describes a modified chart version, flagging digest changes
+func changeDetails(c *repo.ChartVersionChange) string {
+	if c.Change != repo.ChangeModified {
+		return ""
+	}
+	details := []string{}
+	for _, field := range c.Fields {
+		if field == "digest" {
+			field = fmt.Sprintf("DIGEST CHANGED (%s -> %s)", shortDigest(c.OldDigest), shortDigest(c.NewDigest))
+		}
+		details = append(details, field)
+	}
+	return strings.Join(details, ", ")
+}
+
+func shortDigest(digest string) string {
+	digest = strings.TrimPrefix(digest, "sha256:")
+	if len(digest) > 12 {
+		return digest[:12]
+	}
+	return digest
+}
@@ -0,0 +1,121 @@
+/*
+Copyright SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/cli/output"
+	"helm.sh/helm/v3/pkg/repo/repotest"
+
+	"github.com/rancher-sandbox/hypper/internal/test/ensure"
+	"github.com/rancher-sandbox/hypper/pkg/hypperpath"
+	"github.com/rancher-sandbox/hypper/pkg/repo"
+)
+
+func TestRepoDiffCmd(t *testing.T) {
+	tests := []cmdTestCase{{
+		name:   "diff two index files",
+		cmd:    "repo diff testdata/repodiff/old.yaml testdata/repodiff/new.yaml",
+		golden: "output/repo-diff.txt",
+	}, {
+		name:   "diff two index files as json",
+		cmd:    "repo diff testdata/repodiff/old.yaml testdata/repodiff/new.yaml -o json",
+		golden: "output/repo-diff.json",
+	}, {
+		name:   "diff identical index files",
+		cmd:    "repo diff testdata/repodiff/old.yaml testdata/repodiff/old.yaml",
+		golden: "output/repo-diff-none.txt",
+	}, {
+		name:      "diff missing index file",
+		cmd:       "repo diff testdata/repodiff/old.yaml testdata/repodiff/missing.yaml",
+		wantError: true,
+	}}
+	runTestCmd(t, tests)
+}
+
+func TestRepoDiffCachedIndex(t *testing.T) {
+	defer resetEnv()()
+
+	ts, err := repotest.NewTempServerWithCleanup(t, "testdata/testcharts/vanilla-helm-compressedchart-0.*.tgz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ts.Stop()
+
+	// the cached index only knows about one of the served charts
+	cached := repo.NewIndexFile()
+	cached.Add(
+		&chart.Metadata{APIVersion: chart.APIVersionV1, Name: "compressedchart", Version: "0.1.0"},
+		"compressedchart-0.1.0.tgz", ts.URL(), "sha256:0000",
+	)
+	if err := cached.WriteFile(filepath.Join(ts.Root(), hypperpath.CacheIndexFile("test")), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	o := &repoDiffOptions{
+		args:      []string{"test"},
+		outfmt:    output.Table,
+		repoFile:  filepath.Join(ts.Root(), "repositories.yaml"),
+		repoCache: ts.Root(),
+	}
+	b := bytes.NewBuffer(nil)
+	if err := o.run(b); err != nil {
+		t.Fatal(err)
+	}
+	got := b.String()
+	if !strings.Contains(got, "DIGEST CHANGED (0000 -> ") {
+		t.Errorf("expected the digest change of 0.1.0 to be flagged, got:\n%s", got)
+	}
+	added := map[string]bool{}
+	for _, line := range strings.Split(got, "\n") {
+		if fields := strings.Fields(line); len(fields) == 3 && fields[2] == "added" {
+			added[fields[1]] = true
+		}
+	}
+	if !added["0.2.0"] || !added["0.3.0"] {
+		t.Errorf("expected versions 0.2.0 and 0.3.0 to be added, got:\n%s", got)
+	}
+
+	o.args = []string{"unknown"}
+	if err := o.run(b); err == nil {
+		t.Error("expected an error diffing an unknown repository")
+	}
+}
+
+func TestRepoDiffBrokenFile(t *testing.T) {
+	dir := ensure.TempDir(t)
+	repoFile := filepath.Join(dir, "repositories.yaml")
+	if err := ioutil.WriteFile(repoFile, []byte("repositories:\n- name: test\n  url: [\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	o := &repoDiffOptions{
+		args:      []string{"test"},
+		outfmt:    output.Table,
+		repoFile:  repoFile,
+		repoCache: dir,
+	}
+	if err := o.run(ioutil.Discard); err == nil || !strings.Contains(err.Error(), "failed loading file") {
+		t.Errorf("expected an error loading the file, got %v", err)
+	}
+}
@@ -0,0 +1,235 @@
+/*
+Copyright SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"helm.sh/helm/v3/pkg/helmpath"
+	helmRepo "helm.sh/helm/v3/pkg/repo"
+
+	"github.com/rancher-sandbox/hypper/cmd/hypper/require"
+	"github.com/rancher-sandbox/hypper/pkg/credentials"
+	"github.com/rancher-sandbox/hypper/pkg/hypperpath"
+	"github.com/rancher-sandbox/hypper/pkg/repo"
+)
+
+const repoImportDesc = `
+Import the chart repositories of an existing Helm installation:
+
+	$ hypper repo import --from-helm
+
+The repositories configured in Helm are added to hypper, together with their
+cached indexes, so they can be used without running 'hypper repo update'.
+Helm's repositories.yaml and repository cache are found like Helm does, and
+can be set with '--helm-repository-config' and '--helm-repository-cache'.
+
+Repositories already configured in hypper with the same settings are skipped.
+Repositories with the name of a hypper repository with different settings
+are reported as conflicts, and left untouched unless '--force-update' is set.
+As Helm does not verify the signature of indexes, hypper repositories set to
+verify it are never replaced, and Helm's cached indexes are not copied for
+them.
+
+The usernames and passwords of the Helm repositories are stored with the
+credential helper given with '--credential-helper', see 'hypper repo add'.
+`
+
+type repoImportOptions struct {
+	fromHelm         bool
+	helmRepoFile     string
+	helmRepoCache    string
+	forceUpdate      bool
+	credentialHelper string
+
+	repoFile  string
+	repoCache string
+}
+
+func newRepoImportCmd(out io.Writer) *cobra.Command {
+	o := &repoImportOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "import --from-helm",
+		Short: "import chart repositories from Helm",
+		Long:  repoImportDesc,
+		Args:  require.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			o.repoFile = settings.RepositoryConfig
+			o.repoCache = settings.RepositoryCache
+			return o.run(out)
+		},
+	}
+
+	f := cmd.Flags()
+	f.BoolVar(&o.fromHelm, "from-helm", false, "import the repositories configured in Helm")
+	f.StringVar(&o.helmRepoFile, "helm-repository-config", envOr("HELM_REPOSITORY_CONFIG", helmpath.ConfigPath("repositories.yaml")), "path to Helm's repositories file")
+	f.StringVar(&o.helmRepoCache, "helm-repository-cache", envOr("HELM_REPOSITORY_CACHE", helmpath.CachePath("repository")), "path to Helm's repository cache")
+	f.BoolVar(&o.forceUpdate, "force-update", false, "replace the hypper repositories conflicting with Helm ones")
+	f.StringVar(&o.credentialHelper, "credential-helper", credentials.DefaultHelper, "credential helper keeping the usernames and passwords of the imported repositories")
+
+	return cmd
+}
+
+func (o *repoImportOptions) run(out io.Writer) error {
+	if !o.fromHelm {
+		return errors.New("nothing to import from, use --from-helm to import the repositories of Helm")
+	}
+
+	helmFile, err := helmRepo.LoadFile(o.helmRepoFile)
+	switch {
+	case isNotExist(err):
+		return errors.Errorf("no repositories configured in Helm's %s", o.helmRepoFile)
+	case err != nil:
+		return errors.Wrapf(err, "failed loading Helm's %s", o.helmRepoFile)
+	case len(helmFile.Repositories) == 0:
+		return errors.Errorf("no repositories configured in Helm's %s", o.helmRepoFile)
+	}
+
+	unlock, err := lockRepoFile(o.repoFile)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	f, err := repo.LoadFile(o.repoFile)
+	if isNotExist(err) {
+		f = repo.NewFile()
+	} else if err != nil {
+		return err
+	}
+
+	var imported, skipped, conflicts int
+	var replaced []*repo.Entry
+	for _, he := range helmFile.Repositories {
+		e := &repo.Entry{Entry: *he}
+		existing := f.Get(he.Name)
+		if existing != nil && sameImportedEntry(existing, e) {
+			fmt.Fprintf(out, "%q already exists with the same configuration, skipping\n", he.Name)
+			skipped++
+			// Helm does not verify the signature of indexes, so its cached
+			// index is not used for repositories requiring one
+			if !existing.Verify {
+				if err := o.copyCachedIndex(he.Name, false); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if existing != nil && !o.forceUpdate {
+			fmt.Fprintf(out, "%q conflicts with an existing repository with a different configuration, skipping (use --force-update to replace it)\n", he.Name)
+			conflicts++
+			continue
+		}
+		if existing != nil && existing.Verify {
+			fmt.Fprintf(out, "%q conflicts with an existing repository requiring a signed index, which Helm does not verify, skipping (use 'hypper repo add --force-update' to replace it)\n", he.Name)
+			conflicts++
+			continue
+		}
+
+		if existing != nil {
+			// Keep the hypper specific settings of the replaced repository
+			e.Priority = existing.Priority
+			e.Enabled = existing.Enabled
+			e.Pinned = existing.Pinned
+			replaced = append(replaced, existing)
+		}
+		if e.Username != "" && o.credentialHelper != "" {
+			if err := e.StoreCredentials(o.credentialHelper); err != nil {
+				return err
+			}
+		}
+		f.Update(e)
+		if err := o.copyCachedIndex(he.Name, true); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "%q has been imported from Helm\n", he.Name)
+		imported++
+	}
+
+	if imported > 0 {
+		if err := f.WriteFile(o.repoFile, 0644); err != nil {
+			return err
+		}
+	}
+	for _, existing := range replaced {
+		// The credentials of the new entry may be kept under the same key
+		if f.Get(existing.Name).CredentialHelper == existing.CredentialHelper && f.Get(existing.Name).URL == existing.URL {
+			continue
+		}
+		if err := existing.EraseCredentials(); err != nil {
+			fmt.Fprintf(out, "WARNING: the credentials of the replaced %q could not be removed: %s\n", existing.Name, err)
+		}
+	}
+	fmt.Fprintf(out, "%d repositories imported, %d skipped, %d conflicts\n", imported, skipped, conflicts)
+	return nil
+}
+
+// sameImportedEntry returns true if the existing entry has the configuration
+// of the Helm entry e, wherever its credentials are kept
+func sameImportedEntry(existing, e *repo.Entry) bool {
+	if existing.CredentialHelper == "" {
+		return existing.Entry == e.Entry
+	}
+	stripped := existing.Entry
+	stripped.Username = e.Username
+	stripped.Password = e.Password
+	return stripped == e.Entry && sameCredentials(existing, e)
+}
+
+// copyCachedIndex copies the cached index of the named repository from Helm's
+// cache. Indexes already in hypper's cache are only replaced when overwrite
+// is set.
+func (o *repoImportOptions) copyCachedIndex(name string, overwrite bool) error {
+	files := [][2]string{
+		{helmpath.CacheIndexFile(name), hypperpath.CacheIndexFile(name)},
+		{helmpath.CacheChartsFile(name), hypperpath.CacheChartsFile(name)},
+	}
+	for _, file := range files {
+		src := filepath.Join(o.helmRepoCache, file[0])
+		dst := filepath.Join(o.repoCache, file[1])
+		if _, err := os.Stat(dst); err == nil && !overwrite {
+			continue
+		}
+		b, err := ioutil.ReadFile(src)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(o.repoCache, 0755); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(dst, b, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func envOr(name, def string) string {
+	if v, ok := os.LookupEnv(name); ok {
+		return v
+	}
+	return def
+}
@@ -0,0 +1,173 @@
+/*
+Copyright SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	helmRepo "helm.sh/helm/v3/pkg/repo"
+
+	"github.com/rancher-sandbox/hypper/internal/test/ensure"
+	"github.com/rancher-sandbox/hypper/pkg/credentials"
+	"github.com/rancher-sandbox/hypper/pkg/hypperpath"
+	"github.com/rancher-sandbox/hypper/pkg/repo"
+)
+
+func TestRepoImportFromHelm(t *testing.T) {
+	defer resetEnv()()
+
+	helmDir := ensure.TempDir(t)
+	hypperDir := ensure.TempDir(t)
+	os.Setenv("HYPPER_CREDENTIALS_FILE", filepath.Join(hypperDir, "credentials.enc"))
+	os.Setenv("HYPPER_CREDENTIALS_PASSPHRASE", "passphrase")
+
+	helmFile := helmRepo.NewFile()
+	helmFile.Add(
+		&helmRepo.Entry{Name: "private", URL: "https://private.example.com", Username: "user", Password: "s3cr3t"},
+		&helmRepo.Entry{Name: "same", URL: "https://same.example.com"},
+		&helmRepo.Entry{Name: "conflict", URL: "https://helm.example.com"},
+		&helmRepo.Entry{Name: "signed", URL: "https://helm.example.com/signed"},
+	)
+	if err := helmFile.WriteFile(filepath.Join(helmDir, "repositories.yaml"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"private", "same", "signed"} {
+		if err := ioutil.WriteFile(filepath.Join(helmDir, name+"-index.yaml"), []byte("apiVersion: v1\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	conflict := &repo.Entry{Entry: helmRepo.Entry{Name: "conflict", URL: "https://hypper.example.com", Username: "old", Password: "pass"}, Priority: 5}
+	if err := conflict.StoreCredentials(credentials.DefaultHelper); err != nil {
+		t.Fatal(err)
+	}
+	f := repo.NewFile()
+	f.Add(
+		&repo.Entry{Entry: helmRepo.Entry{Name: "same", URL: "https://same.example.com"}, Priority: 10},
+		conflict,
+		&repo.Entry{Entry: helmRepo.Entry{Name: "signed", URL: "https://hypper.example.com/signed"}, Verify: true, Keyring: "pubring.gpg"},
+	)
+	repoFile := filepath.Join(hypperDir, "repositories.yaml")
+	if err := f.WriteFile(repoFile, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	o := &repoImportOptions{
+		helmRepoFile:     filepath.Join(helmDir, "repositories.yaml"),
+		helmRepoCache:    helmDir,
+		credentialHelper: credentials.DefaultHelper,
+		repoFile:         repoFile,
+		repoCache:        hypperDir,
+	}
+	if err := o.run(ioutil.Discard); err == nil {
+		t.Error("expected an error without --from-helm")
+	}
+
+	o.fromHelm = true
+	b := bytes.NewBuffer(nil)
+	if err := o.run(b); err != nil {
+		t.Fatal(err)
+	}
+	expected := `"private" has been imported from Helm
+"same" already exists with the same configuration, skipping
+"conflict" conflicts with an existing repository with a different configuration, skipping (use --force-update to replace it)
+"signed" conflicts with an existing repository with a different configuration, skipping (use --force-update to replace it)
+1 repositories imported, 1 skipped, 2 conflicts
+`
+	if b.String() != expected {
+		t.Errorf("expected output:\n%s\ngot:\n%s", expected, b.String())
+	}
+
+	f, err := repo.LoadFile(repoFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	private := f.Get("private")
+	if private == nil || private.Password != "" || private.CredentialHelper != credentials.DefaultHelper {
+		t.Errorf("expected the credentials of private to be in the credential helper, got %#v", private)
+	}
+	if username, password, err := private.Credentials(); err != nil || username != "user" || password != "s3cr3t" {
+		t.Errorf("unexpected credentials %q %q: %v", username, password, err)
+	}
+	if f.Get("conflict").URL != "https://hypper.example.com" {
+		t.Error("expected the conflicting repository to be left untouched")
+	}
+	for _, name := range []string{"private", "same"} {
+		if _, err := os.Stat(filepath.Join(hypperDir, hypperpath.CacheIndexFile(name))); err != nil {
+			t.Errorf("expected the cached index of %s to be copied: %s", name, err)
+		}
+	}
+
+	// importing again only reports duplicates and conflicts
+	b.Reset()
+	if err := o.run(b); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasSuffix(b.Bytes(), []byte("0 repositories imported, 2 skipped, 2 conflicts\n")) {
+		t.Errorf("unexpected output: %s", b.String())
+	}
+
+	o.forceUpdate = true
+	b.Reset()
+	if err := o.run(b); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(b.String(), `"signed" conflicts with an existing repository requiring a signed index`) {
+		t.Errorf("expected the repository requiring a signed index to be reported, got %s", b.String())
+	}
+	f, err = repo.LoadFile(repoFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replaced := f.Get("conflict"); replaced.URL != "https://helm.example.com" || replaced.Priority != 5 {
+		t.Errorf("expected the conflicting repository to be replaced, keeping its priority, got %#v", replaced)
+	}
+	if _, _, err := conflict.Credentials(); errors.Cause(err) != credentials.ErrCredentialsNotFound {
+		t.Errorf("expected the credentials of the replaced repository to be removed, got %v", err)
+	}
+	if signed := f.Get("signed"); signed.URL != "https://hypper.example.com/signed" || !signed.Verify {
+		t.Errorf("expected the repository requiring a signed index to be left untouched, got %#v", signed)
+	}
+	if _, err := os.Stat(filepath.Join(hypperDir, hypperpath.CacheIndexFile("signed"))); !os.IsNotExist(err) {
+		t.Errorf("expected the unverified index of Helm not to be copied for signed: %v", err)
+	}
+}
+
+func TestRepoImportBrokenHelmFile(t *testing.T) {
+	helmDir := ensure.TempDir(t)
+	helmRepoFile := filepath.Join(helmDir, "repositories.yaml")
+	if err := ioutil.WriteFile(helmRepoFile, []byte("repositories: [\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	o := &repoImportOptions{
+		fromHelm:      true,
+		helmRepoFile:  helmRepoFile,
+		helmRepoCache: helmDir,
+		repoFile:      filepath.Join(helmDir, "hypper.yaml"),
+		repoCache:     helmDir,
+	}
+	err := o.run(ioutil.Discard)
+	if err == nil || !strings.Contains(err.Error(), "failed loading Helm's") {
+		t.Errorf("expected an error loading Helm's repositories file, got %v", err)
+	}
+}
@@ -17,15 +17,21 @@ limitations under the License.
 package main
 
 import (
+	"bufio"
+	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"syscall"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
+	"golang.org/x/term"
 
 	"github.com/rancher-sandbox/hypper/pkg/repo"
 	"helm.sh/helm/v3/cmd/helm/require"
+	"helm.sh/helm/v3/pkg/provenance"
 )
 
 const repoIndexDesc = `
@@ -37,12 +43,51 @@ set an absolute URL to the charts, use '--url' flag.
 To merge the generated index with an existing index file, use the '--merge'
 flag. In this case, the charts found in the current directory will be merged
 into the existing index, with local charts taking priority over existing charts.
+
+Archives that have not changed since the index passed to '--merge' was generated
+are not loaded again; their existing entries are reused. For unchanged archives
+to be detected between runs regardless of '--merge', use '--index-cache' to keep
+a cache of the archives keyed by their size and modification time.
+
+Charts are searched for in all the subdirectories of DIR. Use '--include' and
+'--exclude' to select them with glob patterns; patterns without a slash match
+file and directory names, otherwise they match paths relative to DIR. Archives
+that cannot be loaded as charts are reported and left out of the index.
+
+Archives are loaded in parallel, as many at a time as set by '--jobs'. The
+generated index is the same regardless of the number of jobs.
+
+To keep the index small, entries can be pruned from the generated or merged
+index: '--keep-versions' keeps only the most recent versions of each chart,
+'--drop-prerelease-older-than' drops prerelease versions created longer ago
+than the given duration (e.g: 720h), and '--drop-deprecated' drops deprecated
+versions. The pruned versions are reported; their archives are left in DIR.
+Entries are created at the modification time of their archives, and keep the
+creation time of the index passed to '--merge' while their archives do not
+change.
+
+To sign the generated index, use the '--sign' flag together with '--key' and
+'--keyring'. A detached, armored signature is written next to the index as
+'index.yaml.asc'. Repositories added with 'hypper repo add --verify' require it.
 `
 
 type repoIndexOptions struct {
-	dir   string
-	url   string
-	merge string
+	dir        string
+	url        string
+	merge      string
+	indexCache string
+	include    []string
+	exclude    []string
+	jobs       int
+
+	keepVersions            int
+	dropPrereleaseOlderThan time.Duration
+	dropDeprecated          bool
+
+	sign           bool
+	key            string
+	keyring        string
+	passphraseFile string
 }
 
 func newRepoIndexCmd(out io.Writer) *cobra.Command {
@@ -63,6 +108,9 @@ func newRepoIndexCmd(out io.Writer) *cobra.Command {
 		},
 		RunE: func(cmd *cobra.Command, args []string) error {
 			o.dir = args[0]
+			if o.sign && o.key == "" {
+				return errors.New("--key is required for signing an index")
+			}
 			return o.run(out)
 		},
 	}
@@ -70,6 +118,17 @@ func newRepoIndexCmd(out io.Writer) *cobra.Command {
 	f := cmd.Flags()
 	f.StringVar(&o.url, "url", "", "url of chart repository")
 	f.StringVar(&o.merge, "merge", "", "merge the generated index into the given index")
+	f.StringVar(&o.indexCache, "index-cache", "", "path to a cache file used to skip loading unchanged archives")
+	f.StringArrayVar(&o.include, "include", []string{}, "only index archives matching this glob pattern (can be repeated)")
+	f.StringArrayVar(&o.exclude, "exclude", []string{}, "skip archives and directories matching this glob pattern (can be repeated)")
+	f.IntVar(&o.jobs, "jobs", 0, "number of archives loaded in parallel; defaults to the number of CPUs")
+	f.IntVar(&o.keepVersions, "keep-versions", 0, "keep only this number of the most recent versions of each chart; all of them when 0")
+	f.DurationVar(&o.dropPrereleaseOlderThan, "drop-prerelease-older-than", 0, "drop the prerelease versions created longer ago than this duration")
+	f.BoolVar(&o.dropDeprecated, "drop-deprecated", false, "drop the deprecated chart versions")
+	f.BoolVar(&o.sign, "sign", false, "use a PGP private key to sign the generated index")
+	f.StringVar(&o.key, "key", "", "name of the key to use when signing. Used if --sign is true")
+	f.StringVar(&o.keyring, "keyring", defaultKeyring(), "location of the keyring holding the signing key. Used if --sign is true")
+	f.StringVar(&o.passphraseFile, "passphrase-file", "", `location of a file which contains the passphrase for the signing key. Use "-" in order to read from stdin.`)
 
 	return cmd
 }
@@ -80,19 +139,89 @@ func (i *repoIndexOptions) run(out io.Writer) error {
 		return err
 	}
 
-	return index(path, i.url, i.merge)
+	opts := repo.IndexOptions{
+		Include: i.include,
+		Exclude: i.exclude,
+		Jobs:    i.jobs,
+	}
+	prune := repo.PruneOptions{
+		KeepVersions:            i.keepVersions,
+		DropPrereleaseOlderThan: i.dropPrereleaseOlderThan,
+		DropDeprecated:          i.dropDeprecated,
+	}
+	if err := index(out, path, i.url, i.merge, i.indexCache, opts, prune); err != nil {
+		return err
+	}
+	if i.sign {
+		return i.signIndex(filepath.Join(path, "index.yaml"))
+	}
+	return nil
 }
 
-func index(dir, url, mergeTo string) error {
-	out := filepath.Join(dir, "index.yaml")
-
-	i, err := repo.IndexDirectory(dir, url)
+func (i *repoIndexOptions) signIndex(path string) error {
+	signer, err := provenance.NewFromKeyring(i.keyring, i.key)
 	if err != nil {
 		return err
 	}
+	var fetcher provenance.PassphraseFetcher = promptUser
+	if i.passphraseFile != "" {
+		fetcher, err = passphraseFileFetcher(i.passphraseFile, os.Stdin)
+		if err != nil {
+			return err
+		}
+	}
+	if err := signer.DecryptKey(fetcher); err != nil {
+		return err
+	}
+	return repo.SignIndexFile(path, signer)
+}
+
+func promptUser(name string) ([]byte, error) {
+	fmt.Printf("Password for key %q >  ", name)
+	// syscall.Stdin is not an int in all environments and needs to be coerced
+	// into one there (e.g., Windows)
+	pw, err := term.ReadPassword(int(syscall.Stdin))
+	fmt.Println()
+	return pw, err
+}
+
+func passphraseFileFetcher(passphraseFile string, stdin *os.File) (provenance.PassphraseFetcher, error) {
+	file, err := openPassphraseFile(passphraseFile, stdin)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	passphrase, _, err := reader.ReadLine()
+	if err != nil {
+		return nil, err
+	}
+	return func(name string) ([]byte, error) {
+		return passphrase, nil
+	}, nil
+}
+
+func openPassphraseFile(passphraseFile string, stdin *os.File) (*os.File, error) {
+	if passphraseFile == "-" {
+		stat, err := stdin.Stat()
+		if err != nil {
+			return nil, err
+		}
+		if (stat.Mode() & os.ModeNamedPipe) == 0 {
+			return nil, errors.New("specified reading passphrase from stdin, without input on stdin")
+		}
+		return stdin, nil
+	}
+	return os.Open(passphraseFile)
+}
+
+func index(w io.Writer, dir, url, mergeTo, cacheFile string, opts repo.IndexOptions, prune repo.PruneOptions) error {
+	out := filepath.Join(dir, "index.yaml")
+
+	var i2 *repo.IndexFile
 	if mergeTo != "" {
 		// if index.yaml is missing then create an empty one to merge into
-		var i2 *repo.IndexFile
 		if _, err := os.Stat(mergeTo); os.IsNotExist(err) {
 			i2 = repo.NewIndexFile()
 			err = i2.WriteFile(mergeTo, 0644)
@@ -105,8 +234,33 @@ func index(dir, url, mergeTo string) error {
 				return errors.Wrap(err, "merge failed")
 			}
 		}
+		opts.Previous = i2
+	}
+	if cacheFile != "" {
+		c, err := repo.LoadIndexCache(cacheFile)
+		if err != nil {
+			return err
+		}
+		opts.Cache = c
+	}
+
+	i, report, err := repo.IndexDirectoryWithOptions(dir, url, opts)
+	if err != nil {
+		return err
+	}
+	for _, s := range report.Skipped {
+		fmt.Fprintf(w, "Skipping %s, not a valid chart: %s\n", s.Path, s.Err)
+	}
+	if i2 != nil {
 		i.Merge(i2)
 	}
-	i.SortEntries()
+	if opts.Cache != nil {
+		if err := opts.Cache.WriteFile(cacheFile, 0644); err != nil {
+			return errors.Wrap(err, "failed writing index cache")
+		}
+	}
+	for _, p := range i.Prune(prune) {
+		fmt.Fprintf(w, "Pruned %s %s: %s\n", p.Name, p.Version, p.Reason)
+	}
 	return i.WriteFile(out, 0644)
 }
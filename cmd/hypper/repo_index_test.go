@@ -19,9 +19,16 @@ package main
 import (
 	"bytes"
 	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
+
+	"golang.org/x/crypto/openpgp"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
 
 	"github.com/rancher-sandbox/hypper/internal/test/ensure"
 	"github.com/rancher-sandbox/hypper/pkg/repo"
@@ -146,6 +153,236 @@ func TestRepoIndexCmd(t *testing.T) {
 	}
 }
 
+func TestRepoIndexCmdIndexCache(t *testing.T) {
+	dir := ensure.TempDir(t)
+	defer os.RemoveAll(dir)
+
+	if err := linkOrCopy("testdata/testcharts/vanilla-helm-compressedchart-0.1.0.tgz", filepath.Join(dir, "vanilla-helm-compressedchart-0.1.0.tgz")); err != nil {
+		t.Fatal(err)
+	}
+	cacheFile := filepath.Join(dir, ".index-cache.json")
+
+	buf := bytes.NewBuffer(nil)
+	c := newRepoIndexCmd(buf)
+	if err := c.ParseFlags([]string{"--index-cache", cacheFile}); err != nil {
+		t.Fatal(err)
+	}
+	for run := 0; run < 2; run++ {
+		if err := c.RunE(c, []string{dir}); err != nil {
+			t.Fatal(err)
+		}
+		cache, err := repo.LoadIndexCache(cacheFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(cache.Entries) != 1 {
+			t.Errorf("expected 1 cache entry, got %d", len(cache.Entries))
+		}
+		index, err := repo.LoadIndexFile(filepath.Join(dir, "index.yaml"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(index.Entries["compressedchart"]) != 1 {
+			t.Errorf("expected 1 version, got %#v", index.Entries)
+		}
+	}
+}
+
+func TestRepoIndexCmdRecursive(t *testing.T) {
+	dir := ensure.TempDir(t)
+	defer os.RemoveAll(dir)
+
+	nested := filepath.Join(dir, "stable", "compressedchart")
+	if err := os.MkdirAll(nested, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := linkOrCopy("testdata/testcharts/vanilla-helm-compressedchart-0.1.0.tgz", filepath.Join(nested, "vanilla-helm-compressedchart-0.1.0.tgz")); err != nil {
+		t.Fatal(err)
+	}
+	if err := linkOrCopy("testdata/testcharts/vanilla-helm-reqtest-0.1.0.tgz", filepath.Join(nested, "vanilla-helm-reqtest-0.1.0.tgz")); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(nested, "broken.tgz"), []byte("not a chart"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := bytes.NewBuffer(nil)
+	c := newRepoIndexCmd(buf)
+	if err := c.ParseFlags([]string{"--exclude", "*reqtest*", "--jobs", "2"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.RunE(c, []string{dir}); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(buf.String(), "Skipping stable/compressedchart/broken.tgz") {
+		t.Errorf("expected the broken archive to be reported, got %q", buf.String())
+	}
+
+	index, err := repo.LoadIndexFile(filepath.Join(dir, "index.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(index.Entries) != 1 || len(index.Entries["compressedchart"]) != 1 {
+		t.Errorf("expected only compressedchart to be indexed, got %#v", index.Entries)
+	}
+}
+
+func TestRepoIndexCmdPrune(t *testing.T) {
+	dir := ensure.TempDir(t)
+	defer os.RemoveAll(dir)
+
+	for _, v := range []string{"0.1.0", "0.2.0", "0.3.0"} {
+		fname := "vanilla-helm-compressedchart-" + v + ".tgz"
+		if err := linkOrCopy(filepath.Join("testdata/testcharts", fname), filepath.Join(dir, fname)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	buf := bytes.NewBuffer(nil)
+	c := newRepoIndexCmd(buf)
+	if err := c.ParseFlags([]string{"--keep-versions", "1", "--drop-prerelease-older-than", "720h", "--drop-deprecated"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.RunE(c, []string{dir}); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "Pruned compressedchart 0.1.0: more than 1 newer versions\n" +
+		"Pruned compressedchart 0.2.0: more than 1 newer versions\n"
+	if buf.String() != expected {
+		t.Errorf("expected output %q, got %q", expected, buf.String())
+	}
+
+	index, err := repo.LoadIndexFile(filepath.Join(dir, "index.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cvs := index.Entries["compressedchart"]; len(cvs) != 1 || cvs[0].Version != "0.3.0" {
+		t.Errorf("expected only the latest version to be kept, got %#v", cvs)
+	}
+}
+
+func TestRepoIndexCmdPrunePrereleases(t *testing.T) {
+	dir := ensure.TempDir(t)
+	defer os.RemoveAll(dir)
+
+	month := time.Now().Add(-30 * 24 * time.Hour)
+	for v, mtime := range map[string]time.Time{"0.4.0-rc.1": month, "0.5.0-rc.1": time.Now()} {
+		p, err := chartutil.Save(&chart.Chart{
+			Metadata: &chart.Metadata{APIVersion: chart.APIVersionV2, Name: "prerelease", Version: v},
+		}, dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(p, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the age of the archives is kept in the index
+	c := newRepoIndexCmd(ioutil.Discard)
+	if err := c.RunE(c, []string{dir}); err != nil {
+		t.Fatal(err)
+	}
+	indexFile := filepath.Join(dir, "index.yaml")
+	index, err := repo.LoadIndexFile(indexFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cv, err := index.Get("prerelease", "0.4.0-rc.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := cv.Created.Sub(month); d < -time.Second || d > time.Second {
+		t.Errorf("expected the entry to be created when the archive was, %s, got %s", month, cv.Created)
+	}
+
+	// and the old prereleases are dropped, even when the entries are reused
+	buf := bytes.NewBuffer(nil)
+	c = newRepoIndexCmd(buf)
+	if err := c.ParseFlags([]string{"--merge", indexFile, "--drop-prerelease-older-than", "168h"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.RunE(c, []string{dir}); err != nil {
+		t.Fatal(err)
+	}
+	expected := "Pruned prerelease 0.4.0-rc.1: prerelease older than 168h0m0s\n"
+	if buf.String() != expected {
+		t.Errorf("expected output %q, got %q", expected, buf.String())
+	}
+	index, err = repo.LoadIndexFile(indexFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cvs := index.Entries["prerelease"]; len(cvs) != 1 || cvs[0].Version != "0.5.0-rc.1" {
+		t.Errorf("expected only the recent prerelease to be kept, got %#v", cvs)
+	}
+}
+
+func TestRepoIndexCmdSign(t *testing.T) {
+	dir := ensure.TempDir(t)
+	secret, public := writeTestKeyrings(t, ensure.TempDir(t))
+
+	if err := linkOrCopy("testdata/testcharts/vanilla-helm-compressedchart-0.1.0.tgz", filepath.Join(dir, "vanilla-helm-compressedchart-0.1.0.tgz")); err != nil {
+		t.Fatal(err)
+	}
+
+	c := newRepoIndexCmd(ioutil.Discard)
+	if err := c.ParseFlags([]string{"--sign", "--keyring", secret}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.RunE(c, []string{dir}); err == nil {
+		t.Error("expected an error signing without --key")
+	}
+
+	c = newRepoIndexCmd(ioutil.Discard)
+	if err := c.ParseFlags([]string{"--sign", "--key", "hypper-test", "--keyring", secret}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.RunE(c, []string{dir}); err != nil {
+		t.Fatal(err)
+	}
+
+	index, err := ioutil.ReadFile(filepath.Join(dir, "index.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := ioutil.ReadFile(filepath.Join(dir, "index.yaml"+repo.IndexSignatureExt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.VerifyIndex(index, sig, public); err != nil {
+		t.Error(err)
+	}
+}
+
+// writeTestKeyrings creates a new "hypper-test" key and writes its secret and
+// public keyrings into dir, returning their paths.
+func writeTestKeyrings(t *testing.T, dir string) (string, string) {
+	t.Helper()
+	e, err := openpgp.NewEntity("hypper-test", "", "hypper-test@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := filepath.Join(dir, "hypper-test.secret")
+	public := filepath.Join(dir, "hypper-test.pub")
+	var sb, pb bytes.Buffer
+	if err := e.SerializePrivate(&sb, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Serialize(&pb); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(secret, sb.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(public, pb.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return secret, public
+}
+
 func linkOrCopy(old, new string) error {
 	if err := os.Link(old, new); err != nil {
 		return copyFile(old, new)
@@ -26,7 +26,6 @@ import (
 	"github.com/rancher-sandbox/hypper/pkg/repo"
 	"helm.sh/helm/v3/cmd/helm/require"
 	"helm.sh/helm/v3/pkg/cli/output"
-	helmRepo "helm.sh/helm/v3/pkg/repo"
 )
 
 func newRepoListCmd(out io.Writer) *cobra.Command {
@@ -52,19 +51,21 @@ func newRepoListCmd(out io.Writer) *cobra.Command {
 }
 
 type repositoryElement struct {
-	Name string `json:"name"`
-	URL  string `json:"url"`
+	Name     string `json:"name"`
+	URL      string `json:"url"`
+	Priority int    `json:"priority"`
+	Enabled  bool   `json:"enabled"`
 }
 
 type repoListWriter struct {
-	repos []*helmRepo.Entry
+	repos []*repo.Entry
 }
 
 func (r *repoListWriter) WriteTable(out io.Writer) error {
 	table := uitable.New()
-	table.AddRow("NAME", "URL")
+	table.AddRow("NAME", "URL", "PRIORITY", "ENABLED")
 	for _, re := range r.repos {
-		table.AddRow(re.Name, re.URL)
+		table.AddRow(re.Name, re.URL, re.Priority, re.IsEnabled())
 	}
 	return output.EncodeTable(out, table)
 }
@@ -82,7 +83,12 @@ func (r *repoListWriter) encodeByFormat(out io.Writer, format output.Format) err
 	repolist := make([]repositoryElement, 0, len(r.repos))
 
 	for _, re := range r.repos {
-		repolist = append(repolist, repositoryElement{Name: re.Name, URL: re.URL})
+		repolist = append(repolist, repositoryElement{
+			Name:     re.Name,
+			URL:      re.URL,
+			Priority: re.Priority,
+			Enabled:  re.IsEnabled(),
+		})
 	}
 
 	switch format {
@@ -0,0 +1,140 @@
+/*
+Copyright SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"helm.sh/helm/v3/pkg/getter"
+
+	"github.com/rancher-sandbox/hypper/cmd/hypper/require"
+	"github.com/rancher-sandbox/hypper/pkg/repo"
+)
+
+const repoMirrorDesc = `
+Download the charts of a configured repository into a local directory, and
+generate an index for it, so it can be served from inside disconnected
+environments.
+
+All the charts are mirrored, unless restricted by name with '--chart' and by
+version with a semver range with '--version':
+
+	$ hypper repo mirror myrepo ./mirror --chart mariadb --version '^9.0.0' \
+		--url https://charts.internal.example.com
+
+The digest of every archive is checked against the index of the repository.
+Archives already in the directory with the right digest are not downloaded
+again. The index of the mirror is written to DIR/index.yaml, with the URL of
+the charts based on '--url'.
+`
+
+type repoMirrorOptions struct {
+	name    string
+	dir     string
+	charts  []string
+	version string
+	url     string
+
+	repoFile string
+}
+
+func newRepoMirrorCmd(out io.Writer) *cobra.Command {
+	o := &repoMirrorOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "mirror [REPO] [DIR]",
+		Short: "download the charts of a repository into a local directory",
+		Long:  repoMirrorDesc,
+		Args:  require.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			o.name = args[0]
+			o.dir = args[1]
+			o.repoFile = settings.RepositoryConfig
+			return o.run(out)
+		},
+	}
+
+	f := cmd.Flags()
+	f.StringArrayVar(&o.charts, "chart", []string{}, "only mirror the chart with this name (can be repeated)")
+	f.StringVar(&o.version, "version", "", "only mirror the versions matching this semver range")
+	f.StringVar(&o.url, "url", "", "url the mirror is served from")
+
+	return cmd
+}
+
+func (o *repoMirrorOptions) run(out io.Writer) error {
+	f, err := repo.LoadFile(o.repoFile)
+	switch {
+	case isNotExist(err):
+		return errors.New("no repositories configured")
+	case err != nil:
+		return errors.Wrapf(err, "failed loading file: %s", o.repoFile)
+	case len(f.Repositories) == 0:
+		return errors.New("no repositories configured")
+	}
+	if !f.Has(o.name) {
+		return errors.Errorf("no repo named %q found", o.name)
+	}
+
+	r, err := repo.NewChartRepositoryFromEntry(f.Get(o.name), getter.All(settings.EnvSettings))
+	if err != nil {
+		return err
+	}
+	// Fetch a fresh index without touching the repository cache
+	cache, err := ioutil.TempDir("", "hypper-mirror-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(cache)
+	r.CachePath = cache
+	fname, err := r.DownloadIndexFile()
+	if err != nil {
+		return errors.Wrapf(err, "failed fetching the index of %q", o.name)
+	}
+	index, err := repo.LoadIndexFile(fname)
+	if err != nil {
+		return err
+	}
+
+	dir, err := filepath.Abs(o.dir)
+	if err != nil {
+		return err
+	}
+	mirror, report, err := r.Mirror(index, dir, repo.MirrorOptions{
+		Charts:  o.charts,
+		Version: o.version,
+		URL:     o.url,
+	})
+	if err != nil {
+		return err
+	}
+	if err := mirror.WriteFile(filepath.Join(dir, "index.yaml"), 0644); err != nil {
+		return err
+	}
+
+	for _, a := range report.Unverified {
+		fmt.Fprintf(out, "WARNING: %s has no digest in the index of %q, it could not be verified\n", a, o.name)
+	}
+	fmt.Fprintf(out, "%d charts downloaded, %d already mirrored, into %s\n", len(report.Downloaded), len(report.Present), dir)
+	return nil
+}
@@ -0,0 +1,90 @@
+/*
+Copyright SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"helm.sh/helm/v3/pkg/repo/repotest"
+
+	"github.com/rancher-sandbox/hypper/internal/test/ensure"
+	"github.com/rancher-sandbox/hypper/pkg/repo"
+)
+
+func TestRepoMirror(t *testing.T) {
+	defer resetEnv()()
+
+	ts, err := repotest.NewTempServerWithCleanup(t, "testdata/testcharts/vanilla-helm-compressedchart-0.*.tgz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ts.Stop()
+
+	dir := filepath.Join(ensure.TempDir(t), "mirror")
+	o := &repoMirrorOptions{
+		name:     "test",
+		dir:      dir,
+		charts:   []string{"compressedchart"},
+		version:  ">=0.2.0",
+		url:      "https://charts.internal.example.com",
+		repoFile: filepath.Join(ts.Root(), "repositories.yaml"),
+	}
+	b := bytes.NewBuffer(nil)
+	if err := o.run(b); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(b.String(), "2 charts downloaded, 0 already mirrored") {
+		t.Errorf("Unexpected output: %s", b.String())
+	}
+
+	index, err := repo.LoadIndexFile(filepath.Join(dir, "index.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cvs := index.Entries["compressedchart"]
+	if len(cvs) != 2 || cvs[0].Version != "0.3.0" || cvs[1].Version != "0.2.0" {
+		t.Fatalf("expected versions 0.3.0 and 0.2.0 to be mirrored, got %#v", cvs)
+	}
+	if !strings.HasPrefix(cvs[0].URLs[0], "https://charts.internal.example.com/") {
+		t.Errorf("expected the mirror URL in the index, got %s", cvs[0].URLs[0])
+	}
+
+	o.name = "unknown"
+	if err := o.run(ioutil.Discard); err == nil {
+		t.Error("expected an error mirroring an unknown repository")
+	}
+}
+
+func TestRepoMirrorBrokenFile(t *testing.T) {
+	repoFile := filepath.Join(ensure.TempDir(t), "repositories.yaml")
+	if err := ioutil.WriteFile(repoFile, []byte("repositories:\n- name: test\n  url: [\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	o := &repoMirrorOptions{
+		name:     "test",
+		dir:      filepath.Join(ensure.TempDir(t), "mirror"),
+		repoFile: repoFile,
+	}
+	if err := o.run(ioutil.Discard); err == nil || !strings.Contains(err.Error(), "failed loading file") {
+		t.Errorf("expected an error loading the file, got %v", err)
+	}
+}
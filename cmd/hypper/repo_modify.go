@@ -0,0 +1,135 @@
+/*
+Copyright SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/rancher-sandbox/hypper/cmd/hypper/require"
+	"github.com/rancher-sandbox/hypper/pkg/repo"
+)
+
+const repoModifyDesc = `
+Modify the settings of one or more chart repositories.
+
+Repositories with a higher '--priority' are preferred when installing charts
+by name only, without a repository. Disabled repositories are neither updated
+nor used to install charts by name, until enabled again.
+
+Charts pinned to repositories with '--pin' are only installed by name from
+them, whatever the priority of the other repositories providing them.
+
+	$ hypper repo modify myrepo --priority 10
+	$ hypper repo modify myrepo --disable
+	$ hypper repo modify myrepo --pin rancher --pin fleet
+`
+
+type repoModifyOptions struct {
+	names    []string
+	repoFile string
+
+	priority *int
+	enabled  *bool
+	pin      []string
+	unpin    []string
+}
+
+func newRepoModifyCmd(out io.Writer) *cobra.Command {
+	o := &repoModifyOptions{}
+	var priority int
+	var enable, disable bool
+
+	cmd := &cobra.Command{
+		Use:     "modify [REPO1 [REPO2 ...]]",
+		Aliases: []string{"mod"},
+		Short:   "modify the settings of one or more chart repositories",
+		Long:    repoModifyDesc,
+		Args:    require.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if enable && disable {
+				return errors.New("--enable and --disable cannot be used together")
+			}
+			if cmd.Flags().Changed("priority") {
+				o.priority = &priority
+			}
+			if enable || disable {
+				o.enabled = &enable
+			}
+			if o.priority == nil && o.enabled == nil && len(o.pin) == 0 && len(o.unpin) == 0 {
+				return errors.New("nothing to modify, use --priority, --enable, --disable, --pin or --unpin")
+			}
+			o.repoFile = settings.RepositoryConfig
+			o.names = args
+			return o.run(out)
+		},
+	}
+
+	f := cmd.Flags()
+	f.IntVar(&priority, "priority", 0, "priority of the repository when installing charts by name; higher priorities are preferred")
+	f.BoolVar(&enable, "enable", false, "enable the repository")
+	f.BoolVar(&disable, "disable", false, "disable the repository")
+	f.StringArrayVar(&o.pin, "pin", []string{}, "pin the chart with this name to the repository (can be repeated)")
+	f.StringArrayVar(&o.unpin, "unpin", []string{}, "unpin the chart with this name from the repository (can be repeated)")
+
+	return cmd
+}
+
+func (o *repoModifyOptions) run(out io.Writer) error {
+	r, err := repo.LoadFile(o.repoFile)
+	switch {
+	case isNotExist(err):
+		return errors.New("no repositories configured")
+	case err != nil:
+		return errors.Wrapf(err, "failed loading file: %s", o.repoFile)
+	case len(r.Repositories) == 0:
+		return errors.New("no repositories configured")
+	}
+
+	for _, name := range o.names {
+		if !r.Has(name) {
+			return errors.Errorf("no repo named %q found", name)
+		}
+	}
+
+	for _, name := range o.names {
+		e := r.Get(name)
+		if o.priority != nil {
+			e.Priority = *o.priority
+		}
+		if o.enabled != nil {
+			e.SetEnabled(*o.enabled)
+		}
+		for _, chart := range o.unpin {
+			e.Unpin(chart)
+		}
+		for _, chart := range o.pin {
+			e.Pin(chart)
+		}
+	}
+	if err := r.WriteFile(o.repoFile, 0644); err != nil {
+		return err
+	}
+
+	for _, name := range o.names {
+		fmt.Fprintf(out, "%q has been modified\n", name)
+	}
+	return nil
+}
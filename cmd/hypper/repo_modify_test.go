@@ -0,0 +1,165 @@
+/*
+Copyright SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/rancher-sandbox/hypper/internal/test/ensure"
+	"github.com/rancher-sandbox/hypper/pkg/repo"
+	helmRepo "helm.sh/helm/v3/pkg/repo"
+)
+
+func TestRepoModify(t *testing.T) {
+	repoFile := filepath.Join(ensure.TempDir(t), "repositories.yaml")
+	f := repo.NewFile()
+	f.Add(
+		&repo.Entry{Entry: helmRepo.Entry{Name: "one", URL: "https://one.example.com"}},
+		&repo.Entry{Entry: helmRepo.Entry{Name: "two", URL: "https://two.example.com"}},
+	)
+	if err := f.WriteFile(repoFile, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	load := func() *repo.File {
+		t.Helper()
+		f, err := repo.LoadFile(repoFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return f
+	}
+
+	priority := 10
+	disabled := false
+	o := &repoModifyOptions{
+		names:    []string{"one"},
+		repoFile: repoFile,
+		priority: &priority,
+		enabled:  &disabled,
+	}
+	b := bytes.NewBuffer(nil)
+	if err := o.run(b); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(b.String(), `"one" has been modified`) {
+		t.Errorf("Unexpected output: %s", b.String())
+	}
+	f = load()
+	if one := f.Get("one"); one.Priority != 10 || one.IsEnabled() {
+		t.Errorf("expected one to have priority 10 and be disabled, got %#v", one)
+	}
+	if two := f.Get("two"); two.Priority != 0 || !two.IsEnabled() {
+		t.Errorf("expected two to be left alone, got %#v", two)
+	}
+
+	// only the given settings are modified
+	enabled := true
+	o = &repoModifyOptions{
+		names:    []string{"one"},
+		repoFile: repoFile,
+		enabled:  &enabled,
+	}
+	if err := o.run(ioutil.Discard); err != nil {
+		t.Fatal(err)
+	}
+	if one := load().Get("one"); one.Priority != 10 || !one.IsEnabled() {
+		t.Errorf("expected one to keep priority 10 and be enabled, got %#v", one)
+	}
+
+	// charts are pinned and unpinned
+	o = &repoModifyOptions{
+		names:    []string{"one", "two"},
+		repoFile: repoFile,
+		pin:      []string{"rancher", "fleet"},
+	}
+	if err := o.run(ioutil.Discard); err != nil {
+		t.Fatal(err)
+	}
+	o.pin = nil
+	o.unpin = []string{"rancher"}
+	o.names = []string{"two"}
+	if err := o.run(ioutil.Discard); err != nil {
+		t.Fatal(err)
+	}
+	f = load()
+	if one := f.Get("one"); !reflect.DeepEqual(one.Pinned, []string{"fleet", "rancher"}) || one.Priority != 10 {
+		t.Errorf("expected one to pin fleet and rancher, got %#v", one)
+	}
+	if two := f.Get("two"); !reflect.DeepEqual(two.Pinned, []string{"fleet"}) {
+		t.Errorf("expected two to pin fleet, got %#v", two)
+	}
+
+	o.names = []string{"two", "unknown"}
+	if err := o.run(ioutil.Discard); err == nil {
+		t.Error("expected an error modifying an unknown repository")
+	}
+}
+
+func TestRepoModifyCmdFlags(t *testing.T) {
+	defer resetEnv()()
+
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{"nothing to modify", []string{"one"}},
+		{"enable and disable", []string{"one", "--enable", "--disable"}},
+		{"no repository", []string{"--priority", "3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := newRepoModifyCmd(ioutil.Discard)
+			cmd.SetArgs(tt.args)
+			cmd.SetOut(ioutil.Discard)
+			cmd.SetErr(ioutil.Discard)
+			if err := cmd.Execute(); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestRepoModifyBrokenFile(t *testing.T) {
+	repoFile := filepath.Join(ensure.TempDir(t), "repositories.yaml")
+	broken := []byte("repositories:\n- name: one\n  url: [\n")
+	if err := ioutil.WriteFile(repoFile, broken, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	priority := 10
+	o := &repoModifyOptions{
+		names:    []string{"one"},
+		repoFile: repoFile,
+		priority: &priority,
+	}
+	if err := o.run(ioutil.Discard); err == nil || !strings.Contains(err.Error(), "failed loading file") {
+		t.Errorf("expected an error loading the file, got %v", err)
+	}
+	b, err := ioutil.ReadFile(repoFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, broken) {
+		t.Errorf("expected the repositories file to be left untouched, got %s", b)
+	}
+}
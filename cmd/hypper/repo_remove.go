@@ -61,6 +61,7 @@ func (o *repoRemoveOptions) run(out io.Writer) error {
 	}
 
 	for _, name := range o.names {
+		entry := r.Get(name)
 		if !r.Remove(name) {
 			return errors.Errorf("no repo named %q found", name)
 		}
@@ -68,6 +69,10 @@ func (o *repoRemoveOptions) run(out io.Writer) error {
 			return err
 		}
 
+		if err := entry.EraseCredentials(); err != nil {
+			fmt.Fprintf(out, "WARNING: the credentials of %q could not be removed: %s\n", name, err)
+		}
+
 		if err := removeRepoCache(o.repoCache, name); err != nil {
 			return err
 		}
@@ -78,12 +83,14 @@ func (o *repoRemoveOptions) run(out io.Writer) error {
 }
 
 func removeRepoCache(root, name string) error {
-	idx := filepath.Join(root, hypperpath.CacheChartsFile(name))
-	if _, err := os.Stat(idx); err == nil {
-		os.Remove(idx)
+	for _, f := range []string{hypperpath.CacheChartsFile(name), hypperpath.CacheParsedIndexFile(name)} {
+		idx := filepath.Join(root, f)
+		if _, err := os.Stat(idx); err == nil {
+			os.Remove(idx)
+		}
 	}
 
-	idx = filepath.Join(root, hypperpath.CacheIndexFile(name))
+	idx := filepath.Join(root, hypperpath.CacheIndexFile(name))
 	if _, err := os.Stat(idx); os.IsNotExist(err) {
 		return nil
 	} else if err != nil {
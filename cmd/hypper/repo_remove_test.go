@@ -149,6 +149,9 @@ func createCacheFiles(rootDir string, repoName string) (cacheIndexFile string, c
 	mf, _ = os.Create(cacheChartsFile)
 	mf.Close()
 
+	mf, _ = os.Create(filepath.Join(rootDir, hypperpath.CacheParsedIndexFile(repoName)))
+	mf.Close()
+
 	return cacheIndexFile, cacheChartsFile
 }
 
@@ -159,4 +162,7 @@ func testCacheFiles(t *testing.T, cacheIndexFile string, cacheChartsFile string,
 	if _, err := os.Stat(cacheChartsFile); err == nil {
 		t.Errorf("Error cache chart file was not removed for repository %s", repoName)
 	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(cacheIndexFile), hypperpath.CacheParsedIndexFile(repoName))); err == nil {
+		t.Errorf("Error parsed index file was not removed for repository %s", repoName)
+	}
 }
@@ -19,45 +19,90 @@ package main
 import (
 	"fmt"
 	"io"
+	"io/ioutil"
+	"strings"
 	"sync"
+	"time"
 
+	"github.com/gosuri/uitable"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 
-	"github.com/rancher-sandbox/hypper/cmd/hypper/require"
 	"github.com/rancher-sandbox/hypper/pkg/eyecandy"
 	"github.com/rancher-sandbox/hypper/pkg/repo"
+	"helm.sh/helm/v3/pkg/cli/output"
 	"helm.sh/helm/v3/pkg/getter"
 )
 
 const updateDesc = `
 Update gets the latest information about charts from the respective chart repositories.
 Information is cached locally, where it is used by commands like 'hypper search'.
+
+You can optionally specify a list of repositories you want to update.
+	$ hypper repo update <repo_name> ...
+To update all the repositories, use 'hypper repo update'. Disabled repositories
+are not updated.
+
+By default, repositories that cannot be updated are reported but do not make
+the command fail. Use '--fail-on-error' to exit with an error in that case.
+
+The progress of the update is printed as it goes. With '--output table', a
+table of the updated repositories is printed once done, and with
+'--output json' or '--output yaml' that report is printed alone.
 `
 
 var errNoRepositories = errors.New("no repositories found. You must add one before updating")
 
 type repoUpdateOptions struct {
-	update    func([]*repo.ChartRepository, io.Writer)
-	repoFile  string
-	repoCache string
+	update      func([]*repo.ChartRepository, io.Writer, int) []*repoUpdateResult
+	repoFile    string
+	repoCache   string
+	names       []string
+	failOnError bool
+	parallel    int
+	outfmt      output.Format
+	// tableReport prints the table report after the progress, when the
+	// table output is asked for explicitly
+	tableReport bool
 }
 
+// repoUpdateResult is the outcome of updating a single repository
+type repoUpdateResult struct {
+	Name     string        `json:"name"`
+	URL      string        `json:"url"`
+	Status   string        `json:"status"`
+	Error    string        `json:"error,omitempty"`
+	Duration time.Duration `json:"-"`
+	Charts   int           `json:"charts"`
+}
+
+const (
+	repoUpdateSucceeded = "succeeded"
+	repoUpdateFailed    = "failed"
+)
+
 func newRepoUpdateCmd(out io.Writer) *cobra.Command {
 	o := &repoUpdateOptions{update: updateCharts}
 
 	cmd := &cobra.Command{
-		Use:     "update",
+		Use:     "update [REPO1 [REPO2 ...]]",
 		Aliases: []string{"up"},
 		Short:   "update information of available charts locally from chart repositories",
 		Long:    updateDesc,
-		Args:    require.NoArgs,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			o.repoFile = settings.RepositoryConfig
 			o.repoCache = settings.RepositoryCache
+			o.names = args
+			o.tableReport = cmd.Flags().Changed(outputFlag)
 			return o.run(out)
 		},
 	}
+
+	f := cmd.Flags()
+	f.BoolVar(&o.failOnError, "fail-on-error", false, "return an error if any of the repositories cannot be updated")
+	f.IntVar(&o.parallel, "parallel", 10, "maximum number of repositories fetched at the same time; 0 for no limit")
+	bindOutputFlag(cmd, &o.outfmt)
+
 	return cmd
 }
 
@@ -72,9 +117,21 @@ func (o *repoUpdateOptions) run(out io.Writer) error {
 		return errNoRepositories
 	}
 
+	for _, name := range o.names {
+		if !f.Has(name) {
+			return errors.Errorf("no repositories found matching '%s'. Nothing will be updated", name)
+		}
+		if !f.Get(name).IsEnabled() {
+			return errors.Errorf("repository '%s' is disabled. Nothing will be updated", name)
+		}
+	}
+
 	var repos []*repo.ChartRepository
 	for _, cfg := range f.Repositories {
-		r, err := repo.NewChartRepository(cfg, getter.All(settings.EnvSettings))
+		if !cfg.IsEnabled() || (len(o.names) > 0 && !isRepoRequested(cfg.Name, o.names)) {
+			continue
+		}
+		r, err := repo.NewChartRepositoryFromEntry(cfg, getter.All(settings.EnvSettings))
 		if err != nil {
 			return err
 		}
@@ -84,24 +141,138 @@ func (o *repoUpdateOptions) run(out io.Writer) error {
 		repos = append(repos, r)
 	}
 
-	o.update(repos, out)
+	// Progress is only shown for humans; structured output gets the report
+	// alone, while the table report is only printed after the progress when
+	// asked for.
+	progress := out
+	if o.outfmt == output.JSON || o.outfmt == output.YAML {
+		progress = ioutil.Discard
+	}
+	results := o.update(repos, progress, o.parallel)
+	if o.outfmt != output.Table || o.tableReport {
+		if err := o.outfmt.Write(out, &repoUpdateWriter{results}); err != nil {
+			return err
+		}
+	}
+
+	if o.failOnError {
+		var failed []string
+		for _, r := range results {
+			if r.Status == repoUpdateFailed {
+				failed = append(failed, r.Name)
+			}
+		}
+		if len(failed) > 0 {
+			return errors.Errorf("failed to update the following repositories: %s", strings.Join(failed, ", "))
+		}
+	}
 	return nil
 }
 
-func updateCharts(repos []*repo.ChartRepository, out io.Writer) {
+func isRepoRequested(name string, requested []string) bool {
+	for _, n := range requested {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// updateCharts downloads the indexes of repos, at most parallel at a time
+// (no limit if parallel < 1), and returns the results in the order of repos.
+func updateCharts(repos []*repo.ChartRepository, out io.Writer, parallel int) []*repoUpdateResult {
 	fmt.Fprintln(out, "Hang tight while we grab the latest from your chart repositories...")
+	if parallel < 1 {
+		parallel = len(repos)
+	}
+	results := make([]*repoUpdateResult, len(repos))
+	sem := make(chan struct{}, parallel)
+	var mu sync.Mutex
 	var wg sync.WaitGroup
-	for _, re := range repos {
+	for i, re := range repos {
 		wg.Add(1)
-		go func(re *repo.ChartRepository) {
+		go func(i int, re *repo.ChartRepository) {
 			defer wg.Done()
-			if _, err := re.DownloadIndexFile(); err != nil {
-				fmt.Fprintf(out, "...Unable to get an update from the %q chart repository (%s):\n\t%s\n", re.Config.Name, re.Config.URL, err)
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			res := updateRepo(re)
+			results[i] = res
+
+			mu.Lock()
+			defer mu.Unlock()
+			if res.Status == repoUpdateFailed {
+				fmt.Fprintf(out, "...Unable to get an update from the %q chart repository (%s):\n\t%s\n", re.Config.Name, re.Config.URL, res.Error)
 			} else {
 				fmt.Fprintf(out, "...Successfully got an update from the %q chart repository\n", re.Config.Name)
 			}
-		}(re)
+		}(i, re)
 	}
 	wg.Wait()
 	fmt.Fprintln(out, eyecandy.ESPrint(settings.NoEmojis, ":cruise_ship: Update Complete."))
+	return results
+}
+
+func updateRepo(re *repo.ChartRepository) *repoUpdateResult {
+	res := &repoUpdateResult{
+		Name:   re.Config.Name,
+		URL:    re.Config.URL,
+		Status: repoUpdateSucceeded,
+	}
+	start := time.Now()
+	defer func() { res.Duration = time.Since(start) }()
+
+	fname, err := re.DownloadIndexFile()
+	if err != nil {
+		res.Status = repoUpdateFailed
+		res.Error = err.Error()
+		return res
+	}
+	// Pre-parse the index, so charts are quickly looked up in it
+	index, err := repo.WriteParsedIndex(fname)
+	if err != nil {
+		res.Status = repoUpdateFailed
+		res.Error = err.Error()
+		return res
+	}
+	res.Charts = len(index.Names())
+	return res
+}
+
+type repoUpdateElement struct {
+	*repoUpdateResult
+	Duration string `json:"duration"`
+}
+
+type repoUpdateWriter struct {
+	results []*repoUpdateResult
+}
+
+func (w *repoUpdateWriter) WriteTable(out io.Writer) error {
+	table := uitable.New()
+	table.AddRow("NAME", "STATUS", "DURATION", "CHARTS")
+	for _, r := range w.results {
+		table.AddRow(r.Name, r.Status, r.Duration.Round(time.Millisecond), r.Charts)
+	}
+	return output.EncodeTable(out, table)
+}
+
+func (w *repoUpdateWriter) WriteJSON(out io.Writer) error {
+	return output.EncodeJSON(out, w.elements())
+}
+
+func (w *repoUpdateWriter) WriteYAML(out io.Writer) error {
+	return output.EncodeYAML(out, w.elements())
+}
+
+func (w *repoUpdateWriter) elements() []repoUpdateElement {
+	// Initialize the array so no results returns an empty array instead of null
+	elements := make([]repoUpdateElement, 0, len(w.results))
+	for _, r := range w.results {
+		elements = append(elements, repoUpdateElement{
+			repoUpdateResult: r,
+			Duration:         r.Duration.Round(time.Millisecond).String(),
+		})
+	}
+	return elements
 }
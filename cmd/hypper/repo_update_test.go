@@ -17,6 +17,7 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -27,6 +28,7 @@ import (
 
 	"github.com/rancher-sandbox/hypper/internal/test/ensure"
 	"github.com/rancher-sandbox/hypper/pkg/repo"
+	"helm.sh/helm/v3/pkg/cli/output"
 	"helm.sh/helm/v3/pkg/getter"
 	helmRepo "helm.sh/helm/v3/pkg/repo"
 	"helm.sh/helm/v3/pkg/repo/repotest"
@@ -36,12 +38,14 @@ func TestUpdateCmd(t *testing.T) {
 	var out bytes.Buffer
 	// Instead of using the HTTP updater, we provide our own for this test.
 	// The TestUpdateCharts test verifies the HTTP behavior independently.
-	updater := func(repos []*repo.ChartRepository, out io.Writer) {
+	updater := func(repos []*repo.ChartRepository, out io.Writer, parallel int) []*repoUpdateResult {
 		for _, re := range repos {
 			fmt.Fprintln(out, re.Config.Name)
 		}
+		return nil
 	}
 	o := &repoUpdateOptions{
+		outfmt:   output.Table,
 		update:   updater,
 		repoFile: "testdata/repositories.yaml",
 	}
@@ -54,6 +58,48 @@ func TestUpdateCmd(t *testing.T) {
 	}
 }
 
+func TestUpdateCmdTableReport(t *testing.T) {
+	updater := func(repos []*repo.ChartRepository, out io.Writer, parallel int) []*repoUpdateResult {
+		fmt.Fprintln(out, "Update Complete.")
+		results := make([]*repoUpdateResult, 0, len(repos))
+		for _, re := range repos {
+			results = append(results, &repoUpdateResult{Name: re.Config.Name, Status: repoUpdateSucceeded, Charts: 3})
+		}
+		return results
+	}
+	o := &repoUpdateOptions{
+		outfmt:   output.Table,
+		update:   updater,
+		repoFile: "testdata/repositories.yaml",
+	}
+	var out bytes.Buffer
+	if err := o.run(&out); err != nil {
+		t.Fatal(err)
+	}
+
+	// the table report is only printed when asked for
+	got := out.String()
+	if !strings.Contains(got, "Update Complete.") {
+		t.Errorf("expected the progress to be printed, got %q", got)
+	}
+	if strings.Contains(got, "STATUS") {
+		t.Errorf("expected no table report by default, got %q", got)
+	}
+
+	out.Reset()
+	o.tableReport = true
+	if err := o.run(&out); err != nil {
+		t.Fatal(err)
+	}
+	got = out.String()
+	if !strings.Contains(got, "Update Complete.") {
+		t.Errorf("expected the progress to be printed, got %q", got)
+	}
+	if !strings.Contains(got, "STATUS") || !strings.Contains(got, repoUpdateSucceeded) {
+		t.Errorf("expected the table report to be printed, got %q", got)
+	}
+}
+
 func TestUpdateCustomCacheCmd(t *testing.T) {
 	rootDir := ensure.TempDir(t)
 	cachePath := filepath.Join(rootDir, "updcustomcache")
@@ -70,6 +116,7 @@ func TestUpdateCustomCacheCmd(t *testing.T) {
 	defer ts.Stop()
 
 	o := &repoUpdateOptions{
+		outfmt:    output.Table,
 		update:    updateCharts,
 		repoFile:  filepath.Join(ts.Root(), "repositories.yaml"),
 		repoCache: cachePath,
@@ -81,6 +128,9 @@ func TestUpdateCustomCacheCmd(t *testing.T) {
 	if _, err := os.Stat(filepath.Join(cachePath, "test-index.yaml")); err != nil {
 		t.Fatalf("error finding created index file in custom cache: %v", err)
 	}
+	if _, err := os.Stat(filepath.Join(cachePath, "test-index.gob")); err != nil {
+		t.Fatalf("error finding parsed index file in custom cache: %v", err)
+	}
 }
 
 func TestUpdateCharts(t *testing.T) {
@@ -102,7 +152,7 @@ func TestUpdateCharts(t *testing.T) {
 	}
 
 	b := bytes.NewBuffer(nil)
-	updateCharts([]*repo.ChartRepository{r}, b)
+	results := updateCharts([]*repo.ChartRepository{r}, b, 1)
 
 	got := b.String()
 	if strings.Contains(got, "Unable to get an update") {
@@ -111,4 +161,155 @@ func TestUpdateCharts(t *testing.T) {
 	if !strings.Contains(got, "Update Complete.") {
 		t.Error("Update was not successful")
 	}
+	if len(results) != 1 || results[0].Status != repoUpdateSucceeded {
+		t.Errorf("unexpected update results: %#v", results[0])
+	}
+}
+
+// writeUpdateRepoFile writes a repositories file with a working repository
+// named "good", served by ts, and a repository named "bad" that cannot be
+// reached.
+func writeUpdateRepoFile(t *testing.T, ts *repotest.Server) string {
+	t.Helper()
+	f := repo.NewFile()
+	f.Update(
+		&repo.Entry{Entry: helmRepo.Entry{Name: "good", URL: ts.URL()}},
+		&repo.Entry{Entry: helmRepo.Entry{Name: "bad", URL: ts.URL() + "/missing"}},
+	)
+	repoFile := filepath.Join(ensure.TempDir(t), "repositories.yaml")
+	if err := f.WriteFile(repoFile, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return repoFile
+}
+
+func TestUpdateSelectedRepos(t *testing.T) {
+	ts, err := repotest.NewTempServerWithCleanup(t, "testdata/testserver/*.*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ts.Stop()
+
+	cachePath := ensure.TempDir(t)
+	o := &repoUpdateOptions{
+		outfmt:      output.Table,
+		update:      updateCharts,
+		repoFile:    writeUpdateRepoFile(t, ts),
+		repoCache:   cachePath,
+		names:       []string{"good"},
+		failOnError: true,
+	}
+	if err := o.run(ioutil.Discard); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(cachePath, "good-index.yaml")); err != nil {
+		t.Error(err)
+	}
+	if _, err := os.Stat(filepath.Join(cachePath, "bad-index.yaml")); !os.IsNotExist(err) {
+		t.Error("expected the not requested repository to be left alone")
+	}
+
+	// disabled repositories are not updated
+	f, err := repo.LoadFile(o.repoFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Get("good").SetEnabled(false)
+	if err := f.WriteFile(o.repoFile, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.run(ioutil.Discard); err == nil || !strings.Contains(err.Error(), "repository 'good' is disabled") {
+		t.Errorf("expected an error updating a disabled repository, got %v", err)
+	}
+	if err := os.Remove(filepath.Join(cachePath, "good-index.yaml")); err != nil {
+		t.Fatal(err)
+	}
+	o.names = nil
+	o.failOnError = false
+	if err := o.run(ioutil.Discard); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(cachePath, "good-index.yaml")); !os.IsNotExist(err) {
+		t.Error("expected the disabled repository to be skipped")
+	}
+
+	o.names = []string{"bad", "unknown"}
+	if err := o.run(ioutil.Discard); err == nil || !strings.Contains(err.Error(), "no repositories found matching 'unknown'") {
+		t.Errorf("expected an error for an unknown repository, got %v", err)
+	}
+}
+
+func TestUpdateFailOnError(t *testing.T) {
+	ts, err := repotest.NewTempServerWithCleanup(t, "testdata/testserver/*.*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ts.Stop()
+
+	o := &repoUpdateOptions{
+		outfmt:    output.Table,
+		update:    updateCharts,
+		repoFile:  writeUpdateRepoFile(t, ts),
+		repoCache: ensure.TempDir(t),
+		parallel:  1,
+	}
+	if err := o.run(ioutil.Discard); err != nil {
+		t.Errorf("expected failures to be ignored, got %s", err)
+	}
+
+	o.failOnError = true
+	err = o.run(ioutil.Discard)
+	if err == nil || !strings.Contains(err.Error(), "failed to update the following repositories: bad") {
+		t.Errorf("expected the bad repository to fail the update, got %v", err)
+	}
+}
+
+func TestUpdateJSONReport(t *testing.T) {
+	ts, err := repotest.NewTempServerWithCleanup(t, "testdata/testserver/*.*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ts.Stop()
+	if _, err := ts.CopyCharts("testdata/testcharts/vanilla-helm-compressedchart-0.1.0.tgz"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ts.CreateIndex(); err != nil {
+		t.Fatal(err)
+	}
+
+	o := &repoUpdateOptions{
+		update:    updateCharts,
+		repoFile:  writeUpdateRepoFile(t, ts),
+		repoCache: ensure.TempDir(t),
+		outfmt:    output.JSON,
+	}
+	var out bytes.Buffer
+	if err := o.run(&out); err != nil {
+		t.Fatal(err)
+	}
+
+	var report []map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &report); err != nil {
+		t.Fatalf("expected only the JSON report, got %q: %s", out.String(), err)
+	}
+	if len(report) != 2 {
+		t.Fatalf("expected 2 repositories in the report, got %d", len(report))
+	}
+	for _, r := range report {
+		switch r["name"] {
+		case "good":
+			if r["status"] != repoUpdateSucceeded || r["charts"].(float64) != 1 {
+				t.Errorf("unexpected report for good: %v", r)
+			}
+		case "bad":
+			if r["status"] != repoUpdateFailed || r["error"] == "" {
+				t.Errorf("unexpected report for bad: %v", r)
+			}
+		}
+		for _, field := range []string{"duration", "charts"} {
+			if _, ok := r[field]; !ok {
+				t.Errorf("expected %s in %v", field, r)
+			}
+		}
+	}
 }
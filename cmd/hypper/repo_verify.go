@@ -0,0 +1,155 @@
+/*
+Copyright SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/gosuri/uitable"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"helm.sh/helm/v3/pkg/cli/output"
+	"helm.sh/helm/v3/pkg/getter"
+	helmRepo "helm.sh/helm/v3/pkg/repo"
+
+	"github.com/rancher-sandbox/hypper/cmd/hypper/require"
+	"github.com/rancher-sandbox/hypper/pkg/repo"
+)
+
+const repoVerifyDesc = `
+Check that the index of a chart repository matches the archives it serves.
+
+Given a directory or the URL of a repository, its index.yaml is read, or the
+index given with '--index':
+
+	$ hypper repo verify ./charts
+	$ hypper repo verify https://charts.example.com --index ./index.yaml
+
+Every URL of every entry has to resolve to a chart archive with the digest,
+name and version of the entry. Entries that fail validation, and would be
+silently skipped when installing, are reported too. For directories, archives
+missing from the index are reported as well.
+
+The command fails when any problem is found.
+`
+
+type repoVerifyOptions struct {
+	location string
+	index    string
+	outfmt   output.Format
+}
+
+func newRepoVerifyCmd(out io.Writer) *cobra.Command {
+	o := &repoVerifyOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "verify [DIR|URL]",
+		Short: "check the index of a chart repository against its archives",
+		Long:  repoVerifyDesc,
+		Args:  require.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			o.location = args[0]
+			return o.run(out)
+		},
+	}
+
+	f := cmd.Flags()
+	f.StringVar(&o.index, "index", "", "path or URL of the index, instead of the index.yaml of the repository")
+	bindOutputFlag(cmd, &o.outfmt)
+
+	return cmd
+}
+
+func (o *repoVerifyOptions) run(out io.Writer) error {
+	u, err := repo.LocalURL(o.location)
+	if err != nil {
+		return err
+	}
+	r, err := repo.NewChartRepository(&helmRepo.Entry{Name: "verify", URL: u}, getter.All(settings.EnvSettings))
+	if err != nil {
+		return err
+	}
+
+	index, err := r.ReadIndex(o.index)
+	if err != nil {
+		return errors.Wrap(err, "failed reading the index")
+	}
+	report, err := r.VerifyArchives(index)
+	if err != nil {
+		return err
+	}
+
+	if err := o.outfmt.Write(out, &repoVerifyWriter{report}); err != nil {
+		return err
+	}
+	if len(report.Problems) > 0 {
+		return errors.Errorf("verification of %s failed: %d problems found", o.location, len(report.Problems))
+	}
+	return nil
+}
+
+type repoVerifyReport struct {
+	Verified []string              `json:"verified"`
+	Problems []*repo.VerifyProblem `json:"problems"`
+}
+
+type repoVerifyWriter struct {
+	report *repo.VerifyReport
+}
+
+func (r *repoVerifyWriter) WriteTable(out io.Writer) error {
+	if len(r.report.Problems) > 0 {
+		table := uitable.New()
+		table.AddRow("CHART", "VERSION", "PROBLEM", "URL", "DETAIL")
+		for _, p := range r.report.Problems {
+			table.AddRow(p.Chart, p.Version, p.Kind, p.URL, p.Detail)
+		}
+		if err := output.EncodeTable(out, table); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(out, "%d archives verified, %d problems found\n", len(r.report.Verified), len(r.report.Problems))
+	return err
+}
+
+func (r *repoVerifyWriter) WriteJSON(out io.Writer) error {
+	return r.encodeByFormat(out, output.JSON)
+}
+
+func (r *repoVerifyWriter) WriteYAML(out io.Writer) error {
+	return r.encodeByFormat(out, output.YAML)
+}
+
+func (r *repoVerifyWriter) encodeByFormat(out io.Writer, format output.Format) error {
+	// Initialize the arrays so no results returns empty arrays instead of null
+	report := repoVerifyReport{
+		Verified: append([]string{}, r.report.Verified...),
+		Problems: append([]*repo.VerifyProblem{}, r.report.Problems...),
+	}
+
+	switch format {
+	case output.JSON:
+		return output.EncodeJSON(out, report)
+	case output.YAML:
+		return output.EncodeYAML(out, report)
+	}
+
+	// Because this is a non-exported function and only called internally by
+	// WriteJSON and WriteYAML, we shouldn't get invalid types
+	return nil
+}
@@ -0,0 +1,88 @@
+/*
+Copyright SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"helm.sh/helm/v3/pkg/cli/output"
+
+	"github.com/rancher-sandbox/hypper/internal/test/ensure"
+	"github.com/rancher-sandbox/hypper/pkg/repo"
+)
+
+func copyTestChart(t *testing.T, name, dir string) {
+	t.Helper()
+	b, err := ioutil.ReadFile(filepath.Join("testdata/testcharts", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, name), b, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRepoVerify(t *testing.T) {
+	defer resetEnv()()
+
+	dir := ensure.TempDir(t)
+	copyTestChart(t, "vanilla-helm-compressedchart-0.1.0.tgz", dir)
+	copyTestChart(t, "vanilla-helm-compressedchart-0.2.0.tgz", dir)
+	index, err := repo.IndexDirectory(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := index.WriteFile(filepath.Join(dir, "index.yaml"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	o := &repoVerifyOptions{location: dir, outfmt: output.Table}
+	b := bytes.NewBuffer(nil)
+	if err := o.run(b); err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != "2 archives verified, 0 problems found\n" {
+		t.Errorf("unexpected output: %s", b.String())
+	}
+
+	// an archive missing from the index
+	copyTestChart(t, "vanilla-helm-compressedchart-0.3.0.tgz", dir)
+	b.Reset()
+	o.outfmt = output.JSON
+	err = o.run(b)
+	if err == nil || !strings.Contains(err.Error(), "1 problems found") {
+		t.Errorf("expected the verification to fail, got %v", err)
+	}
+	var report repoVerifyReport
+	if err := json.Unmarshal(b.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Verified) != 2 || len(report.Problems) != 1 || report.Problems[0].Kind != repo.ProblemNotIndexed {
+		t.Errorf("unexpected report: %s", b.String())
+	}
+
+	// no index to verify
+	o.index = filepath.Join(dir, "missing.yaml")
+	if err := o.run(b); err == nil || !strings.HasPrefix(err.Error(), "failed reading the index") {
+		t.Errorf("expected an error reading the index, got %v", err)
+	}
+}
@@ -65,6 +65,22 @@ func MinimumNArgs(n int) cobra.PositionalArgs {
 	}
 }
 
+// RangeArgs returns an error if the number of args is not between min and max.
+func RangeArgs(min, max int) cobra.PositionalArgs {
+	return func(cmd *cobra.Command, args []string) error {
+		if len(args) < min || len(args) > max {
+			return errors.Errorf(
+				"%q requires between %d and %d arguments\n\nUsage:  %s",
+				cmd.CommandPath(),
+				min,
+				max,
+				cmd.UseLine(),
+			)
+		}
+		return nil
+	}
+}
+
 func pluralize(word string, n int) string {
 	if n == 1 {
 		return word
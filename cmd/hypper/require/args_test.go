@@ -53,6 +53,16 @@ func TestArgs(t *testing.T) {
 	}, {
 		args:         []string{"one", "two"},
 		validateFunc: MinimumNArgs(1),
+	}, {
+		args:         []string{"one", "two"},
+		validateFunc: RangeArgs(1, 2),
+	}, {
+		validateFunc: RangeArgs(1, 2),
+		wantError:    `"root" requires between 1 and 2 arguments`,
+	}, {
+		args:         []string{"one", "two", "three"},
+		validateFunc: RangeArgs(1, 2),
+		wantError:    `"root" requires between 1 and 2 arguments`,
 	}})
 }
 
@@ -30,9 +30,12 @@ func newRootCmd(actionConfig *action.Configuration, logger log.Logger, args []st
 	cmd.AddCommand(
 		newInstallCmd(actionConfig, logger),
 		newUninstallCmd(actionConfig, logger),
+		newUpgradeCmd(actionConfig, logger),
 		newListCmd(actionConfig, logger),
 		newStatusCmd(actionConfig, logger),
 		newRepoCmd(logger),
+		newRegistryCmd(actionConfig, logger),
+		newCacheCmd(logger),
 	)
 
 	flags.ParseErrorsWhitelist.UnknownFlags = true
@@ -0,0 +1,125 @@
+/*
+Copyright SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"github.com/Masterminds/log-go"
+	"github.com/spf13/cobra"
+	"helm.sh/helm/v3/cmd/helm/require"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/cli/values"
+	"helm.sh/helm/v3/pkg/getter"
+	"helm.sh/helm/v3/pkg/release"
+
+	"github.com/rancher-sandbox/hypper/pkg/action"
+	"github.com/rancher-sandbox/hypper/pkg/eyecandy"
+)
+
+const upgradeDesc = `
+This command upgrades a release to a new version of a chart.
+
+To override values in a chart, use either the '--values' flag and pass in a
+file or use the '--set' flag and pass configuration from the command line. The
+values of the release are reused when no value is given; use '--reset-values'
+to go back to the chart defaults, or '--reuse-values' to merge the given values
+into the ones of the release.
+
+The upgrade arguments must be a release and a chart. The chart argument can be
+a chart reference, a path to a packaged chart, a path to an unpacked chart
+directory or a URL.
+
+Charts of the same name are considered the same chart, but releases stick to
+the repository they were installed from. When the chart is given only by name
+(e.g: 'hypper upgrade mymaria mariadb'), it is taken from that repository, and
+a warning is shown if another repository is preferred. To move the release to
+a chart of another repository, use '--allow-vendor-change'. The new repository
+is recorded on the release.
+`
+
+func newUpgradeCmd(actionConfig *action.Configuration, logger log.Logger) *cobra.Command {
+	client := action.NewUpgrade(actionConfig)
+	valueOpts := &values.Options{}
+
+	cmd := &cobra.Command{
+		Use:   "upgrade [RELEASE] [CHART]",
+		Short: "upgrade a release",
+		Long:  upgradeDesc,
+		Args:  require.ExactArgs(2),
+		RunE: func(_ *cobra.Command, args []string) error {
+			if _, err := runUpgrade(args, client, valueOpts, logger); err != nil {
+				return err
+			}
+			logger.Info(eyecandy.ESPrint(settings.NoEmojis, "Done! :clapping_hands:"))
+			return nil
+		},
+	}
+
+	f := cmd.Flags()
+	f.BoolVar(&client.AllowVendorChange, "allow-vendor-change", false, "allow upgrading the release to a chart from another repository than the one it comes from")
+	f.BoolVar(&client.Devel, "devel", false, "use development versions, too. Equivalent to version '>0.0.0-0'. If --version is set, this is ignored")
+	f.BoolVar(&client.ResetValues, "reset-values", false, "when upgrading, reset the values to the ones built into the chart")
+	f.BoolVar(&client.ReuseValues, "reuse-values", false, "when upgrading, reuse the last release's values and merge in any overrides from the command line via --set and -f. If '--reset-values' is specified, this is ignored")
+	addValueOptionsFlags(f, valueOpts)
+	addChartPathOptionsFlags(f, &client.ChartPathOptions)
+
+	err := cmd.RegisterFlagCompletionFunc("version", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if len(args) != 2 {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		return compVersionFlag(args[1], toComplete)
+	})
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	return cmd
+}
+
+func runUpgrade(args []string, client *action.Upgrade, valueOpts *values.Options, logger log.Logger) (*release.Release, error) {
+	client.Namespace = settings.Namespace()
+	client.Config.SetNamespace(client.Namespace)
+
+	if client.Version == "" && client.Devel {
+		logger.Debug("setting version to >0.0.0-0")
+		client.Version = ">0.0.0-0"
+	}
+
+	cp, err := client.LocateChart(args[0], args[1], settings)
+	if err != nil {
+		return nil, err
+	}
+	logger.Debugf("CHART PATH: %s\n", cp)
+
+	vals, err := valueOpts.MergeValues(getter.All(settings.EnvSettings))
+	if err != nil {
+		return nil, err
+	}
+
+	chartRequested, err := loader.Load(cp)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkIfInstallable(chartRequested.Metadata); err != nil {
+		return nil, err
+	}
+	if chartRequested.Metadata.Deprecated {
+		logger.Warn("This chart is deprecated")
+	}
+
+	return client.Run(args[0], chartRequested, vals)
+}
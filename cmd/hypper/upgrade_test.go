@@ -0,0 +1,146 @@
+/*
+Copyright SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Masterminds/log-go"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/release"
+	helmtime "helm.sh/helm/v3/pkg/time"
+
+	"github.com/rancher-sandbox/hypper/pkg/action"
+)
+
+func TestUpgradeCmd(t *testing.T) {
+	releaseFromRepo := func(name string) []*release.Release {
+		return []*release.Release{{
+			Name:      name,
+			Namespace: "default",
+			Version:   1,
+			Info: &release.Info{
+				Status:       release.StatusDeployed,
+				LastDeployed: helmtime.Unix(1452902400, 0).UTC(),
+			},
+			Chart: &chart.Chart{Metadata: &chart.Metadata{
+				Name:    "hypper-annot",
+				Version: "0.1.0",
+				Annotations: map[string]string{
+					action.SourceRepoAnnotation:    "upstream",
+					action.SourceRepoURLAnnotation: "https://example.com/charts",
+				},
+			}},
+		}}
+	}
+
+	tests := []cmdTestCase{
+		{
+			name:   "upgrade a release from a local chart",
+			cmd:    "upgrade zeppelin testdata/testcharts/hypper-annot",
+			golden: "output/upgrade-local-chart.txt",
+			rels:   releaseFromRepo("zeppelin"),
+		},
+		{
+			name:      "upgrade a release that does not exist",
+			cmd:       "upgrade zeppelin testdata/testcharts/hypper-annot",
+			golden:    "output/upgrade-no-release.txt",
+			wantError: true,
+		},
+		{
+			name:      "upgrade without chart",
+			cmd:       "upgrade zeppelin",
+			wantError: true,
+		},
+	}
+	runTestActionCmd(t, tests)
+}
+
+func TestUpgradeValues(t *testing.T) {
+	rel := func() *release.Release {
+		return &release.Release{
+			Name:      "zeppelin",
+			Namespace: "default",
+			Version:   1,
+			Info: &release.Info{
+				Status:       release.StatusDeployed,
+				LastDeployed: helmtime.Unix(1452902400, 0).UTC(),
+			},
+			Chart:  &chart.Chart{Metadata: &chart.Metadata{Name: "hypper-annot", Version: "0.1.0"}},
+			Config: map[string]interface{}{"old": "value"},
+		}
+	}
+
+	tests := []struct {
+		name   string
+		flags  string
+		config map[string]interface{}
+	}{
+		{
+			name:   "values of the release are reused by default",
+			config: map[string]interface{}{"old": "value"},
+		},
+		{
+			name:   "given values replace the ones of the release",
+			flags:  "--set new=value",
+			config: map[string]interface{}{"new": "value"},
+		},
+		{
+			name:   "given values are merged with --reuse-values",
+			flags:  "--set new=value --reuse-values",
+			config: map[string]interface{}{"old": "value", "new": "value"},
+		},
+		{
+			name:   "values of the release are dropped with --reset-values",
+			flags:  "--reset-values",
+			config: map[string]interface{}{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer resetEnv()()
+
+			store := storageFixture()
+			if err := store.Create(rel()); err != nil {
+				t.Fatal(err)
+			}
+			if _, _, err := executeActionCommandC(store, "upgrade zeppelin testdata/testcharts/hypper-annot "+tt.flags); err != nil {
+				t.Fatal(err)
+			}
+			last, err := store.Last("zeppelin")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if last.Version != 2 {
+				t.Fatalf("expected release version 2, got %d", last.Version)
+			}
+			if !reflect.DeepEqual(tt.config, last.Config) {
+				t.Errorf("expected values %v, got %v", tt.config, last.Config)
+			}
+		})
+	}
+}
+
+func TestUpgradeChartFlags(t *testing.T) {
+	cmd := newUpgradeCmd(&action.Configuration{}, log.Current)
+	for _, name := range []string{"version", "devel", "verify", "repo", "values", "set"} {
+		if cmd.Flags().Lookup(name) == nil {
+			t.Errorf("expected upgrade to have the --%s flag", name)
+		}
+	}
+}
@@ -11,6 +11,9 @@ replace (
 
 require (
 	github.com/Masterminds/log-go v0.4.0
+	github.com/Masterminds/semver/v3 v3.1.1
+	github.com/containerd/containerd v1.4.3
+	github.com/deislabs/oras v0.10.0
 	github.com/fatih/color v1.10.0
 	github.com/gofrs/flock v0.8.0
 	github.com/gosuri/uitable v0.0.4
@@ -20,9 +23,11 @@ require (
 	github.com/spf13/cobra v1.1.3
 	github.com/spf13/pflag v1.0.5
 	github.com/stretchr/testify v1.7.0
+	golang.org/x/crypto v0.0.0-20201221181555-eec23a3978ad
 	golang.org/x/term v0.0.0-20210220032956-6a3ed077a48d
 	gopkg.in/yaml.v2 v2.4.0
 	helm.sh/helm/v3 v3.5.2
+	k8s.io/apimachinery v0.20.4
 	k8s.io/cli-runtime v0.20.4
 	k8s.io/client-go v0.20.4
 	sigs.k8s.io/yaml v1.2.0
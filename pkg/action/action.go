@@ -1,6 +1,7 @@
 package action
 
 import (
+	"github.com/rancher-sandbox/hypper/pkg/registry"
 	"helm.sh/helm/v3/pkg/action"
 	"helm.sh/helm/v3/pkg/kube"
 	"helm.sh/helm/v3/pkg/time"
@@ -15,13 +16,26 @@ var Timestamper = time.Now
 // Configuration is a composite type of Helm's Configuration type
 type Configuration struct {
 	*action.Configuration
+
+	// RegistryClient is a client for working with registries
+	RegistryClient *registry.Client
+
+	// RancherVersion is the version of the Rancher server running on the
+	// cluster, empty if there is none. When nil, it is detected on first use.
+	RancherVersion *string
 }
 
-// SetNamespace sets the namespace on the kubeclient
+// SetNamespace sets the namespace on the kubeclient, and on the release
+// storage when its driver can change namespaces
 func (c *Configuration) SetNamespace(namespace string) {
 	switch i := c.KubeClient.(type) {
 	case *kube.Client:
 		i.Namespace = namespace
 		c.KubeClient = i
 	}
+	if c.Releases != nil {
+		if d, ok := c.Releases.Driver.(interface{ SetNamespace(string) }); ok {
+			d.SetNamespace(namespace)
+		}
+	}
 }
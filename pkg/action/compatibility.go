@@ -0,0 +1,131 @@
+/*
+Copyright SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package action
+
+import (
+	"context"
+
+	"github.com/Masterminds/log-go"
+	"github.com/Masterminds/semver/v3"
+	"github.com/pkg/errors"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+// rancherSettings are the settings of a Rancher server, its version among
+// them, found in the clusters it runs on
+var rancherSettings = schema.GroupVersionResource{Group: "management.cattle.io", Version: "v3", Resource: "settings"}
+
+// CheckCompatibility returns an error if the chart of the metadata cannot be
+// installed in the cluster: the Kubernetes version of the cluster must satisfy
+// both the kubeVersion of the chart and its catalog.cattle.io/kube-version
+// annotation and, when Rancher is detected, the Rancher version must satisfy
+// its catalog.cattle.io/rancher-version annotation.
+func (c *Configuration) CheckCompatibility(md *chart.Metadata) error {
+	for _, req := range []struct{ field, constraint string }{
+		{"kubeVersion", md.KubeVersion},
+		{"catalog.cattle.io/kube-version", md.Annotations["catalog.cattle.io/kube-version"]},
+	} {
+		if req.constraint == "" {
+			continue
+		}
+		kubeVersion, err := c.KubeVersion()
+		if err != nil {
+			return err
+		}
+		if !chartutil.IsCompatibleRange(req.constraint, kubeVersion) {
+			return errors.Errorf("chart %s %s requires %s: %s which is incompatible with Kubernetes %s", md.Name, md.Version, req.field, req.constraint, kubeVersion)
+		}
+	}
+
+	constraint := md.Annotations["catalog.cattle.io/rancher-version"]
+	if constraint == "" {
+		return nil
+	}
+	rancherVersion, err := c.GetRancherVersion()
+	if err != nil {
+		return err
+	}
+	if rancherVersion == "" {
+		return nil
+	}
+	if _, err := semver.NewVersion(rancherVersion); err != nil {
+		log.Debugf("not checking catalog.cattle.io/rancher-version of chart %s, Rancher %s is not a release", md.Name, rancherVersion)
+		return nil
+	}
+	if !chartutil.IsCompatibleRange(constraint, rancherVersion) {
+		return errors.Errorf("chart %s %s requires catalog.cattle.io/rancher-version: %s which is incompatible with Rancher %s", md.Name, md.Version, constraint, rancherVersion)
+	}
+	return nil
+}
+
+// KubeVersion returns the Kubernetes version of the cluster, as reported by
+// the discovery client, or the one of the capabilities when they are known.
+func (c *Configuration) KubeVersion() (string, error) {
+	if c.Capabilities != nil {
+		return c.Capabilities.KubeVersion.String(), nil
+	}
+	if c.RESTClientGetter == nil {
+		return "", errors.New("could not get Kubernetes discovery client")
+	}
+	dc, err := c.RESTClientGetter.ToDiscoveryClient()
+	if err != nil {
+		return "", errors.Wrap(err, "could not get Kubernetes discovery client")
+	}
+	kubeVersion, err := dc.ServerVersion()
+	if err != nil {
+		return "", errors.Wrap(err, "could not get server version from Kubernetes")
+	}
+	return kubeVersion.GitVersion, nil
+}
+
+// GetRancherVersion returns the version of the Rancher server running on the
+// cluster, read from its server-version setting, or an empty string if
+// Rancher is not detected. The version is kept in RancherVersion.
+func (c *Configuration) GetRancherVersion() (string, error) {
+	if c.RancherVersion != nil {
+		return *c.RancherVersion, nil
+	}
+
+	version := ""
+	if c.RESTClientGetter != nil {
+		config, err := c.RESTClientGetter.ToRESTConfig()
+		if err != nil {
+			return "", err
+		}
+		client, err := dynamic.NewForConfig(config)
+		if err != nil {
+			return "", err
+		}
+		setting, err := client.Resource(rancherSettings).Get(context.Background(), "server-version", metav1.GetOptions{})
+		switch {
+		case apierrors.IsNotFound(err), apierrors.IsForbidden(err):
+			log.Debugf("Rancher not detected: %s", err)
+		case err != nil:
+			return "", errors.Wrap(err, "could not detect Rancher")
+		default:
+			version, _, _ = unstructured.NestedString(setting.Object, "value")
+		}
+	}
+	c.RancherVersion = &version
+	return version, nil
+}
@@ -0,0 +1,101 @@
+/*
+Copyright SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package action
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"helm.sh/helm/v3/pkg/chart"
+)
+
+func TestCheckCompatibility(t *testing.T) {
+	rancher := func(v string) *string { return &v }
+
+	tests := []struct {
+		name           string
+		kubeVersion    string
+		annotations    map[string]string
+		rancherVersion *string
+		err            string
+	}{
+		{
+			name: "no constraints",
+		},
+		{
+			name:        "compatible kubeVersion",
+			kubeVersion: ">= 1.19.0-0",
+		},
+		{
+			name:        "incompatible kubeVersion",
+			kubeVersion: "< 1.19.0-0",
+			err:         "chart mychart 0.1.0 requires kubeVersion: < 1.19.0-0 which is incompatible with Kubernetes v1.20.0",
+		},
+		{
+			name:        "incompatible kube-version annotation",
+			annotations: map[string]string{"catalog.cattle.io/kube-version": ">= 1.21.0-0"},
+			err:         "chart mychart 0.1.0 requires catalog.cattle.io/kube-version: >= 1.21.0-0 which is incompatible with Kubernetes v1.20.0",
+		},
+		{
+			name:           "rancher not detected",
+			annotations:    map[string]string{"catalog.cattle.io/rancher-version": ">= 2.6.0-0"},
+			rancherVersion: rancher(""),
+		},
+		{
+			name:           "compatible rancher-version",
+			annotations:    map[string]string{"catalog.cattle.io/rancher-version": ">= 2.5.0-0 < 2.6.0-0"},
+			rancherVersion: rancher("v2.5.7"),
+		},
+		{
+			name:           "incompatible rancher-version",
+			annotations:    map[string]string{"catalog.cattle.io/rancher-version": ">= 2.6.0-0"},
+			rancherVersion: rancher("v2.5.7"),
+			err:            "chart mychart 0.1.0 requires catalog.cattle.io/rancher-version: >= 2.6.0-0 which is incompatible with Rancher v2.5.7",
+		},
+		{
+			name:           "development rancher",
+			annotations:    map[string]string{"catalog.cattle.io/rancher-version": ">= 2.6.0-0"},
+			rancherVersion: rancher("master-head"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			is := assert.New(t)
+
+			config := actionConfigFixture(t)
+			config.RancherVersion = tt.rancherVersion
+			md := &chart.Metadata{Name: "mychart", Version: "0.1.0", KubeVersion: tt.kubeVersion, Annotations: tt.annotations}
+			err := config.CheckCompatibility(md)
+			if tt.err == "" {
+				is.NoError(err)
+			} else {
+				is.EqualError(err, tt.err)
+			}
+		})
+	}
+}
+
+func TestGetRancherVersionWithoutCluster(t *testing.T) {
+	is := assert.New(t)
+
+	config := actionConfigFixture(t)
+	version, err := config.GetRancherVersion()
+	is.NoError(err)
+	is.Empty(version)
+	is.NotNil(config.RancherVersion)
+}
@@ -18,6 +18,7 @@ package action
 
 import (
 	"fmt"
+	"os"
 	"path/filepath"
 
 	"strings"
@@ -25,9 +26,17 @@ import (
 	"github.com/pkg/errors"
 
 	"github.com/Masterminds/log-go"
+	"github.com/rancher-sandbox/hypper/pkg/chartcache"
+	"github.com/rancher-sandbox/hypper/pkg/cli"
+	"github.com/rancher-sandbox/hypper/pkg/hypperpath"
+	"github.com/rancher-sandbox/hypper/pkg/repo"
 	"helm.sh/helm/v3/pkg/action"
 	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/downloader"
+	"helm.sh/helm/v3/pkg/provenance"
 	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/releaseutil"
+	helmRepo "helm.sh/helm/v3/pkg/repo"
 	"helm.sh/helm/v3/pkg/time"
 )
 
@@ -37,6 +46,23 @@ type Install struct {
 
 	// Config stores the actionconfig so it can be retrieved and used again
 	Config *Configuration
+
+	// Source is the repository of the chart found by LocateChart, if any
+	Source *ChartSource
+
+	// SkipAutoInstall skips the charts of the catalog.cattle.io/auto-install
+	// annotation, otherwise installed before the chart
+	SkipAutoInstall bool
+}
+
+// AutoInstallChart is a chart to install before another one, as declared in
+// the catalog.cattle.io/auto-install annotation of the latter
+type AutoInstallChart struct {
+	Name string
+
+	// Version is the version constraint of the chart, empty for the latest
+	// version
+	Version string
 }
 
 // NewInstall creates a new Install object with the given configuration,
@@ -59,6 +85,7 @@ func CheckDependencies(ch *chart.Chart, reqs []*chart.Dependency) error {
 // If DryRun is set to true, this will prepare the release, but not install it
 func (i *Install) Run(chrt *chart.Chart, vals map[string]interface{}) (*release.Release, error) {
 	log.Infof("Installing chart \"%s\" in namespace \"%s\"…", i.ReleaseName, i.Namespace)
+	SetChartSource(chrt, i.Source)
 	helmInstall := i.Install
 	rel, err := helmInstall.Run(chrt, vals) // wrap Helm's i.Run for now
 	return rel, err
@@ -68,12 +95,19 @@ func (i *Install) Run(chrt *chart.Chart, vals map[string]interface{}) (*release.
 //
 // This will read the chart annotations. If no annotations, it leave the existing ns in the action.
 func (i *Install) SetNamespace(chart *chart.Chart, defaultns string) {
+	i.SetNamespaceFromMetadata(chart.Metadata, defaultns)
+}
+
+// SetNamespaceFromMetadata sets the Namespace that should be used in
+// action.Install, reading the annotations of the chart metadata. It can be
+// used with the metadata of an index entry, before the chart is downloaded.
+func (i *Install) SetNamespaceFromMetadata(md *chart.Metadata, defaultns string) {
 	i.Namespace = defaultns
-	if chart.Metadata.Annotations != nil {
-		if val, ok := chart.Metadata.Annotations["hypper.cattle.io/namespace"]; ok {
+	if md.Annotations != nil {
+		if val, ok := md.Annotations["hypper.cattle.io/namespace"]; ok {
 			i.Namespace = val
 		} else {
-			if val, ok := chart.Metadata.Annotations["catalog.cattle.io/namespace"]; ok {
+			if val, ok := md.Annotations["catalog.cattle.io/namespace"]; ok {
 				i.Namespace = val
 			}
 		}
@@ -84,6 +118,13 @@ func (i *Install) SetNamespace(chart *chart.Chart, defaultns string) {
 //
 // This will read the flags and handle name generation if necessary.
 func (i *Install) Name(chart *chart.Chart, args []string) (string, error) {
+	return i.NameFromMetadata(chart.Metadata, args)
+}
+
+// NameFromMetadata returns the name that should be used, reading the
+// annotations of the chart metadata. It can be used with the metadata of an
+// index entry, before the chart is downloaded.
+func (i *Install) NameFromMetadata(md *chart.Metadata, args []string) (string, error) {
 	// args here will only be: [NAME] [CHART]
 	// cobra flags have been already stripped
 
@@ -105,11 +146,11 @@ func (i *Install) Name(chart *chart.Chart, args []string) (string, error) {
 		return args[0], flagsNotSet()
 	}
 
-	if chart.Metadata.Annotations != nil {
-		if val, ok := chart.Metadata.Annotations["hypper.cattle.io/release-name"]; ok {
+	if md.Annotations != nil {
+		if val, ok := md.Annotations["hypper.cattle.io/release-name"]; ok {
 			return val, nil
 		}
-		if val, ok := chart.Metadata.Annotations["catalog.cattle.io/release-name"]; ok {
+		if val, ok := md.Annotations["catalog.cattle.io/release-name"]; ok {
 			return val, nil
 		}
 	}
@@ -139,6 +180,47 @@ func (i *Install) Name(chart *chart.Chart, args []string) (string, error) {
 	return fmt.Sprintf("%s-%d", base, time.Now().Unix()), nil
 }
 
+// AutoInstallCharts returns the charts to install before the chart, read
+// from the catalog.cattle.io/auto-install annotation of its metadata.
+//
+// The annotation is a comma separated list of charts, as used by Rancher
+// charts to install their CRDs (e.g: "fleet-crd=match"). Each chart may be
+// followed by "=" and its version; "match" stands for the version of the chart
+// itself.
+func AutoInstallCharts(md *chart.Metadata) ([]AutoInstallChart, error) {
+	val := strings.TrimSpace(md.Annotations["catalog.cattle.io/auto-install"])
+	if val == "" {
+		return nil, nil
+	}
+
+	var charts []AutoInstallChart
+	for _, c := range strings.Split(val, ",") {
+		p := strings.SplitN(strings.TrimSpace(c), "=", 2)
+		ai := AutoInstallChart{Name: strings.TrimSpace(p[0])}
+		if len(p) == 2 {
+			ai.Version = strings.TrimSpace(p[1])
+			if ai.Version == "match" {
+				ai.Version = md.Version
+			}
+		}
+		if ai.Name == "" || (len(p) == 2 && ai.Version == "") {
+			return nil, errors.Errorf("invalid catalog.cattle.io/auto-install annotation %q in chart %s", val, md.Name)
+		}
+		charts = append(charts, ai)
+	}
+	return charts, nil
+}
+
+// IsInstalled returns true if the named release is deployed
+func (i *Install) IsInstalled(name string) bool {
+	h, err := i.Config.Releases.History(name)
+	if err != nil || len(h) < 1 {
+		return false
+	}
+	releaseutil.Reverse(h, releaseutil.SortByRevision)
+	return h[0].Info.Status == release.StatusDeployed
+}
+
 // Chart returns the chart that should be used.
 //
 // This will read the flags and skip args if necessary.
@@ -155,6 +237,252 @@ func (i *Install) Chart(args []string) (string, error) {
 	return args[0], nil
 }
 
+// LocateChart looks for a chart and returns the path to it.
+//
+// Charts referenced only by name, without a repository, are searched for in
+// all the configured repositories. Repositories with a higher priority win.
+// Among them, the newest version matching i.Version wins. If several
+// repositories provide it, the first one by repository name is used. All the
+// repositories providing the chart are reported, and i.Version is pinned to the
+// version found.
+//
+// Charts referenced as repo/chart are looked up first in the local chart cache,
+// using the digest of the matching entry in the cached repository index. On a
+// cache miss, the chart is downloaded as Helm would do, checked against that
+// digest, and stored in the cache for the next time.
+//
+// The repository the chart comes from, if any, is kept in i.Source.
+func (i *Install) LocateChart(name string, settings *cli.EnvSettings) (string, error) {
+	cp, src, err := locateChart(&i.ChartPathOptions, name, settings, bestMatch)
+	i.Source = src
+	return cp, err
+}
+
+// LookupChart returns the metadata of a chart from the index of its
+// repository, without downloading it, and the repo/chart reference to locate
+// it with. The version of the entry found is pinned in i.Version, so the chart
+// located afterwards is the one described by the metadata.
+//
+// Charts referenced only by name are resolved as LocateChart does. For charts
+// that are not in a repository (e.g: local paths or URLs), nil metadata is
+// returned.
+func (i *Install) LookupChart(name string, settings *cli.EnvSettings) (*chart.Metadata, string, error) {
+	name = strings.TrimSpace(name)
+
+	if _, err := os.Stat(name); err == nil || i.RepoURL != "" {
+		return nil, name, nil
+	}
+
+	if isChartName(name) {
+		m, err := resolveChart(&i.ChartPathOptions, name, settings, bestMatch)
+		if err != nil {
+			return nil, name, err
+		}
+		return m.Chart.Metadata, m.Ref(), nil
+	}
+
+	cv, err := findChartInRepoCache(name, i.Version, settings.RepositoryCache)
+	if err != nil {
+		// Not a chart of a known repository. Let LocateChart handle it.
+		return nil, name, nil
+	}
+	i.Version = cv.Version
+	return cv.Metadata, name, nil
+}
+
+// CheckReleaseName returns an error if the release name is already in use,
+// so it can be checked before the chart is downloaded.
+//
+// It follows the checks of Helm's Install.Run.
+func (i *Install) CheckReleaseName() error {
+	if i.DryRun {
+		return nil
+	}
+	h, err := i.Config.Releases.History(i.ReleaseName)
+	if err != nil || len(h) < 1 {
+		return nil
+	}
+	releaseutil.Reverse(h, releaseutil.SortByRevision)
+	if st := h[0].Info.Status; i.Replace && (st == release.StatusUninstalled || st == release.StatusFailed) {
+		return nil
+	}
+	return errors.New("cannot re-use a name that is still in use")
+}
+
+// chartPicker selects the chart to use among the matches of a chart name
+type chartPicker func(matches []*repo.ChartMatch) (*repo.ChartMatch, error)
+
+// bestMatch picks the first, preferred, match
+func bestMatch(matches []*repo.ChartMatch) (*repo.ChartMatch, error) {
+	return matches[0], nil
+}
+
+func locateChart(cpo *action.ChartPathOptions, name string, settings *cli.EnvSettings, pick chartPicker) (string, *ChartSource, error) {
+	name = strings.TrimSpace(name)
+
+	if _, err := os.Stat(name); err == nil || cpo.RepoURL != "" {
+		cp, err := cpo.LocateChart(name, settings.HelmSettings())
+		return cp, nil, err
+	}
+
+	if isChartName(name) {
+		m, err := resolveChart(cpo, name, settings, pick)
+		if err != nil {
+			return "", nil, err
+		}
+		name = m.Ref()
+	}
+	src := repoChartSource(name, settings)
+	if src != nil && cpo.Username == "" {
+		if err := setRepoCredentials(cpo, src.Repo, settings); err != nil {
+			return "", src, err
+		}
+	}
+	if src != nil && repo.IsLocalURL(src.URL) {
+		cp, err := locateLocalRepoChart(src.URL, name, cpo.Version, settings.RepositoryCache)
+		if err != nil {
+			return "", src, err
+		}
+		if cpo.Verify {
+			if _, err := downloader.VerifyChart(cp, cpo.Keyring); err != nil {
+				return "", src, err
+			}
+		}
+		return cp, src, nil
+	}
+
+	if cpo.Verify || settings.ChartCache == "" {
+		cp, err := cpo.LocateChart(name, settings.HelmSettings())
+		return cp, src, err
+	}
+
+	cv, err := findChartInRepoCache(name, cpo.Version, settings.RepositoryCache)
+	if err != nil || cv.Digest == "" {
+		// Not a chart we know the digest of (e.g: an URL). Let Helm handle it.
+		cp, err := cpo.LocateChart(name, settings.HelmSettings())
+		return cp, src, err
+	}
+
+	cache := chartcache.New(settings.ChartCache)
+	if cp, err := cache.Get(cv.Digest); err == nil {
+		log.Debugf("using chart %s %s from the chart cache", cv.Name, cv.Version)
+		return cp, src, nil
+	}
+
+	cp, err := cpo.LocateChart(name, settings.HelmSettings())
+	if err != nil {
+		return cp, src, err
+	}
+	cp, err = cache.Add(cp, cv.Digest)
+	return cp, src, err
+}
+
+// locateLocalRepoChart returns the path of a chart of a local repository,
+// checking it has not changed since the repository was updated
+func locateLocalRepoChart(repoURL, name, version, repoCache string) (string, error) {
+	cv, err := findChartInRepoCache(name, version, repoCache)
+	if err != nil {
+		return "", err
+	}
+	if len(cv.URLs) == 0 {
+		return "", errors.Errorf("chart %s %s has no URL", cv.Name, cv.Version)
+	}
+	u, err := helmRepo.ResolveReferenceURL(repoURL, cv.URLs[0])
+	if err != nil {
+		return "", err
+	}
+	cp := repo.LocalPath(u)
+	if cv.Digest != "" {
+		digest, err := provenance.DigestFile(cp)
+		if err != nil {
+			return "", err
+		}
+		if digest != chartcache.NormalizeDigest(cv.Digest) {
+			return "", errors.Errorf("%s has changed since the repository was last updated, run 'hypper repo update'", cp)
+		}
+	}
+	return cp, nil
+}
+
+// resolveChart finds the repository to get the chart name from, among all
+// the configured repositories, and pins cpo.Version to the version found.
+func resolveChart(cpo *action.ChartPathOptions, name string, settings *cli.EnvSettings, pick chartPicker) (*repo.ChartMatch, error) {
+	f, err := repo.LoadFile(settings.RepositoryConfig)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot resolve chart %q without repositories", name)
+	}
+	matches, err := repo.FindChart(f, settings.RepositoryCache, name, cpo.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	providers := make([]string, 0, len(matches))
+	for _, m := range matches {
+		providers = append(providers, fmt.Sprintf("%s (%s)", m.Repo, m.Chart.Version))
+	}
+	log.Infof("Chart \"%s\" is provided by: %s", name, strings.Join(providers, ", "))
+
+	m, err := pick(matches)
+	if err != nil {
+		return nil, err
+	}
+	log.Infof("Using \"%s\" version \"%s\"", m.Ref(), m.Chart.Version)
+
+	cpo.Version = m.Chart.Version
+	return m, nil
+}
+
+// repoChartSource returns the source of a chart referenced as repo/chart, or
+// nil if name does not reference a configured repository
+func repoChartSource(name string, settings *cli.EnvSettings) *ChartSource {
+	p := strings.SplitN(name, "/", 2)
+	if len(p) != 2 || p[0] == "" || p[1] == "" {
+		return nil
+	}
+	f, err := repo.LoadFile(settings.RepositoryConfig)
+	if err != nil || !f.Has(p[0]) {
+		return nil
+	}
+	return &ChartSource{Repo: p[0], URL: f.Get(p[0]).URL}
+}
+
+// setRepoCredentials sets in cpo the credentials of the named repository
+// kept by a credential helper, as Helm only knows about the credentials in the
+// repositories file.
+func setRepoCredentials(cpo *action.ChartPathOptions, name string, settings *cli.EnvSettings) error {
+	f, err := repo.LoadFile(settings.RepositoryConfig)
+	if err != nil || !f.Has(name) || f.Get(name).CredentialHelper == "" {
+		return nil
+	}
+	username, password, err := f.Get(name).Credentials()
+	if err != nil {
+		return err
+	}
+	cpo.Username = username
+	cpo.Password = password
+	return nil
+}
+
+// isChartName returns true if name is a bare chart name, neither a
+// repo/chart reference, a path nor an URL
+func isChartName(name string) bool {
+	return name != "" && !strings.ContainsAny(name, "/\\:") && !strings.HasPrefix(name, ".")
+}
+
+// findChartInRepoCache returns the index entry of a chart referenced as
+// repo/chart, reading the index of the repository from the repository cache.
+func findChartInRepoCache(name, version, repoCache string) (*helmRepo.ChartVersion, error) {
+	p := strings.SplitN(name, "/", 2)
+	if len(p) != 2 || p[0] == "" || p[1] == "" {
+		return nil, errors.Errorf("%q is not a repo/chart reference", name)
+	}
+	idx, err := repo.OpenChartIndex(filepath.Join(repoCache, hypperpath.CacheIndexFile(p[0])))
+	if err != nil {
+		return nil, err
+	}
+	return idx.Get(p[1], version)
+}
+
 // NameAndChart overloads Helm's NameAndChart. It always fails.
 //
 // On Hypper, we need to read the chart annotations to know the correct release name.
@@ -18,10 +18,27 @@ package action
 
 import (
 	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/openpgp"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/getter"
+	"helm.sh/helm/v3/pkg/provenance"
+	helmRepo "helm.sh/helm/v3/pkg/repo"
+	"helm.sh/helm/v3/pkg/repo/repotest"
 	"helm.sh/helm/v3/pkg/time"
+
+	"github.com/rancher-sandbox/hypper/internal/test/ensure"
+	"github.com/rancher-sandbox/hypper/pkg/cli"
+	"github.com/rancher-sandbox/hypper/pkg/credentials"
+	"github.com/rancher-sandbox/hypper/pkg/repo"
 )
 
 func installAction(t *testing.T) *Install {
@@ -221,3 +238,349 @@ func TestNameAndChart(t *testing.T) {
 	}
 	is.Equal("NameAndChart() cannot be used", err.Error())
 }
+
+func TestLocateChartCache(t *testing.T) {
+	is := assert.New(t)
+
+	dir := ensure.TempDir(t)
+	defer os.RemoveAll(dir)
+	if _, err := chartutil.Save(buildChart(), dir); err != nil {
+		t.Fatal(err)
+	}
+
+	srv, err := repotest.NewTempServerWithCleanup(t, filepath.Join(dir, "*.tgz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Stop()
+	if err := srv.LinkIndices(); err != nil {
+		t.Fatal(err)
+	}
+
+	settings := cli.New()
+	settings.RepositoryConfig = filepath.Join(srv.Root(), "repositories.yaml")
+	settings.RepositoryCache = srv.Root()
+	settings.ChartCache = filepath.Join(dir, "charts")
+
+	// cache miss: the chart is downloaded and stored in the cache
+	instAction := installAction(t)
+	cp, err := instAction.LocateChart("test/hello", settings)
+	is.NoError(err)
+	is.True(strings.HasPrefix(cp, settings.ChartCache), "expected %s to be in the chart cache", cp)
+
+	// cache hit: the chart is served from the cache, even if gone from the server
+	is.NoError(os.Remove(filepath.Join(srv.Root(), "hello-0.1.0.tgz")))
+	instAction = installAction(t)
+	cached, err := instAction.LocateChart("test/hello", settings)
+	is.NoError(err)
+	is.Equal(cp, cached)
+
+	// local charts skip the cache
+	instAction = installAction(t)
+	local, err := instAction.LocateChart(filepath.Join(dir, "hello-0.1.0.tgz"), settings)
+	is.NoError(err)
+	is.Equal(filepath.Join(dir, "hello-0.1.0.tgz"), local)
+}
+
+func TestLocateChartByName(t *testing.T) {
+	is := assert.New(t)
+
+	dir := ensure.TempDir(t)
+	defer os.RemoveAll(dir)
+	if _, err := chartutil.Save(buildChart(), dir); err != nil {
+		t.Fatal(err)
+	}
+
+	srv, err := repotest.NewTempServerWithCleanup(t, filepath.Join(dir, "*.tgz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Stop()
+	if err := srv.LinkIndices(); err != nil {
+		t.Fatal(err)
+	}
+
+	settings := cli.New()
+	settings.RepositoryConfig = filepath.Join(srv.Root(), "repositories.yaml")
+	settings.RepositoryCache = srv.Root()
+	settings.ChartCache = ""
+
+	instAction := installAction(t)
+	cp, err := instAction.LocateChart("hello", settings)
+	is.NoError(err)
+	is.Equal("hello-0.1.0.tgz", filepath.Base(cp))
+	is.Equal("0.1.0", instAction.Version)
+
+	instAction = installAction(t)
+	_, err = instAction.LocateChart("goodbye", settings)
+	is.EqualError(err, `chart "goodbye" not found in any repository`)
+}
+
+func TestLocateChartCredentialHelper(t *testing.T) {
+	is := assert.New(t)
+
+	dir := ensure.TempDir(t)
+	defer os.RemoveAll(dir)
+	if _, err := chartutil.Save(buildChart(), dir); err != nil {
+		t.Fatal(err)
+	}
+	srv, err := repotest.NewTempServerWithCleanup(t, filepath.Join(dir, "*.tgz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Stop()
+	srv.WithMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		if username, password, ok := r.BasicAuth(); !ok || username != "user" || password != "s3cr3t" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	})
+
+	defer os.Unsetenv("HYPPER_CREDENTIALS_FILE")
+	os.Setenv("HYPPER_CREDENTIALS_FILE", filepath.Join(srv.Root(), "credentials.enc"))
+	defer os.Unsetenv("HYPPER_CREDENTIALS_PASSPHRASE")
+	os.Setenv("HYPPER_CREDENTIALS_PASSPHRASE", "passphrase")
+	entry := &repo.Entry{Entry: helmRepo.Entry{Name: "auth", URL: srv.URL(), Username: "user", Password: "s3cr3t"}}
+	is.NoError(entry.StoreCredentials(credentials.DefaultHelper))
+	f := repo.NewFile()
+	f.Add(entry)
+
+	settings := cli.New()
+	settings.RepositoryConfig = filepath.Join(srv.Root(), "repositories.yaml")
+	settings.RepositoryCache = srv.Root()
+	settings.ChartCache = ""
+	is.NoError(f.WriteFile(settings.RepositoryConfig, 0644))
+
+	r, err := repo.NewChartRepositoryFromEntry(entry, getter.All(settings.HelmSettings()))
+	is.NoError(err)
+	r.CachePath = srv.Root()
+	_, err = r.DownloadIndexFile()
+	is.NoError(err)
+
+	instAction := installAction(t)
+	located, err := instAction.LocateChart("auth/hello", settings)
+	is.NoError(err)
+	is.FileExists(located)
+}
+
+func TestLocateChartLocalRepo(t *testing.T) {
+	is := assert.New(t)
+
+	dir := ensure.TempDir(t)
+	defer os.RemoveAll(dir)
+	cp, err := chartutil.Save(buildChart(), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := repo.LocalURL(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cache := ensure.TempDir(t)
+	f := repo.NewFile()
+	f.Add(&repo.Entry{Entry: helmRepo.Entry{Name: "local", URL: u}})
+	settings := cli.New()
+	settings.RepositoryConfig = filepath.Join(cache, "repositories.yaml")
+	settings.RepositoryCache = cache
+	if err := f.WriteFile(settings.RepositoryConfig, 0644); err != nil {
+		t.Fatal(err)
+	}
+	r, err := repo.NewChartRepositoryFromEntry(f.Get("local"), getter.All(settings.HelmSettings()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.CachePath = cache
+	if _, err := r.DownloadIndexFile(); err != nil {
+		t.Fatal(err)
+	}
+
+	instAction := installAction(t)
+	located, err := instAction.LocateChart("local/hello", settings)
+	is.NoError(err)
+	is.Equal(cp, located)
+	is.Equal("local", instAction.Source.Repo)
+
+	instAction = installAction(t)
+	located, err = instAction.LocateChart("hello", settings)
+	is.NoError(err)
+	is.Equal(cp, located)
+
+	// archives changed after the update are refused
+	if _, err := chartutil.Save(buildChart(withHypperAnnotations()), dir); err != nil {
+		t.Fatal(err)
+	}
+	instAction = installAction(t)
+	_, err = instAction.LocateChart("local/hello", settings)
+	is.Error(err)
+}
+
+func TestLocateChartLocalRepoVerify(t *testing.T) {
+	is := assert.New(t)
+
+	dir := ensure.TempDir(t)
+	defer os.RemoveAll(dir)
+	cp, err := chartutil.Save(buildChart(), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := repo.LocalURL(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cache := ensure.TempDir(t)
+	f := repo.NewFile()
+	f.Add(&repo.Entry{Entry: helmRepo.Entry{Name: "local", URL: u}})
+	settings := cli.New()
+	settings.RepositoryConfig = filepath.Join(cache, "repositories.yaml")
+	settings.RepositoryCache = cache
+	if err := f.WriteFile(settings.RepositoryConfig, 0644); err != nil {
+		t.Fatal(err)
+	}
+	r, err := repo.NewChartRepositoryFromEntry(f.Get("local"), getter.All(settings.HelmSettings()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.CachePath = cache
+	if _, err := r.DownloadIndexFile(); err != nil {
+		t.Fatal(err)
+	}
+
+	// an unsigned chart is refused
+	instAction := installAction(t)
+	instAction.Verify = true
+	_, err = instAction.LocateChart("local/hello", settings)
+	is.Error(err)
+
+	// a signed chart is verified against the keyring
+	e, err := openpgp.NewEntity("signer", "", "signer@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyring := filepath.Join(cache, "pubring.gpg")
+	kf, err := os.Create(keyring)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Serialize(kf); err != nil {
+		t.Fatal(err)
+	}
+	kf.Close()
+	signer := &provenance.Signatory{Entity: e}
+	sig, err := signer.ClearSign(cp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(cp+".prov", []byte(sig), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	instAction = installAction(t)
+	instAction.Verify = true
+	instAction.Keyring = keyring
+	located, err := instAction.LocateChart("local/hello", settings)
+	is.NoError(err)
+	is.Equal(cp, located)
+
+	// but not against another one
+	instAction = installAction(t)
+	instAction.Verify = true
+	instAction.Keyring = filepath.Join(cache, "missing.gpg")
+	_, err = instAction.LocateChart("local/hello", settings)
+	is.Error(err)
+}
+
+func TestLookupChart(t *testing.T) {
+	is := assert.New(t)
+
+	dir := ensure.TempDir(t)
+	defer os.RemoveAll(dir)
+	local, err := chartutil.Save(buildChart(withHypperAnnotations()), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv, err := repotest.NewTempServerWithCleanup(t, filepath.Join(dir, "*.tgz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Stop()
+	if err := srv.LinkIndices(); err != nil {
+		t.Fatal(err)
+	}
+
+	settings := cli.New()
+	settings.RepositoryConfig = filepath.Join(srv.Root(), "repositories.yaml")
+	settings.RepositoryCache = srv.Root()
+
+	for _, name := range []string{"test/hello", "hello"} {
+		instAction := installAction(t)
+		md, ref, err := instAction.LookupChart(name, settings)
+		is.NoError(err)
+		is.Equal("test/hello", ref)
+		is.Equal("0.1.0", instAction.Version)
+
+		instAction.SetNamespaceFromMetadata(md, "default")
+		is.Equal("hypper", instAction.Namespace)
+		releaseName, err := instAction.NameFromMetadata(md, []string{name})
+		is.NoError(err)
+		is.Equal("my-hypper-name", releaseName)
+	}
+
+	// charts outside repositories have to be loaded
+	instAction := installAction(t)
+	md, ref, err := instAction.LookupChart(local, settings)
+	is.NoError(err)
+	is.Nil(md)
+	is.Equal(local, ref)
+}
+
+func TestCheckReleaseName(t *testing.T) {
+	is := assert.New(t)
+
+	instAction := installAction(t)
+	is.NoError(instAction.CheckReleaseName())
+
+	_, err := instAction.Run(buildChart(), nil)
+	is.NoError(err)
+	is.EqualError(instAction.CheckReleaseName(), "cannot re-use a name that is still in use")
+
+	instAction.DryRun = true
+	is.NoError(instAction.CheckReleaseName())
+}
+
+func TestAutoInstallCharts(t *testing.T) {
+	is := assert.New(t)
+
+	md := &chart.Metadata{Name: "fleet", Version: "0.3.5"}
+	charts, err := AutoInstallCharts(md)
+	is.NoError(err)
+	is.Empty(charts)
+
+	md.Annotations = map[string]string{"catalog.cattle.io/auto-install": "fleet-crd=match, other-crd=~1.2, latest-crd"}
+	charts, err = AutoInstallCharts(md)
+	is.NoError(err)
+	is.Equal([]AutoInstallChart{
+		{Name: "fleet-crd", Version: "0.3.5"},
+		{Name: "other-crd", Version: "~1.2"},
+		{Name: "latest-crd"},
+	}, charts)
+
+	for _, val := range []string{"=match", "fleet-crd=", "fleet-crd,,other-crd"} {
+		md.Annotations["catalog.cattle.io/auto-install"] = val
+		_, err = AutoInstallCharts(md)
+		is.Error(err, val)
+	}
+}
+
+func TestIsInstalled(t *testing.T) {
+	is := assert.New(t)
+
+	instAction := installAction(t)
+	is.False(instAction.IsInstalled(instAction.ReleaseName))
+
+	_, err := instAction.Run(buildChart(), nil)
+	is.NoError(err)
+	is.True(instAction.IsInstalled(instAction.ReleaseName))
+	is.False(instAction.IsInstalled("other"))
+}
@@ -0,0 +1,178 @@
+/*
+Copyright SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package action
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Masterminds/log-go"
+	"github.com/pkg/errors"
+	"github.com/rancher-sandbox/hypper/pkg/cli"
+	"github.com/rancher-sandbox/hypper/pkg/repo"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/release"
+)
+
+const (
+	// SourceRepoAnnotation records, in the chart of a release, the name of
+	// the repository the chart was installed from
+	SourceRepoAnnotation = "hypper.cattle.io/source-repository"
+	// SourceRepoURLAnnotation records, in the chart of a release, the URL of
+	// the repository the chart was installed from
+	SourceRepoURLAnnotation = "hypper.cattle.io/source-repository-url"
+)
+
+// ChartSource is the repository, or vendor, a chart comes from
+type ChartSource struct {
+	Repo string
+	URL  string
+}
+
+func (s *ChartSource) String() string {
+	return fmt.Sprintf("%q (%s)", s.Repo, s.URL)
+}
+
+// Same returns true if both sources are the same repository, even if it has
+// been added with different names.
+func (s *ChartSource) Same(o *ChartSource) bool {
+	if s.URL != "" && o.URL != "" {
+		return strings.TrimSuffix(s.URL, "/") == strings.TrimSuffix(o.URL, "/")
+	}
+	return s.Repo == o.Repo
+}
+
+// SetChartSource records src in the chart annotations, so it is stored with
+// the release. A nil src removes any recorded source.
+func SetChartSource(chrt *chart.Chart, src *ChartSource) {
+	if src == nil {
+		if chrt.Metadata.Annotations != nil {
+			delete(chrt.Metadata.Annotations, SourceRepoAnnotation)
+			delete(chrt.Metadata.Annotations, SourceRepoURLAnnotation)
+		}
+		return
+	}
+	if chrt.Metadata.Annotations == nil {
+		chrt.Metadata.Annotations = map[string]string{}
+	}
+	chrt.Metadata.Annotations[SourceRepoAnnotation] = src.Repo
+	chrt.Metadata.Annotations[SourceRepoURLAnnotation] = src.URL
+}
+
+// GetChartSource returns the source recorded in the chart annotations, or nil
+// if the chart did not come from a repository.
+func GetChartSource(chrt *chart.Chart) *ChartSource {
+	if chrt == nil || chrt.Metadata == nil {
+		return nil
+	}
+	name, ok := chrt.Metadata.Annotations[SourceRepoAnnotation]
+	if !ok {
+		return nil
+	}
+	return &ChartSource{Repo: name, URL: chrt.Metadata.Annotations[SourceRepoURLAnnotation]}
+}
+
+// Upgrade is a composite type of Helm's Upgrade type
+type Upgrade struct {
+	*action.Upgrade
+
+	// Config stores the actionconfig so it can be retrieved and used again
+	Config *Configuration
+
+	// AllowVendorChange allows upgrading a release with a chart from another
+	// repository than the one it was installed from
+	AllowVendorChange bool
+
+	// Source is the repository of the chart found by LocateChart, if any
+	Source *ChartSource
+}
+
+// NewUpgrade creates a new Upgrade object with the given configuration,
+// by wrapping action.NewUpgrade
+func NewUpgrade(cfg *Configuration) *Upgrade {
+	return &Upgrade{
+		Upgrade: action.NewUpgrade(cfg.Configuration),
+		Config:  cfg,
+	}
+}
+
+// LocateChart looks for the chart to upgrade the release rel to, and returns
+// the path to it. See Install.LocateChart.
+//
+// Charts of the same name are the same chart, no matter the repository they
+// come from, but releases stick to the repository they were installed from.
+// When the chart is referenced only by name, it is taken from that repository
+// even if other repositories provide a newer version. A chart from another
+// repository is only used with AllowVendorChange.
+func (u *Upgrade) LocateChart(rel, name string, settings *cli.EnvSettings) (string, error) {
+	current := u.currentSource(rel)
+	cp, src, err := locateChart(&u.ChartPathOptions, name, settings, u.vendorMatch(rel, current))
+	if err != nil {
+		return cp, err
+	}
+	if current != nil && src != nil && !current.Same(src) && !u.AllowVendorChange {
+		return "", errors.Errorf("upgrading release %q would change its chart source from %s to %s, use --allow-vendor-change to allow it", rel, current, src)
+	}
+	u.Source = src
+	return cp, nil
+}
+
+// vendorMatch picks the match of the repository the release comes from,
+// warning if a better match is available from another one.
+func (u *Upgrade) vendorMatch(rel string, current *ChartSource) chartPicker {
+	return func(matches []*repo.ChartMatch) (*repo.ChartMatch, error) {
+		if current == nil || u.AllowVendorChange {
+			return matches[0], nil
+		}
+		for _, m := range matches {
+			if !current.Same(&ChartSource{Repo: m.Repo, URL: m.URL}) {
+				continue
+			}
+			if best := matches[0]; best != m {
+				log.Warnf("Chart \"%s\" version \"%s\" is preferred from repository \"%s\", but release \"%s\" comes from %s. Use --allow-vendor-change to switch", best.Chart.Name, best.Chart.Version, best.Repo, rel, current)
+			}
+			return m, nil
+		}
+		return nil, errors.Errorf("chart %q is not provided by %s, where release %q comes from, use --allow-vendor-change to get it from %q", matches[0].Chart.Name, current, rel, matches[0].Repo)
+	}
+}
+
+// currentSource returns the source of the last revision of the release, if known
+func (u *Upgrade) currentSource(name string) *ChartSource {
+	rel, err := u.Config.Releases.Last(name)
+	if err != nil {
+		return nil
+	}
+	return GetChartSource(rel.Chart)
+}
+
+// Run executes the upgrade on the given release, recording the chart source
+func (u *Upgrade) Run(name string, chrt *chart.Chart, vals map[string]interface{}) (*release.Release, error) {
+	if current := u.currentSource(name); current != nil {
+		switch {
+		case u.Source == nil:
+			log.Warnf("Release \"%s\" comes from %s, it is being upgraded to a chart from no repository", name, current)
+		case !current.Same(u.Source):
+			log.Infof("Changing the chart source of release \"%s\" from %s to %s", name, current, u.Source)
+		}
+	}
+	SetChartSource(chrt, u.Source)
+
+	log.Infof("Upgrading release \"%s\" in namespace \"%s\"…", name, u.Namespace)
+	return u.Upgrade.Run(name, chrt, vals)
+}
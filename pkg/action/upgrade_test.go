@@ -0,0 +1,174 @@
+/*
+Copyright SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package action
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	helmRepo "helm.sh/helm/v3/pkg/repo"
+	"helm.sh/helm/v3/pkg/repo/repotest"
+
+	"github.com/rancher-sandbox/hypper/internal/test/ensure"
+	"github.com/rancher-sandbox/hypper/pkg/cli"
+	"github.com/rancher-sandbox/hypper/pkg/hypperpath"
+	"github.com/rancher-sandbox/hypper/pkg/repo"
+)
+
+func withVersion(version string) chartOption {
+	return func(opts *chartOptions) {
+		opts.Chart.Metadata.Version = version
+	}
+}
+
+// vendorSettings serves the hello chart from two repositories, "upstream"
+// with version 0.1.0 and "fork" with version 0.2.0, and returns settings
+// using them.
+func vendorSettings(t *testing.T) *cli.EnvSettings {
+	t.Helper()
+	cache := ensure.TempDir(t)
+	f := repo.NewFile()
+	for name, version := range map[string]string{"upstream": "0.1.0", "fork": "0.2.0"} {
+		dir := ensure.TempDir(t)
+		if _, err := chartutil.Save(buildChart(withVersion(version)), dir); err != nil {
+			t.Fatal(err)
+		}
+		srv, err := repotest.NewTempServerWithCleanup(t, filepath.Join(dir, "*.tgz"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(srv.Stop)
+		b, err := ioutil.ReadFile(filepath.Join(srv.Root(), "index.yaml"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(cache, hypperpath.CacheIndexFile(name)), b, 0644); err != nil {
+			t.Fatal(err)
+		}
+		f.Add(&repo.Entry{Entry: helmRepo.Entry{Name: name, URL: srv.URL()}})
+	}
+
+	settings := cli.New()
+	settings.RepositoryConfig = filepath.Join(cache, "repositories.yaml")
+	settings.RepositoryCache = cache
+	settings.ChartCache = ""
+	if err := f.WriteFile(settings.RepositoryConfig, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return settings
+}
+
+func TestUpgradeVendorChange(t *testing.T) {
+	is := assert.New(t)
+	settings := vendorSettings(t)
+
+	// install from upstream
+	instAction := installAction(t)
+	instAction.Version = "0.1.0"
+	cp, err := instAction.LocateChart("hello", settings)
+	is.NoError(err)
+	is.Equal("upstream", instAction.Source.Repo)
+	chrt, err := loader.Load(cp)
+	is.NoError(err)
+	rel, err := instAction.Run(chrt, nil)
+	is.NoError(err)
+	is.Equal("upstream", GetChartSource(rel.Chart).Repo)
+
+	newUpgrade := func() *Upgrade {
+		upAction := NewUpgrade(instAction.Config)
+		upAction.Namespace = "spaced"
+		return upAction
+	}
+
+	// a plain upgrade sticks to upstream, even if the fork is newer
+	upAction := newUpgrade()
+	cp, err = upAction.LocateChart(rel.Name, "hello", settings)
+	is.NoError(err)
+	is.Equal("hello-0.1.0.tgz", filepath.Base(cp))
+	is.Equal("upstream", upAction.Source.Repo)
+
+	// explicitly asking for the fork needs consent
+	upAction = newUpgrade()
+	_, err = upAction.LocateChart(rel.Name, "fork/hello", settings)
+	is.Error(err)
+	is.Contains(err.Error(), "--allow-vendor-change")
+
+	// with consent, the release moves to the fork
+	upAction = newUpgrade()
+	upAction.AllowVendorChange = true
+	cp, err = upAction.LocateChart(rel.Name, "hello", settings)
+	is.NoError(err)
+	is.Equal("hello-0.2.0.tgz", filepath.Base(cp))
+	chrt, err = loader.Load(cp)
+	is.NoError(err)
+	rel, err = upAction.Run(rel.Name, chrt, nil)
+	is.NoError(err)
+	is.Equal("fork", GetChartSource(rel.Chart).Repo)
+	is.Equal(2, rel.Version)
+
+	// the fork is now the source of the release
+	upAction = newUpgrade()
+	_, err = upAction.LocateChart(rel.Name, "upstream/hello", settings)
+	is.Error(err)
+}
+
+func TestChartSource(t *testing.T) {
+	is := assert.New(t)
+
+	chrt := &chart.Chart{Metadata: &chart.Metadata{Name: "hello"}}
+	is.Nil(GetChartSource(chrt))
+
+	src := &ChartSource{Repo: "upstream", URL: "https://example.com/charts/"}
+	SetChartSource(chrt, src)
+	is.Equal(src, GetChartSource(chrt))
+
+	is.True(src.Same(&ChartSource{Repo: "renamed", URL: "https://example.com/charts"}))
+	is.False(src.Same(&ChartSource{Repo: "upstream", URL: "https://example.com/fork"}))
+	is.True((&ChartSource{Repo: "upstream"}).Same(src))
+
+	SetChartSource(chrt, nil)
+	is.Nil(GetChartSource(chrt))
+}
+
+func TestUpgradeFromLocalChart(t *testing.T) {
+	is := assert.New(t)
+	dir := ensure.TempDir(t)
+	defer os.RemoveAll(dir)
+
+	instAction := installAction(t)
+	instAction.Source = &ChartSource{Repo: "upstream", URL: "https://example.com/charts"}
+	rel, err := instAction.Run(buildChart(), nil)
+	is.NoError(err)
+
+	cp, err := chartutil.Save(buildChart(withVersion("0.2.0")), dir)
+	is.NoError(err)
+	upAction := NewUpgrade(instAction.Config)
+	upAction.Namespace = "spaced"
+	cp, err = upAction.LocateChart(rel.Name, cp, cli.New())
+	is.NoError(err)
+	chrt, err := loader.Load(cp)
+	is.NoError(err)
+	rel, err = upAction.Run(rel.Name, chrt, nil)
+	is.NoError(err)
+	is.Nil(GetChartSource(rel.Chart))
+}
@@ -0,0 +1,218 @@
+/*
+Copyright SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package chartcache
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/pkg/errors"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/provenance"
+)
+
+// algorithm is the only digest algorithm used by Helm indexes.
+const algorithm = "sha256"
+
+var (
+	// ErrNotCached indicates that there is no chart with the given digest in the cache.
+	ErrNotCached = errors.New("chart not found in cache")
+
+	// ErrDigestMismatch indicates that the content of a chart does not match its expected digest.
+	ErrDigestMismatch = errors.New("chart digest mismatch")
+)
+
+// Cache is a content-addressed store of packaged charts.
+//
+// Charts are keyed by the sha256 digest found in the repository index entries,
+// so the same archive is only downloaded once no matter how many times it is
+// installed. The cache is a plain directory, which makes it easy to persist
+// between CI runs.
+type Cache struct {
+	// Root is the directory where the charts are stored
+	Root string
+}
+
+// Entry describes a chart stored in the cache
+type Entry struct {
+	Digest   string    `json:"digest"`
+	Name     string    `json:"name"`
+	Version  string    `json:"version"`
+	Size     int64     `json:"size"`
+	LastUsed time.Time `json:"last_used"`
+	Path     string    `json:"path"`
+}
+
+// New returns a Cache stored in the given directory
+func New(root string) *Cache {
+	return &Cache{Root: root}
+}
+
+// NormalizeDigest strips the algorithm prefix, if any, from a digest
+func NormalizeDigest(digest string) string {
+	return strings.ToLower(strings.TrimPrefix(digest, algorithm+":"))
+}
+
+func (c *Cache) path(digest string) string {
+	return filepath.Join(c.Root, algorithm, NormalizeDigest(digest)+".tgz")
+}
+
+// Get returns the path of the chart with the given digest.
+//
+// The content of the archive is checked against the digest before returning;
+// a corrupted entry is removed from the cache and ErrDigestMismatch is returned.
+func (c *Cache) Get(digest string) (string, error) {
+	if NormalizeDigest(digest) == "" {
+		return "", ErrNotCached
+	}
+	p := c.path(digest)
+	if _, err := os.Stat(p); os.IsNotExist(err) {
+		return "", ErrNotCached
+	} else if err != nil {
+		return "", err
+	}
+	if err := checkDigest(p, digest); err != nil {
+		os.Remove(p)
+		return "", err
+	}
+	// Record the use, so that prune can find charts not used in a while
+	now := time.Now()
+	if err := os.Chtimes(p, now, now); err != nil {
+		return "", err
+	}
+	return p, nil
+}
+
+// Add copies the chart archive at src into the cache and returns its new path.
+//
+// The archive must match the given digest, otherwise ErrDigestMismatch is returned.
+func (c *Cache) Add(src, digest string) (string, error) {
+	if err := checkDigest(src, digest); err != nil {
+		return "", err
+	}
+	dst := c.path(digest)
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return "", err
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+
+	// Write to a temporary file and rename it, so concurrent readers never
+	// see a partially written chart
+	tmp, err := ioutil.TempFile(filepath.Dir(dst), ".tmp-")
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(tmp, in); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	if err := os.Rename(tmp.Name(), dst); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return dst, nil
+}
+
+// List returns the charts stored in the cache, sorted by name and version
+func (c *Cache) List() ([]*Entry, error) {
+	files, err := filepath.Glob(filepath.Join(c.Root, algorithm, "*.tgz"))
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]*Entry, 0, len(files))
+	for _, f := range files {
+		fi, err := os.Stat(f)
+		if err != nil {
+			return nil, err
+		}
+		e := &Entry{
+			Digest:   algorithm + ":" + strings.TrimSuffix(filepath.Base(f), ".tgz"),
+			Size:     fi.Size(),
+			LastUsed: fi.ModTime(),
+			Path:     f,
+		}
+		if ch, err := loader.LoadFile(f); err == nil {
+			e.Name = ch.Metadata.Name
+			e.Version = ch.Metadata.Version
+		}
+		entries = append(entries, e)
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].Name != entries[j].Name {
+			return entries[i].Name < entries[j].Name
+		}
+		vi, erri := semver.NewVersion(entries[i].Version)
+		vj, errj := semver.NewVersion(entries[j].Version)
+		if erri != nil || errj != nil {
+			return entries[i].Version < entries[j].Version
+		}
+		return vi.LessThan(vj)
+	})
+	return entries, nil
+}
+
+// Prune removes the cached charts for which remove returns true, and returns them
+func (c *Cache) Prune(remove func(*Entry) bool) ([]*Entry, error) {
+	entries, err := c.List()
+	if err != nil {
+		return nil, err
+	}
+	var removed []*Entry
+	for _, e := range entries {
+		if !remove(e) {
+			continue
+		}
+		if err := os.Remove(e.Path); err != nil {
+			return removed, err
+		}
+		removed = append(removed, e)
+	}
+	return removed, nil
+}
+
+// Clean removes all the charts from the cache
+func (c *Cache) Clean() error {
+	return os.RemoveAll(filepath.Join(c.Root, algorithm))
+}
+
+func checkDigest(path, digest string) error {
+	sum, err := provenance.DigestFile(path)
+	if err != nil {
+		return err
+	}
+	if sum != NormalizeDigest(digest) {
+		return errors.Wrapf(ErrDigestMismatch, "%s: expected %s, got %s", filepath.Base(path), NormalizeDigest(digest), sum)
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+/*
+Copyright SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package chartcache
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/provenance"
+
+	"github.com/rancher-sandbox/hypper/internal/test/ensure"
+)
+
+// saveChart packages a minimal chart in dir and returns its path and digest
+func saveChart(t *testing.T, dir, name, version string) (string, string) {
+	t.Helper()
+	ch := &chart.Chart{
+		Metadata: &chart.Metadata{APIVersion: "v2", Name: name, Version: version},
+	}
+	p, err := chartutil.Save(ch, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest, err := provenance.DigestFile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p, digest
+}
+
+func TestCache(t *testing.T) {
+	is := assert.New(t)
+	dir := ensure.TempDir(t)
+	defer os.RemoveAll(dir)
+
+	c := New(filepath.Join(dir, "charts"))
+	src, digest := saveChart(t, dir, "cutter", "0.10.0")
+	src2, digest2 := saveChart(t, dir, "cutter", "0.2.0")
+
+	_, err := c.Get(digest)
+	is.True(errors.Is(err, ErrNotCached))
+
+	_, err = c.Add(src, digest2)
+	is.True(errors.Is(err, ErrDigestMismatch))
+
+	p, err := c.Add(src, "sha256:"+digest)
+	is.NoError(err)
+	_, err = c.Add(src2, digest2)
+	is.NoError(err)
+
+	got, err := c.Get(digest)
+	is.NoError(err)
+	is.Equal(p, got)
+
+	entries, err := c.List()
+	is.NoError(err)
+	is.Len(entries, 2)
+	is.Equal("cutter", entries[0].Name)
+	is.Equal("0.2.0", entries[0].Version)
+	is.Equal("0.10.0", entries[1].Version)
+	is.Equal("sha256:"+digest, entries[1].Digest)
+
+	// a corrupted entry is dropped from the cache
+	is.NoError(ioutil.WriteFile(p, []byte("garbage"), 0644))
+	_, err = c.Get(digest)
+	is.True(errors.Is(err, ErrDigestMismatch))
+	_, err = os.Stat(p)
+	is.True(os.IsNotExist(err))
+
+	removed, err := c.Prune(func(e *Entry) bool { return e.Version == "0.2.0" })
+	is.NoError(err)
+	is.Len(removed, 1)
+	entries, err = c.List()
+	is.NoError(err)
+	is.Len(entries, 0)
+
+	_, err = c.Add(src2, digest2)
+	is.NoError(err)
+	is.NoError(c.Clean())
+	entries, err = c.List()
+	is.NoError(err)
+	is.Len(entries, 0)
+}
@@ -65,6 +65,8 @@ type EnvSettings struct {
 	RepositoryConfig string
 	// RepositoryCache is the path to the repository cache directory.
 	RepositoryCache string
+	// ChartCache is the path to the content-addressed chart cache directory.
+	ChartCache string
 	// PluginsDirectory is the path to the plugins directory.
 	PluginsDirectory string
 	// MaxHistory is the max release history maintained.
@@ -95,6 +97,7 @@ func New() *EnvSettings {
 		RegistryConfig:   envOr("HYPPER_REGISTRY_CONFIG", hypperpath.ConfigPath("registry.json")),
 		RepositoryConfig: envOr("HYPPER_REPOSITORY_CONFIG", hypperpath.ConfigPath("repositories.yaml")),
 		RepositoryCache:  envOr("HYPPER_REPOSITORY_CACHE", hypperpath.CachePath("repository")),
+		ChartCache:       envOr("HYPPER_CHART_CACHE", hypperpath.CachePath("charts")),
 
 		Verbose:  false,
 		NoColors: false,
@@ -155,6 +158,7 @@ func (s *EnvSettings) AddFlags(fs *pflag.FlagSet) {
 	fs.StringVar(&s.RegistryConfig, "registry-config", s.RegistryConfig, "path to the registry config file")
 	fs.StringVar(&s.RepositoryConfig, "repository-config", s.RepositoryConfig, "path to the file containing repository names and URLs")
 	fs.StringVar(&s.RepositoryCache, "repository-cache", s.RepositoryCache, "path to the file containing cached repository indexes")
+	fs.StringVar(&s.ChartCache, "chart-cache", s.ChartCache, "path to the directory containing cached charts")
 
 }
 
@@ -210,9 +214,10 @@ func (s *EnvSettings) EnvVars() map[string]string {
 		"HELM_KUBECAFILE":    s.KubeCaFile,
 
 		//hypper specific
-		"HYPPER_VERBOSE":  fmt.Sprint(s.Verbose),
-		"HYPPER_NOCOLORS": fmt.Sprint(s.NoColors),
-		"HYPPER_NOEMOJIS": fmt.Sprint(s.NoEmojis),
+		"HYPPER_VERBOSE":     fmt.Sprint(s.Verbose),
+		"HYPPER_NOCOLORS":    fmt.Sprint(s.NoColors),
+		"HYPPER_NOEMOJIS":    fmt.Sprint(s.NoEmojis),
+		"HYPPER_CHART_CACHE": s.ChartCache,
 	}
 	if s.KubeConfig != "" {
 		envvars["KUBECONFIG"] = s.KubeConfig
@@ -220,6 +225,17 @@ func (s *EnvSettings) EnvVars() map[string]string {
 	return envvars
 }
 
+// HelmSettings returns Helm's EnvSettings, updated with the paths that flags
+// may have changed after New was called.
+func (s *EnvSettings) HelmSettings() *cli.EnvSettings {
+	s.EnvSettings.Debug = s.Debug
+	s.EnvSettings.PluginsDirectory = s.PluginsDirectory
+	s.EnvSettings.RegistryConfig = s.RegistryConfig
+	s.EnvSettings.RepositoryConfig = s.RepositoryConfig
+	s.EnvSettings.RepositoryCache = s.RepositoryCache
+	return s.EnvSettings
+}
+
 // Namespace gets the namespace from the configuration or the config flag
 func (s *EnvSettings) Namespace() string {
 	if s.NamespaceFromFlag {
@@ -0,0 +1,119 @@
+/*
+Copyright SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package credentials stores the credentials of chart repositories outside of
+// the repositories file, in credential helpers.
+//
+// Credential helpers follow the protocol of the docker credential helpers: an
+// executable named hypper-credential-NAME, or docker-credential-NAME, called
+// with the store, get, erase or list commands. The credentials are exchanged
+// as JSON through stdin and stdout. The "file" helper is built in, and keeps
+// the credentials in a file encrypted with a passphrase, taken from
+// $HYPPER_CREDENTIALS_PASSPHRASE or asked on the terminal.
+package credentials
+
+import (
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/pkg/errors"
+	"golang.org/x/term"
+
+	"github.com/rancher-sandbox/hypper/pkg/hypperpath"
+)
+
+// DefaultHelper is the name of the built in, file based, credential helper
+const DefaultHelper = "file"
+
+// ErrCredentialsNotFound is returned by helpers without credentials for a
+// server URL
+var ErrCredentialsNotFound = errors.New("credentials not found")
+
+// Credentials are the credentials of a server, as exchanged with helpers.
+//
+// ServerURL is the key the credentials are stored by. It does not need to be
+// a plain URL, e.g: repositories use their URL and name, so that repositories
+// of the same URL keep their own credentials.
+type Credentials struct {
+	ServerURL string
+	Username  string
+	Secret    string
+}
+
+// Helper stores credentials by server URL, or any other key
+type Helper interface {
+	// Add stores the credentials, replacing the ones of the same server URL
+	Add(c *Credentials) error
+	// Delete removes the credentials of serverURL
+	Delete(serverURL string) error
+	// Get returns the username and secret of serverURL, or
+	// ErrCredentialsNotFound
+	Get(serverURL string) (string, string, error)
+	// List returns the usernames by server URL
+	List() (map[string]string, error)
+}
+
+// NewHelper returns the credential helper called name
+func NewHelper(name string) (Helper, error) {
+	if name == "" {
+		return nil, errors.New("no credential helper name")
+	}
+	if name == DefaultHelper {
+		return NewFileHelper(DefaultFilePath(), DefaultPassphrase), nil
+	}
+	return NewExecHelper(name)
+}
+
+// DefaultFilePath is the path of the file of the built in helper. It can be
+// set with $HYPPER_CREDENTIALS_FILE.
+func DefaultFilePath() string {
+	if p, ok := os.LookupEnv("HYPPER_CREDENTIALS_FILE"); ok {
+		return p
+	}
+	return hypperpath.ConfigPath("credentials.enc")
+}
+
+var (
+	passphraseMu sync.Mutex
+	passphrase   string
+)
+
+// DefaultPassphrase returns the passphrase of the file of the built in helper,
+// from $HYPPER_CREDENTIALS_PASSPHRASE or else asked on the terminal, once per
+// process
+func DefaultPassphrase() (string, error) {
+	if p, ok := os.LookupEnv("HYPPER_CREDENTIALS_PASSPHRASE"); ok {
+		return p, nil
+	}
+
+	passphraseMu.Lock()
+	defer passphraseMu.Unlock()
+	if passphrase != "" {
+		return passphrase, nil
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return "", errors.New("the credentials file needs a passphrase, set $HYPPER_CREDENTIALS_PASSPHRASE")
+	}
+	fmt.Fprint(os.Stderr, "Passphrase of the credentials file: ")
+	b, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	passphrase = string(b)
+	return passphrase, nil
+}
@@ -0,0 +1,108 @@
+/*
+Copyright SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package credentials
+
+import (
+	"bytes"
+	"encoding/json"
+	"os/exec"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// errCredentialsNotFoundMessage is the output of docker credential helpers
+// without credentials for a server URL
+const errCredentialsNotFoundMessage = "credentials not found in native keychain"
+
+// ExecHelper is a credential helper run as an external program
+type ExecHelper struct {
+	// Program is the path of the helper executable
+	Program string
+}
+
+// NewExecHelper finds the executable of the helper called name in $PATH,
+// either hypper-credential-NAME or docker-credential-NAME.
+func NewExecHelper(name string) (*ExecHelper, error) {
+	for _, prefix := range []string{"hypper-credential-", "docker-credential-"} {
+		if p, err := exec.LookPath(prefix + name); err == nil {
+			return &ExecHelper{Program: p}, nil
+		}
+	}
+	return nil, errors.Errorf("credential helper %q not found: neither hypper-credential-%s nor docker-credential-%s are in $PATH", name, name, name)
+}
+
+// Add implements Helper
+func (h *ExecHelper) Add(c *Credentials) error {
+	in, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	_, err = h.run("store", in)
+	return err
+}
+
+// Delete implements Helper
+func (h *ExecHelper) Delete(serverURL string) error {
+	_, err := h.run("erase", []byte(serverURL))
+	return err
+}
+
+// Get implements Helper
+func (h *ExecHelper) Get(serverURL string) (string, string, error) {
+	out, err := h.run("get", []byte(serverURL))
+	if err != nil {
+		return "", "", err
+	}
+	c := &Credentials{}
+	if err := json.Unmarshal(out, c); err != nil {
+		return "", "", errors.Wrapf(err, "invalid credentials from %s", h.Program)
+	}
+	return c.Username, c.Secret, nil
+}
+
+// List implements Helper
+func (h *ExecHelper) List() (map[string]string, error) {
+	out, err := h.run("list", nil)
+	if err != nil {
+		return nil, err
+	}
+	list := map[string]string{}
+	if err := json.Unmarshal(out, &list); err != nil {
+		return nil, errors.Wrapf(err, "invalid list of credentials from %s", h.Program)
+	}
+	return list, nil
+}
+
+func (h *ExecHelper) run(command string, in []byte) ([]byte, error) {
+	cmd := exec.Command(h.Program, command)
+	cmd.Stdin = bytes.NewReader(in)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stdout.String())
+		if msg == errCredentialsNotFoundMessage {
+			return nil, ErrCredentialsNotFound
+		}
+		if msg == "" {
+			msg = strings.TrimSpace(stderr.String())
+		}
+		return nil, errors.Wrapf(err, "%s %s failed: %s", h.Program, command, msg)
+	}
+	return stdout.Bytes(), nil
+}
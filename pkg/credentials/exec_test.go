@@ -0,0 +1,92 @@
+/*
+Copyright SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package credentials
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/rancher-sandbox/hypper/internal/test/ensure"
+)
+
+// fakeHelper answers like a docker credential helper knowing the
+// credentials of https://charts.example.com
+const fakeHelper = `#!/bin/sh
+read -r input
+case "$1" in
+get)
+	if [ "$input" = "https://charts.example.com" ]; then
+		echo '{"ServerURL":"https://charts.example.com","Username":"user","Secret":"s3cr3t"}'
+		exit 0
+	fi
+	echo "credentials not found in native keychain"
+	exit 1
+	;;
+list)
+	echo '{"https://charts.example.com":"user"}'
+	;;
+store|erase)
+	echo "$1 $input" >> "${0%/*}/calls"
+	;;
+esac
+`
+
+func TestExecHelper(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake credential helper is a shell script")
+	}
+	is := assert.New(t)
+
+	dir := ensure.TempDir(t)
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "docker-credential-fake"), []byte(fakeHelper), 0755); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", dir)
+
+	_, err := NewHelper("missing")
+	is.EqualError(err, `credential helper "missing" not found: neither hypper-credential-missing nor docker-credential-missing are in $PATH`)
+
+	h, err := NewHelper("fake")
+	is.NoError(err)
+
+	username, secret, err := h.Get("https://charts.example.com")
+	is.NoError(err)
+	is.Equal("user", username)
+	is.Equal("s3cr3t", secret)
+
+	_, _, err = h.Get("https://other.example.com")
+	is.Equal(ErrCredentialsNotFound, err)
+
+	list, err := h.List()
+	is.NoError(err)
+	is.Equal(map[string]string{"https://charts.example.com": "user"}, list)
+
+	is.NoError(h.Add(&Credentials{ServerURL: "https://other.example.com", Username: "other", Secret: "pass"}))
+	is.NoError(h.Delete("https://other.example.com"))
+	calls, err := ioutil.ReadFile(filepath.Join(dir, "calls"))
+	is.NoError(err)
+	is.Equal(`store {"ServerURL":"https://other.example.com","Username":"other","Secret":"pass"}
+erase https://other.example.com
+`, string(calls))
+}
@@ -0,0 +1,210 @@
+/*
+Copyright SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package credentials
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/scrypt"
+)
+
+// saltSize is the size of the salt the key of the credentials file is derived
+// with, and keySize the size of the AES-256 key
+const (
+	saltSize = 16
+	keySize  = 32
+)
+
+// FileHelper keeps credentials in a file encrypted with AES-256-GCM, only
+// readable by its owner.
+//
+// The key is derived with scrypt from the passphrase returned by Passphrase,
+// which is only called when the file is read or written. The file holds the
+// salt and the nonce, followed by the encrypted credentials.
+type FileHelper struct {
+	Path       string
+	Passphrase func() (string, error)
+}
+
+// NewFileHelper returns a helper keeping the credentials in path, encrypted
+// with the passphrase returned by passphrase
+func NewFileHelper(path string, passphrase func() (string, error)) *FileHelper {
+	return &FileHelper{Path: path, Passphrase: passphrase}
+}
+
+type fileEntry struct {
+	Username string `json:"username"`
+	Secret   string `json:"secret"`
+}
+
+// Add implements Helper
+func (h *FileHelper) Add(c *Credentials) error {
+	entries, err := h.load()
+	if err != nil {
+		return err
+	}
+	entries[c.ServerURL] = fileEntry{Username: c.Username, Secret: c.Secret}
+	return h.save(entries)
+}
+
+// Delete implements Helper
+func (h *FileHelper) Delete(serverURL string) error {
+	entries, err := h.load()
+	if err != nil {
+		return err
+	}
+	if _, ok := entries[serverURL]; !ok {
+		return ErrCredentialsNotFound
+	}
+	delete(entries, serverURL)
+	return h.save(entries)
+}
+
+// Get implements Helper
+func (h *FileHelper) Get(serverURL string) (string, string, error) {
+	entries, err := h.load()
+	if err != nil {
+		return "", "", err
+	}
+	e, ok := entries[serverURL]
+	if !ok {
+		return "", "", ErrCredentialsNotFound
+	}
+	return e.Username, e.Secret, nil
+}
+
+// List implements Helper
+func (h *FileHelper) List() (map[string]string, error) {
+	entries, err := h.load()
+	if err != nil {
+		return nil, err
+	}
+	list := make(map[string]string, len(entries))
+	for u, e := range entries {
+		list[u] = e.Username
+	}
+	return list, nil
+}
+
+func (h *FileHelper) load() (map[string]fileEntry, error) {
+	entries := map[string]fileEntry{}
+	data, err := ioutil.ReadFile(h.Path)
+	if os.IsNotExist(err) {
+		return entries, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if len(data) < saltSize {
+		return nil, errors.Errorf("%s is not a credentials file", h.Path)
+	}
+	gcm, err := h.newGCM(data[:saltSize])
+	if err != nil {
+		return nil, err
+	}
+	data = data[saltSize:]
+	if len(data) < gcm.NonceSize() {
+		return nil, errors.Errorf("%s is not a credentials file", h.Path)
+	}
+	plain, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, errors.Errorf("cannot decrypt %s, is the passphrase right?", h.Path)
+	}
+	if err := json.Unmarshal(plain, &entries); err != nil {
+		return nil, errors.Wrapf(err, "cannot load %s", h.Path)
+	}
+	return entries, nil
+}
+
+func (h *FileHelper) save(entries map[string]fileEntry) error {
+	if err := os.MkdirAll(filepath.Dir(h.Path), 0700); err != nil {
+		return err
+	}
+	plain, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+
+	salt := make([]byte, saltSize)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return err
+	}
+	gcm, err := h.newGCM(salt)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return err
+	}
+	data := append(salt, gcm.Seal(nonce, nonce, plain, nil)...)
+	return writeFileAtomic(h.Path, data)
+}
+
+// newGCM returns the cipher of the key derived from the passphrase and salt
+func (h *FileHelper) newGCM(salt []byte) (cipher.AEAD, error) {
+	if h.Passphrase == nil {
+		return nil, errors.Errorf("no passphrase for %s", h.Path)
+	}
+	passphrase, err := h.Passphrase()
+	if err != nil {
+		return nil, err
+	}
+	if passphrase == "" {
+		return nil, errors.Errorf("the passphrase of %s cannot be empty", h.Path)
+	}
+	key, err := scrypt.Key([]byte(passphrase), salt, 1<<15, 8, 1, keySize)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// writeFileAtomic writes data to a file only readable by its owner, through
+// a temporary file, so the credentials are never left half written
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".credentials-")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0600); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,77 @@
+/*
+Copyright SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package credentials
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/rancher-sandbox/hypper/internal/test/ensure"
+)
+
+func TestFileHelper(t *testing.T) {
+	is := assert.New(t)
+
+	dir := ensure.TempDir(t)
+	defer os.RemoveAll(dir)
+	passphrase := func() (string, error) { return "passphrase", nil }
+	h := NewFileHelper(filepath.Join(dir, "credentials.enc"), passphrase)
+
+	_, _, err := h.Get("https://charts.example.com")
+	is.Equal(ErrCredentialsNotFound, err)
+
+	is.NoError(h.Add(&Credentials{ServerURL: "https://charts.example.com", Username: "user", Secret: "s3cr3t"}))
+	is.NoError(h.Add(&Credentials{ServerURL: "https://other.example.com", Username: "other", Secret: "pass"}))
+
+	username, secret, err := h.Get("https://charts.example.com")
+	is.NoError(err)
+	is.Equal("user", username)
+	is.Equal("s3cr3t", secret)
+
+	list, err := h.List()
+	is.NoError(err)
+	is.Equal(map[string]string{"https://charts.example.com": "user", "https://other.example.com": "other"}, list)
+
+	// the file is only readable by the owner
+	fi, err := os.Stat(h.Path)
+	is.NoError(err)
+	is.Equal(os.FileMode(0600), fi.Mode().Perm())
+
+	// the file is encrypted, and needs the passphrase
+	data, err := ioutil.ReadFile(h.Path)
+	is.NoError(err)
+	is.NotContains(string(data), "s3cr3t")
+	is.NotContains(string(data), "https://charts.example.com")
+	_, _, err = NewFileHelper(h.Path, func() (string, error) { return "wrong", nil }).Get("https://charts.example.com")
+	is.EqualError(err, "cannot decrypt "+h.Path+", is the passphrase right?")
+	_, _, err = NewFileHelper(h.Path, func() (string, error) { return "", nil }).Get("https://charts.example.com")
+	is.EqualError(err, "the passphrase of "+h.Path+" cannot be empty")
+
+	is.NoError(h.Delete("https://charts.example.com"))
+	_, _, err = h.Get("https://charts.example.com")
+	is.Equal(ErrCredentialsNotFound, err)
+	is.Equal(ErrCredentialsNotFound, h.Delete("https://charts.example.com"))
+
+	// a broken file is reported
+	is.NoError(ioutil.WriteFile(h.Path, []byte("{not json"), 0600))
+	_, _, err = h.Get("https://other.example.com")
+	is.Error(err)
+}
@@ -21,6 +21,15 @@ func CacheIndexFile(name string) string {
 	return name + "index.yaml"
 }
 
+// CacheParsedIndexFile returns the path to the pre-parsed index for the given
+// named repository.
+func CacheParsedIndexFile(name string) string {
+	if name != "" {
+		name += "-"
+	}
+	return name + "index.gob"
+}
+
 // CacheChartsFile returns the path to a text file listing all the charts
 // within the given named repository.
 func CacheChartsFile(name string) string {
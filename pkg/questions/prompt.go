@@ -0,0 +1,190 @@
+/*
+Copyright SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package questions
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/rancher-sandbox/hypper/pkg/eyecandy"
+)
+
+// Prompter asks questions on a terminal
+type Prompter struct {
+	In       *bufio.Reader
+	Out      io.Writer
+	NoEmojis bool
+
+	// ReadPassword reads the answer to password questions without echoing
+	// it. When nil, they are read from In as any other answer.
+	ReadPassword func() (string, error)
+}
+
+// NewPrompter returns a Prompter reading answers from in
+func NewPrompter(in io.Reader, out io.Writer, noEmojis bool) *Prompter {
+	return &Prompter{In: bufio.NewReader(in), Out: out, NoEmojis: noEmojis}
+}
+
+// Ask asks the questions shown, in order, and returns their answers. Questions
+// validly answered in answers are not asked again, and the answers to
+// questions not shown are dropped. The default answer of a question is given
+// by defaults, when not empty, or by the question itself.
+func (p *Prompter) Ask(qs *Questions, answers Answers, defaults func(q *Question) string) (Answers, error) {
+	result := Answers{}
+
+	group := ""
+	var ask func(q *Question) error
+	ask = func(q *Question) error {
+		if !q.Shown(result) {
+			return nil
+		}
+		answer, ok := answers[q.Variable]
+		if ok {
+			answer = normalize(q, answer)
+			if err := q.Validate(answer); err != nil {
+				fmt.Fprintln(p.Out, eyecandy.Red(fmt.Sprintf("invalid answer for %s: %s", q.Variable, err)))
+				ok = false
+			} else {
+				result[q.Variable] = answer
+			}
+		}
+		if !ok {
+			if q.Group != "" && q.Group != group {
+				group = q.Group
+				fmt.Fprintln(p.Out, eyecandy.ESPrintf(p.NoEmojis, ":clipboard: %s", eyecandy.Magenta(group)))
+			}
+			def := ""
+			if defaults != nil {
+				def = defaults(q)
+			}
+			if def == "" {
+				def = q.DefaultAnswer()
+			}
+			var err error
+			if answer, err = p.AskOne(q, def); err != nil {
+				return err
+			}
+			if answer != "" {
+				result[q.Variable] = answer
+			}
+		}
+		if q.ShowSubquestions(answer) {
+			for n := range q.Subquestions {
+				if err := ask(&q.Subquestions[n]); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	for n := range qs.Questions {
+		if err := ask(&qs.Questions[n]); err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// AskOne asks a question until it is given a valid answer, which is def when
+// the answer is empty
+func (p *Prompter) AskOne(q *Question, def string) (string, error) {
+	label := q.Label
+	if label == "" {
+		label = q.Variable
+	}
+	if q.Description != "" {
+		fmt.Fprintln(p.Out, "  "+eyecandy.Blue(q.Description))
+	}
+	if len(q.Options) > 0 {
+		for n, o := range q.Options {
+			fmt.Fprintf(p.Out, "  %d) %s\n", n+1, o)
+		}
+	}
+	prompt := eyecandy.ESPrintf(p.NoEmojis, ":question: %s", label)
+	if def != "" && q.Type != "password" {
+		prompt += fmt.Sprintf(" [%s]", def)
+	}
+	prompt += ": "
+
+	for {
+		fmt.Fprint(p.Out, prompt)
+		answer, err := p.read(q)
+		if err != nil && (err != io.EOF || answer == "") {
+			if err == io.EOF {
+				return "", errors.Errorf("no answer for %s", q.Variable)
+			}
+			return "", err
+		}
+		if answer == "" {
+			answer = def
+		}
+		answer = normalize(q, answer)
+		verr := q.Validate(answer)
+		if verr == nil {
+			return answer, nil
+		}
+		fmt.Fprintln(p.Out, eyecandy.Red(verr.Error()))
+		if err == io.EOF {
+			return "", errors.Wrapf(verr, "invalid answer for %s", q.Variable)
+		}
+	}
+}
+
+func (p *Prompter) read(q *Question) (string, error) {
+	if q.Type == "password" && p.ReadPassword != nil {
+		answer, err := p.ReadPassword()
+		fmt.Fprintln(p.Out)
+		return answer, err
+	}
+	line, err := p.In.ReadString('\n')
+	return strings.TrimSpace(line), err
+}
+
+// normalize turns the shortcuts accepted as answers into the answers
+// themselves: option numbers, and y/n for booleans
+func normalize(q *Question, answer string) string {
+	if len(q.Options) > 0 {
+		for _, o := range q.Options {
+			if o == answer {
+				return answer
+			}
+		}
+		if n, err := strconv.Atoi(answer); err == nil && n >= 1 && n <= len(q.Options) {
+			return q.Options[n-1]
+		}
+	}
+
+	switch q.Type {
+	case "boolean":
+		switch strings.ToLower(answer) {
+		case "y", "yes":
+			return "true"
+		case "n", "no":
+			return "false"
+		}
+		if b, err := strconv.ParseBool(answer); err == nil {
+			return strconv.FormatBool(b)
+		}
+	}
+	return answer
+}
@@ -0,0 +1,334 @@
+/*
+Copyright SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package questions implements the questions.yaml files of Rancher charts,
+// describing how to prompt for the values of a chart.
+package questions
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"helm.sh/helm/v3/pkg/chart"
+	"sigs.k8s.io/yaml"
+)
+
+// FileNames are the names of the questions file of a chart, by preference
+var FileNames = []string{"questions.yaml", "questions.yml"}
+
+// Questions is the content of a questions.yaml file
+type Questions struct {
+	Questions []Question `json:"questions"`
+}
+
+// Question describes how to prompt for a value of a chart
+type Question struct {
+	// Variable is the path of the value, e.g: "image.tag"
+	Variable    string      `json:"variable"`
+	Label       string      `json:"label,omitempty"`
+	Description string      `json:"description,omitempty"`
+	Group       string      `json:"group,omitempty"`
+	Type        string      `json:"type,omitempty"`
+	Required    bool        `json:"required,omitempty"`
+	Default     interface{} `json:"default,omitempty"`
+	// Options are the valid answers, e.g: of enum questions
+	Options    []string `json:"options,omitempty"`
+	Min        *float64 `json:"min,omitempty"`
+	Max        *float64 `json:"max,omitempty"`
+	MinLength  int      `json:"min_length,omitempty"`
+	MaxLength  int      `json:"max_length,omitempty"`
+	ValidChars string   `json:"valid_chars,omitempty"`
+
+	// ShowIf is the condition on the other answers for the question to be
+	// asked, e.g: "ingress.enabled=true&&ingress.tls=false"
+	ShowIf string `json:"show_if,omitempty"`
+
+	// ShowSubquestionIf is the answer to the question for its subquestions
+	// to be asked
+	ShowSubquestionIf interface{} `json:"show_subquestion_if,omitempty"`
+	Subquestions      []Question  `json:"subquestions,omitempty"`
+}
+
+// Answers are the answers to questions, by variable. They are saved as they
+// are in Rancher: a YAML map of variables to strings.
+type Answers map[string]string
+
+// Load returns the questions of a chart, or nil if it has none
+func Load(ch *chart.Chart) (*Questions, error) {
+	for _, name := range FileNames {
+		for _, f := range ch.Files {
+			if f.Name != name {
+				continue
+			}
+			qs := &Questions{}
+			if err := yaml.Unmarshal(f.Data, qs); err != nil {
+				return nil, errors.Wrapf(err, "cannot load %s of chart %s", name, ch.Name())
+			}
+			return qs, nil
+		}
+	}
+	return nil, nil
+}
+
+// LoadAnswers reads an answers file
+func LoadAnswers(path string) (Answers, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	answers := Answers{}
+	if err := yaml.Unmarshal(b, &answers); err != nil {
+		return nil, errors.Wrapf(err, "cannot load answers file %s", path)
+	}
+	return answers, nil
+}
+
+// Save writes the answers to path. The file is only readable by the user, as
+// answers may be passwords.
+func (a Answers) Save(path string) error {
+	b, err := yaml.Marshal(a)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, b, 0600)
+}
+
+// All returns all the questions, subquestions included
+func (qs *Questions) All() []Question {
+	var all []Question
+	for _, q := range qs.Questions {
+		all = append(all, q)
+		all = append(all, q.Subquestions...)
+	}
+	return all
+}
+
+// Shown returns true if the question is asked with the answers given so far
+func (q *Question) Shown(answers Answers) bool {
+	return matchCondition(q.ShowIf, answers)
+}
+
+// ShowSubquestions returns true if the subquestions of the question are asked
+// when it is given answer
+func (q *Question) ShowSubquestions(answer string) bool {
+	if q.ShowSubquestionIf == nil {
+		return true
+	}
+	return fmt.Sprint(q.ShowSubquestionIf) == answer
+}
+
+// DefaultAnswer returns the default of the question as an answer
+func (q *Question) DefaultAnswer() string {
+	if q.Default == nil {
+		return ""
+	}
+	return fmt.Sprint(q.Default)
+}
+
+// Validate returns an error if answer is not a valid answer to the question.
+// Empty answers are only valid for questions that are not required.
+func (q *Question) Validate(answer string) error {
+	if answer == "" {
+		if q.Required {
+			return errors.New("an answer is required")
+		}
+		return nil
+	}
+
+	if len(q.Options) > 0 {
+		found := false
+		for _, o := range q.Options {
+			found = found || o == answer
+		}
+		if !found {
+			return errors.Errorf("the answer must be one of: %s", strings.Join(q.Options, ", "))
+		}
+	}
+
+	switch q.Type {
+	case "boolean":
+		if _, err := strconv.ParseBool(answer); err != nil {
+			return errors.New("the answer must be true or false")
+		}
+	case "int":
+		if _, err := strconv.ParseInt(answer, 10, 64); err != nil {
+			return errors.New("the answer must be an integer")
+		}
+	case "float":
+		if _, err := strconv.ParseFloat(answer, 64); err != nil {
+			return errors.New("the answer must be a number")
+		}
+	}
+	if q.Type == "int" || q.Type == "float" {
+		n, _ := strconv.ParseFloat(answer, 64)
+		if q.Min != nil && n < *q.Min {
+			return errors.Errorf("the answer must be at least %s", formatFloat(*q.Min))
+		}
+		if q.Max != nil && n > *q.Max {
+			return errors.Errorf("the answer must be at most %s", formatFloat(*q.Max))
+		}
+	}
+
+	if q.MinLength > 0 && len(answer) < q.MinLength {
+		return errors.Errorf("the answer must be at least %d characters long", q.MinLength)
+	}
+	if q.MaxLength > 0 && len(answer) > q.MaxLength {
+		return errors.Errorf("the answer must be at most %d characters long", q.MaxLength)
+	}
+	if q.ValidChars != "" {
+		for _, c := range answer {
+			if !strings.ContainsRune(q.ValidChars, c) {
+				return errors.Errorf("the answer must only have the characters %q", q.ValidChars)
+			}
+		}
+	}
+	return nil
+}
+
+// Check validates the answers to the questions shown, in order, and returns
+// them. The answers to questions not shown, or to no question at all, are
+// dropped.
+func (qs *Questions) Check(answers Answers) (Answers, error) {
+	result := Answers{}
+	var check func(q *Question) error
+	check = func(q *Question) error {
+		if !q.Shown(result) {
+			return nil
+		}
+		answer, ok := answers[q.Variable]
+		if ok {
+			answer = normalize(q, answer)
+			if err := q.Validate(answer); err != nil {
+				return errors.Wrapf(err, "invalid answer for %s", q.Variable)
+			}
+			result[q.Variable] = answer
+		}
+		if q.ShowSubquestions(answer) {
+			for n := range q.Subquestions {
+				if err := check(&q.Subquestions[n]); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	for n := range qs.Questions {
+		if err := check(&qs.Questions[n]); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// formatFloat formats the bound of a numeric question without trailing zeros
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// Value returns the answer as a value of the type of the question
+func (q *Question) Value(answer string) interface{} {
+	switch q.Type {
+	case "boolean":
+		if b, err := strconv.ParseBool(answer); err == nil {
+			return b
+		}
+	case "int":
+		if n, err := strconv.ParseInt(answer, 10, 64); err == nil {
+			return n
+		}
+	case "float":
+		if f, err := strconv.ParseFloat(answer, 64); err == nil {
+			return f
+		}
+	}
+	return answer
+}
+
+// Apply sets the answers to the questions in vals, at the path of their
+// variables
+func (qs *Questions) Apply(answers Answers, vals map[string]interface{}) {
+	questions := map[string]Question{}
+	for _, q := range qs.All() {
+		questions[q.Variable] = q
+	}
+
+	variables := make([]string, 0, len(answers))
+	for variable := range answers {
+		variables = append(variables, variable)
+	}
+	sort.Strings(variables)
+	for _, variable := range variables {
+		q := questions[variable]
+		SetValue(vals, variable, q.Value(answers[variable]))
+	}
+}
+
+// SetValue sets the value at the dotted path of vals, creating the maps
+// along the path
+func SetValue(vals map[string]interface{}, path string, value interface{}) {
+	keys := strings.Split(path, ".")
+	for _, key := range keys[:len(keys)-1] {
+		next, ok := vals[key].(map[string]interface{})
+		if !ok {
+			next = map[string]interface{}{}
+			vals[key] = next
+		}
+		vals = next
+	}
+	vals[keys[len(keys)-1]] = value
+}
+
+// GetValue returns the value at the dotted path of vals
+func GetValue(vals map[string]interface{}, path string) (interface{}, bool) {
+	keys := strings.Split(path, ".")
+	for _, key := range keys[:len(keys)-1] {
+		next, ok := vals[key].(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		vals = next
+	}
+	v, ok := vals[keys[len(keys)-1]]
+	return v, ok
+}
+
+// matchCondition evaluates a show_if condition against the answers. The
+// condition is made of "variable=value" terms, joined by "&&", and then by
+// "||". An empty condition is always true.
+func matchCondition(cond string, answers Answers) bool {
+	if strings.TrimSpace(cond) == "" {
+		return true
+	}
+	for _, or := range strings.Split(cond, "||") {
+		matched := true
+		for _, and := range strings.Split(or, "&&") {
+			p := strings.SplitN(and, "=", 2)
+			if len(p) != 2 || answers[strings.TrimSpace(p[0])] != strings.TrimSpace(p[1]) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,269 @@
+/*
+Copyright SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package questions
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"helm.sh/helm/v3/pkg/chart"
+
+	"github.com/rancher-sandbox/hypper/internal/test/ensure"
+)
+
+const testQuestions = `questions:
+- variable: image.tag
+  label: Image tag
+  type: string
+  default: 1.0.0
+- variable: replicas
+  type: int
+  min: 1
+  max: 5
+  default: 1
+- variable: logLevel
+  type: enum
+  options: [info, debug]
+  default: info
+- variable: ingress.enabled
+  type: boolean
+  default: false
+  show_subquestion_if: true
+  subquestions:
+  - variable: ingress.host
+    type: hostname
+    required: true
+- variable: ingress.secret
+  type: string
+  show_if: ingress.enabled=true&&ingress.host=example.com||logLevel=debug
+`
+
+func testChart() *chart.Chart {
+	return &chart.Chart{
+		Metadata: &chart.Metadata{Name: "test", Version: "0.1.0"},
+		Files:    []*chart.File{{Name: "questions.yaml", Data: []byte(testQuestions)}},
+	}
+}
+
+func TestLoad(t *testing.T) {
+	is := assert.New(t)
+
+	qs, err := Load(&chart.Chart{Metadata: &chart.Metadata{Name: "test"}})
+	is.NoError(err)
+	is.Nil(qs)
+
+	qs, err = Load(testChart())
+	is.NoError(err)
+	is.Len(qs.Questions, 5)
+	is.Len(qs.All(), 6)
+	is.Equal("1.0.0", qs.Questions[0].DefaultAnswer())
+	is.Equal("1", qs.Questions[1].DefaultAnswer())
+	is.Equal(5.0, *qs.Questions[1].Max)
+
+	_, err = Load(&chart.Chart{
+		Metadata: &chart.Metadata{Name: "test"},
+		Files:    []*chart.File{{Name: "questions.yml", Data: []byte("questions: {}")}},
+	})
+	is.Error(err)
+}
+
+func TestValidate(t *testing.T) {
+	is := assert.New(t)
+
+	qs, err := Load(testChart())
+	is.NoError(err)
+	all := qs.All()
+
+	is.NoError(all[0].Validate(""))
+	is.NoError(all[1].Validate("3"))
+	is.EqualError(all[1].Validate("three"), "the answer must be an integer")
+	is.EqualError(all[1].Validate("0"), "the answer must be at least 1")
+	is.EqualError(all[1].Validate("6"), "the answer must be at most 5")
+	is.NoError(all[2].Validate("debug"))
+	is.EqualError(all[2].Validate("trace"), "the answer must be one of: info, debug")
+	is.EqualError(all[3].Validate("maybe"), "the answer must be true or false")
+	is.EqualError(all[4].Validate(""), "an answer is required")
+
+	q := Question{Variable: "ratio", Type: "float", Min: &[]float64{0.5}[0], Max: &[]float64{1.5}[0]}
+	is.NoError(q.Validate("1.25"))
+	is.EqualError(q.Validate("0.25"), "the answer must be at least 0.5")
+	is.EqualError(q.Validate("2"), "the answer must be at most 1.5")
+	is.EqualError(q.Validate("a lot"), "the answer must be a number")
+
+	q = Question{Variable: "name", MinLength: 2, MaxLength: 4, ValidChars: "abc"}
+	is.EqualError(q.Validate("a"), "the answer must be at least 2 characters long")
+	is.EqualError(q.Validate("abcab"), "the answer must be at most 4 characters long")
+	is.EqualError(q.Validate("abd"), `the answer must only have the characters "abc"`)
+	is.NoError(q.Validate("cab"))
+}
+
+func TestShown(t *testing.T) {
+	is := assert.New(t)
+
+	qs, err := Load(testChart())
+	is.NoError(err)
+	q := qs.Questions[4]
+
+	is.False(q.Shown(Answers{}))
+	is.False(q.Shown(Answers{"ingress.enabled": "true"}))
+	is.True(q.Shown(Answers{"ingress.enabled": "true", "ingress.host": "example.com"}))
+	is.True(q.Shown(Answers{"logLevel": "debug"}))
+	is.True(qs.Questions[0].Shown(Answers{}))
+
+	is.True(qs.Questions[3].ShowSubquestions("true"))
+	is.False(qs.Questions[3].ShowSubquestions("false"))
+}
+
+func TestApply(t *testing.T) {
+	is := assert.New(t)
+
+	qs, err := Load(testChart())
+	is.NoError(err)
+
+	vals := map[string]interface{}{"image": map[string]interface{}{"repository": "nginx"}}
+	qs.Apply(Answers{
+		"image.tag":       "1.1.0",
+		"replicas":        "3",
+		"ingress.enabled": "true",
+		"ingress.host":    "1234",
+		"other":           "value",
+	}, vals)
+	is.Equal(map[string]interface{}{
+		"image":    map[string]interface{}{"repository": "nginx", "tag": "1.1.0"},
+		"replicas": int64(3),
+		"ingress":  map[string]interface{}{"enabled": true, "host": "1234"},
+		"other":    "value",
+	}, vals)
+
+	v, ok := GetValue(vals, "image.tag")
+	is.True(ok)
+	is.Equal("1.1.0", v)
+	_, ok = GetValue(vals, "image.tag.name")
+	is.False(ok)
+}
+
+func TestCheck(t *testing.T) {
+	is := assert.New(t)
+
+	qs, err := Load(testChart())
+	is.NoError(err)
+
+	answers, err := qs.Check(Answers{
+		"replicas":        "3",
+		"logLevel":        "2",
+		"ingress.enabled": "false",
+		"ingress.host":    "example.com",
+		"ingress.secret":  "my-secret",
+		"other":           "value",
+	})
+	is.NoError(err)
+	is.Equal(Answers{"replicas": "3", "logLevel": "debug", "ingress.enabled": "false", "ingress.secret": "my-secret"}, answers)
+
+	_, err = qs.Check(Answers{"replicas": "abc"})
+	is.EqualError(err, "invalid answer for replicas: the answer must be an integer")
+	_, err = qs.Check(Answers{"ingress.enabled": "true", "ingress.host": ""})
+	is.EqualError(err, "invalid answer for ingress.host: an answer is required")
+}
+
+func TestAsk(t *testing.T) {
+	is := assert.New(t)
+
+	qs, err := Load(testChart())
+	is.NoError(err)
+
+	// image.tag from the defaults, replicas invalid then valid, logLevel by
+	// number, ingress.enabled with a shortcut, and the required host
+	in := strings.NewReader("\n9\n2\n2\ny\n\nexample.com\nmy-secret\n")
+	var out bytes.Buffer
+	p := NewPrompter(in, &out, true)
+	answers, err := p.Ask(qs, Answers{}, func(q *Question) string {
+		if q.Variable == "image.tag" {
+			return "1.2.0"
+		}
+		return ""
+	})
+	is.NoError(err)
+	is.Equal(Answers{
+		"image.tag":       "1.2.0",
+		"replicas":        "2",
+		"logLevel":        "debug",
+		"ingress.enabled": "true",
+		"ingress.host":    "example.com",
+		"ingress.secret":  "my-secret",
+	}, answers)
+	is.Contains(out.String(), " Image tag [1.2.0]: ")
+	is.Contains(out.String(), "the answer must be at most 5")
+	is.Contains(out.String(), "an answer is required")
+	is.Contains(out.String(), "  2) debug\n")
+
+	// answered questions are not asked, and questions not shown neither
+	out.Reset()
+	answers, err = NewPrompter(strings.NewReader(""), &out, true).Ask(qs, Answers{
+		"image.tag":       "1.0.0",
+		"replicas":        "1",
+		"logLevel":        "info",
+		"ingress.enabled": "false",
+	}, nil)
+	is.NoError(err)
+	is.Len(answers, 4)
+	is.Empty(out.String())
+
+	// invalid answers are asked again, and answers to questions not shown
+	// are dropped
+	out.Reset()
+	answers, err = NewPrompter(strings.NewReader("2\n"), &out, true).Ask(qs, Answers{
+		"image.tag":       "1.0.0",
+		"replicas":        "9",
+		"logLevel":        "info",
+		"ingress.enabled": "n",
+		"ingress.host":    "example.com",
+	}, nil)
+	is.NoError(err)
+	is.Equal(Answers{
+		"image.tag":       "1.0.0",
+		"replicas":        "2",
+		"logLevel":        "info",
+		"ingress.enabled": "false",
+	}, answers)
+	is.Contains(out.String(), "invalid answer for replicas: the answer must be at most 5")
+
+	// running out of answers is an error
+	_, err = NewPrompter(strings.NewReader("1.0.0\n"), &out, true).Ask(qs, Answers{}, nil)
+	is.EqualError(err, "no answer for replicas")
+}
+
+func TestAnswersSave(t *testing.T) {
+	is := assert.New(t)
+
+	dir := ensure.TempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "answers.yaml")
+
+	answers := Answers{"image.tag": "1.0.0", "ingress.enabled": "true"}
+	is.NoError(answers.Save(path))
+	fi, err := os.Stat(path)
+	is.NoError(err)
+	is.Equal(os.FileMode(0600), fi.Mode().Perm())
+
+	loaded, err := LoadAnswers(path)
+	is.NoError(err)
+	is.Equal(answers, loaded)
+}
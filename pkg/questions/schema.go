@@ -0,0 +1,177 @@
+/*
+Copyright SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package questions
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/pkg/errors"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+)
+
+// schemaTypes are the question types of the JSON schema types
+var schemaTypes = map[string]string{
+	"string":  "string",
+	"integer": "int",
+	"number":  "float",
+	"boolean": "boolean",
+}
+
+// FromSchema returns the questions for the required properties of the
+// values.schema.json of a chart that are missing from vals, once coalesced
+// with the values of the chart. It returns nil if the chart has no schema.
+//
+// Properties of objects are only required if the object is required or
+// present in the values. Required properties of types other than strings,
+// numbers and booleans cannot be asked.
+func FromSchema(ch *chart.Chart, vals map[string]interface{}) (*Questions, error) {
+	if len(ch.Schema) == 0 {
+		return nil, nil
+	}
+	schema := map[string]interface{}{}
+	if err := json.Unmarshal(ch.Schema, &schema); err != nil {
+		return nil, errors.Wrapf(err, "cannot load values.schema.json of chart %s", ch.Name())
+	}
+	coalesced, err := chartutil.CoalesceValues(ch, vals)
+	if err != nil {
+		return nil, err
+	}
+
+	qs := &Questions{}
+	if err := schemaQuestions(qs, schema, "", coalesced); err != nil {
+		return nil, errors.Wrapf(err, "cannot prompt for the values of chart %s", ch.Name())
+	}
+	return qs, nil
+}
+
+// schemaQuestions adds to qs the questions for the required properties of
+// the object schema at path that are missing from vals, the values at path
+func schemaQuestions(qs *Questions, schema map[string]interface{}, path string, vals map[string]interface{}) error {
+	props, _ := schema["properties"].(map[string]interface{})
+
+	// required properties are walked first, in order, and then the others
+	// sorted, so questions are always asked in the same order
+	var names []string
+	required := map[string]bool{}
+	if req, ok := schema["required"].([]interface{}); ok {
+		for _, r := range req {
+			if name, ok := r.(string); ok && !required[name] {
+				names = append(names, name)
+				required[name] = true
+			}
+		}
+	}
+	others := []string{}
+	for name := range props {
+		if !required[name] {
+			others = append(others, name)
+		}
+	}
+	sort.Strings(others)
+	names = append(names, others...)
+
+	for _, name := range names {
+		prop, _ := props[name].(map[string]interface{})
+		variable := name
+		if path != "" {
+			variable = path + "." + name
+		}
+		val, present := vals[name]
+
+		if schemaType(prop) == "object" {
+			sub, ok := val.(map[string]interface{})
+			if !ok {
+				if (present && val != nil) || !required[name] {
+					continue
+				}
+				sub = map[string]interface{}{}
+			}
+			if err := schemaQuestions(qs, prop, variable, sub); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if !required[name] || (present && val != nil) {
+			continue
+		}
+		q, err := schemaQuestion(prop, variable)
+		if err != nil {
+			return err
+		}
+		qs.Questions = append(qs.Questions, q)
+	}
+	return nil
+}
+
+// schemaQuestion returns the question for the property schema prop
+func schemaQuestion(prop map[string]interface{}, variable string) (Question, error) {
+	q := Question{Variable: variable, Required: true, Default: prop["default"]}
+	q.Label, _ = prop["title"].(string)
+	q.Description, _ = prop["description"].(string)
+
+	t := schemaType(prop)
+	if t == "" && prop["enum"] != nil {
+		t = "string"
+	}
+	qt, ok := schemaTypes[t]
+	if !ok {
+		return q, errors.Errorf("%s is required, but %q values cannot be prompted for", variable, t)
+	}
+	q.Type = qt
+
+	if enum, ok := prop["enum"].([]interface{}); ok {
+		for _, e := range enum {
+			q.Options = append(q.Options, fmt.Sprint(e))
+		}
+	}
+	if n, ok := prop["minimum"].(float64); ok {
+		q.Min = &n
+	}
+	if n, ok := prop["maximum"].(float64); ok {
+		q.Max = &n
+	}
+	if n, ok := prop["minLength"].(float64); ok {
+		q.MinLength = int(n)
+	}
+	if n, ok := prop["maxLength"].(float64); ok {
+		q.MaxLength = int(n)
+	}
+	return q, nil
+}
+
+// schemaType returns the type of the property schema prop, the first one
+// other than null when it has several
+func schemaType(prop map[string]interface{}) string {
+	switch t := prop["type"].(type) {
+	case string:
+		return t
+	case []interface{}:
+		for _, e := range t {
+			if s, ok := e.(string); ok && s != "null" {
+				return s
+			}
+		}
+	}
+	if _, ok := prop["properties"]; ok {
+		return "object"
+	}
+	return ""
+}
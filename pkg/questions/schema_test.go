@@ -0,0 +1,135 @@
+/*
+Copyright SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package questions
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"helm.sh/helm/v3/pkg/chart"
+)
+
+const testSchema = `{
+  "$schema": "http://json-schema.org/draft-07/schema#",
+  "type": "object",
+  "required": ["name", "replicas", "database"],
+  "properties": {
+    "name": {"type": "string", "title": "Name", "minLength": 3},
+    "replicas": {"type": "integer", "minimum": 1, "maximum": 3, "default": 1},
+    "debug": {"type": "boolean"},
+    "database": {
+      "type": "object",
+      "required": ["engine", "port"],
+      "properties": {
+        "engine": {"enum": ["mariadb", "postgresql"]},
+        "port": {"type": ["integer", "null"], "enum": [3306, 5432]}
+      }
+    },
+    "ingress": {
+      "type": "object",
+      "required": ["host"],
+      "properties": {"host": {"type": "string", "description": "Hostname"}}
+    }
+  }
+}`
+
+func schemaChart(values map[string]interface{}) *chart.Chart {
+	return &chart.Chart{
+		Metadata: &chart.Metadata{Name: "test", Version: "0.1.0"},
+		Values:   values,
+		Schema:   []byte(testSchema),
+	}
+}
+
+func TestFromSchema(t *testing.T) {
+	is := assert.New(t)
+
+	qs, err := FromSchema(&chart.Chart{Metadata: &chart.Metadata{Name: "test"}}, nil)
+	is.NoError(err)
+	is.Nil(qs)
+
+	// the values of the chart are not missing, and the ingress is not
+	// required when absent
+	qs, err = FromSchema(schemaChart(map[string]interface{}{"replicas": 2}), map[string]interface{}{})
+	is.NoError(err)
+	is.Equal([]Question{
+		{Variable: "name", Label: "Name", Type: "string", Required: true, MinLength: 3},
+		{Variable: "database.engine", Type: "string", Required: true, Options: []string{"mariadb", "postgresql"}},
+		{Variable: "database.port", Type: "int", Required: true, Options: []string{"3306", "5432"}},
+	}, qs.Questions)
+
+	// given values are not missing, and objects given are walked
+	qs, err = FromSchema(schemaChart(nil), map[string]interface{}{
+		"name":     "my-app",
+		"database": map[string]interface{}{"engine": "mariadb"},
+		"ingress":  map[string]interface{}{},
+	})
+	is.NoError(err)
+	variables := []string{}
+	for _, q := range qs.Questions {
+		variables = append(variables, q.Variable)
+	}
+	is.Equal([]string{"replicas", "database.port", "ingress.host"}, variables)
+	is.Equal(1.0, *qs.Questions[0].Min)
+	is.Equal(3.0, *qs.Questions[0].Max)
+	is.Equal("1", qs.Questions[0].DefaultAnswer())
+	is.Equal("Hostname", qs.Questions[2].Description)
+
+	// the answers are typed after the schema
+	vals := map[string]interface{}{}
+	qs.Apply(Answers{"replicas": "2", "database.port": "5432", "ingress.host": "example.com"}, vals)
+	is.Equal(map[string]interface{}{
+		"replicas": int64(2),
+		"database": map[string]interface{}{"port": int64(5432)},
+		"ingress":  map[string]interface{}{"host": "example.com"},
+	}, vals)
+	is.EqualError(qs.Questions[1].Validate("3307"), "the answer must be one of: 3306, 5432")
+}
+
+func TestFromSchemaNumberBounds(t *testing.T) {
+	is := assert.New(t)
+
+	ch := &chart.Chart{
+		Metadata: &chart.Metadata{Name: "test"},
+		Schema: []byte(`{"required": ["ratio", "workers"], "properties": {
+  "ratio": {"type": "number", "minimum": 0.1, "maximum": 0.9},
+  "workers": {"type": "integer", "minimum": 1.5}
+}}`),
+	}
+	qs, err := FromSchema(ch, map[string]interface{}{})
+	is.NoError(err)
+	is.NoError(qs.Questions[0].Validate("0.5"))
+	is.EqualError(qs.Questions[0].Validate("0.05"), "the answer must be at least 0.1")
+	is.EqualError(qs.Questions[0].Validate("0.95"), "the answer must be at most 0.9")
+	is.NoError(qs.Questions[1].Validate("2"))
+	is.EqualError(qs.Questions[1].Validate("1"), "the answer must be at least 1.5")
+}
+
+func TestFromSchemaUnsupportedType(t *testing.T) {
+	is := assert.New(t)
+
+	ch := &chart.Chart{
+		Metadata: &chart.Metadata{Name: "test"},
+		Schema:   []byte(`{"required": ["hosts"], "properties": {"hosts": {"type": "array"}}}`),
+	}
+	_, err := FromSchema(ch, map[string]interface{}{})
+	is.EqualError(err, `cannot prompt for the values of chart test: hosts is required, but "array" values cannot be prompted for`)
+
+	ch.Schema = []byte("{")
+	_, err = FromSchema(ch, map[string]interface{}{})
+	is.Error(err)
+}
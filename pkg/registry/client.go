@@ -0,0 +1,112 @@
+/*
+Copyright The Helm Authors, SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package registry
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+
+	"github.com/deislabs/oras/pkg/auth"
+	authDocker "github.com/deislabs/oras/pkg/auth/docker"
+	"github.com/pkg/errors"
+
+	"github.com/rancher-sandbox/hypper/pkg/hypperpath"
+)
+
+// CredentialsFileBasename is the filename for the auth credentials file
+const CredentialsFileBasename = "registry.json"
+
+// ErrNotLoggedIn indicates that there are no credentials stored for a host.
+var ErrNotLoggedIn = auth.ErrNotLoggedIn
+
+// Client works with OCI-compliant registries.
+//
+// Helm's registry client lives in an internal package, so Hypper carries its
+// own. Credentials are stored in the file pointed by EnvSettings.RegistryConfig,
+// using the same format as ~/.docker/config.json.
+type Client struct {
+	// path to the credentials file e.g. ~/.config/hypper/registry.json
+	credentialsFile string
+	out             io.Writer
+	authorizer      auth.Client
+}
+
+// ClientOption allows specifying various settings configurable by the user for overriding the defaults
+// used when creating a new default client
+type ClientOption func(*Client)
+
+// ClientOptWriter returns a function that sets the writer setting on client options set
+func ClientOptWriter(out io.Writer) ClientOption {
+	return func(client *Client) {
+		client.out = out
+	}
+}
+
+// ClientOptCredentialsFile returns a function that sets the credentials file setting on a client options set
+func ClientOptCredentialsFile(credentialsFile string) ClientOption {
+	return func(client *Client) {
+		client.credentialsFile = credentialsFile
+	}
+}
+
+// NewClient returns a new registry client with config
+func NewClient(opts ...ClientOption) (*Client, error) {
+	client := &Client{
+		out: ioutil.Discard,
+	}
+	for _, opt := range opts {
+		opt(client)
+	}
+	if client.credentialsFile == "" {
+		client.credentialsFile = hypperpath.ConfigPath(CredentialsFileBasename)
+	}
+	authClient, err := authDocker.NewClient(client.credentialsFile)
+	if err != nil {
+		return nil, err
+	}
+	client.authorizer = authClient
+	return client, nil
+}
+
+// CredentialsFile returns the path of the file where credentials are stored
+func (c *Client) CredentialsFile() string {
+	return c.credentialsFile
+}
+
+// Login logs into a registry, storing the credentials on success
+func (c *Client) Login(hostname, username, password string, insecure bool) error {
+	err := c.authorizer.Login(context.Background(), hostname, username, password, insecure)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(c.out, "Login succeeded\n")
+	return err
+}
+
+// Logout logs out of a registry, removing its stored credentials
+func (c *Client) Logout(hostname string) error {
+	err := c.authorizer.Logout(context.Background(), hostname)
+	if errors.Is(err, auth.ErrNotLoggedIn) {
+		return errors.Wrapf(ErrNotLoggedIn, "cannot logout from %s", hostname)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(c.out, "Logout succeeded\n")
+	return err
+}
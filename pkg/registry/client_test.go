@@ -0,0 +1,90 @@
+/*
+Copyright The Helm Authors, SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package registry
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+
+	"github.com/rancher-sandbox/hypper/internal/test/ensure"
+)
+
+// newTestRegistry starts a server that answers the registry v2 ping without
+// requiring authentication.
+func newTestRegistry(t *testing.T) string {
+	t.Helper()
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Docker-Distribution-API-Version", "registry/2.0")
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(srv.Close)
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u.Host
+}
+
+func TestLoginLogout(t *testing.T) {
+	host := newTestRegistry(t)
+	credentialsFile := filepath.Join(ensure.TempDir(t), CredentialsFileBasename)
+
+	var out bytes.Buffer
+	c, err := NewClient(ClientOptWriter(&out), ClientOptCredentialsFile(credentialsFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.CredentialsFile() != credentialsFile {
+		t.Errorf("expected credentials file %q, got %q", credentialsFile, c.CredentialsFile())
+	}
+
+	if err := c.Login(host, "myuser", "mypass", true); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "Login succeeded") {
+		t.Errorf("expected login message, got %q", out.String())
+	}
+
+	b, err := ioutil.ReadFile(credentialsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), host) {
+		t.Errorf("expected %s to be stored in the credentials file, got %s", host, b)
+	}
+
+	// A new client reads the stored credentials
+	c2, err := NewClient(ClientOptCredentialsFile(credentialsFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c2.Logout(host); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c2.Logout(host); !errors.Is(err, ErrNotLoggedIn) {
+		t.Errorf("expected ErrNotLoggedIn, got %v", err)
+	}
+}
@@ -1,7 +1,11 @@
 package repo
 
 import (
+	"io/ioutil"
 	"net/url"
+	"os"
+	"path"
+	"path/filepath"
 
 	"github.com/pkg/errors"
 	"github.com/rancher-sandbox/hypper/pkg/hypperpath"
@@ -14,21 +18,34 @@ import (
 // ChartRepository is a composite type of Helm's repo.ChartRepository
 type ChartRepository struct {
 	helmRepo.ChartRepository
+
+	// Verify rejects indexes without a valid signature from a key in Keyring
+	Verify bool
+	// Keyring is the path to the public keyring used to verify the index signature
+	Keyring string
 }
 
 // NewChartRepository constructs ChartRepository
+//
+// Besides the schemes of getters, file:// URLs of local directories are
+// supported.
 func NewChartRepository(cfg *helmRepo.Entry, getters getter.Providers) (*ChartRepository, error) {
 	u, err := url.Parse(cfg.URL)
 	if err != nil {
 		return nil, errors.Errorf("invalid chart URL format: %s", cfg.URL)
 	}
 
-	client, err := getters.ByScheme(u.Scheme)
-	if err != nil {
-		return nil, errors.Errorf("could not find protocol handler for: %s", u.Scheme)
+	var client getter.Getter
+	if u.Scheme == FileScheme {
+		client = &fileGetter{}
+	} else {
+		client, err = getters.ByScheme(u.Scheme)
+		if err != nil {
+			return nil, errors.Errorf("could not find protocol handler for: %s", u.Scheme)
+		}
 	}
 	return &ChartRepository{
-		helmRepo.ChartRepository{
+		ChartRepository: helmRepo.ChartRepository{
 			Config:    cfg,
 			IndexFile: helmRepo.NewIndexFile(),
 			Client:    client,
@@ -37,3 +54,124 @@ func NewChartRepository(cfg *helmRepo.Entry, getters getter.Providers) (*ChartRe
 	}, nil
 
 }
+
+// NewChartRepositoryFromEntry constructs a ChartRepository for an entry of the
+// repositories file, honoring its hypper specific settings.
+//
+// The credentials of entries with a credential helper are fetched from it.
+func NewChartRepositoryFromEntry(cfg *Entry, getters getter.Providers) (*ChartRepository, error) {
+	entry := cfg.Entry
+	if cfg.CredentialHelper != "" {
+		username, password, err := cfg.Credentials()
+		if err != nil {
+			return nil, err
+		}
+		entry.Username = username
+		entry.Password = password
+	}
+	r, err := NewChartRepository(&entry, getters)
+	if err != nil {
+		return nil, err
+	}
+	r.Verify = cfg.Verify
+	r.Keyring = cfg.Keyring
+	return r, nil
+}
+
+// DownloadIndexFile fetches the index from a repository.
+//
+// When Verify is set, the detached signature of the index is fetched too, and
+// the index only replaces the cached one if the signature is valid.
+func (r *ChartRepository) DownloadIndexFile() (string, error) {
+	if !r.Verify {
+		return r.ChartRepository.DownloadIndexFile()
+	}
+
+	// Download into a scratch cache, so an index failing the verification
+	// never replaces a trusted one
+	cachePath := r.CachePath
+	tmp, err := ioutil.TempDir("", "hypper-index-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmp)
+	r.CachePath = tmp
+	fname, err := r.ChartRepository.DownloadIndexFile()
+	r.CachePath = cachePath
+	if err != nil {
+		return "", err
+	}
+
+	index, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return "", err
+	}
+	signature, err := r.downloadIndexSignature()
+	if err != nil {
+		return "", errors.Wrapf(ErrNoIndexSignature, "%s: %s", r.Config.Name, err)
+	}
+	if _, err := VerifyIndex(index, signature, r.Keyring); err != nil {
+		return "", errors.Wrapf(err, "%s", r.Config.Name)
+	}
+
+	if err := os.MkdirAll(cachePath, 0755); err != nil {
+		return "", err
+	}
+	for _, f := range []string{hypperpath.CacheIndexFile(r.Config.Name), hypperpath.CacheChartsFile(r.Config.Name)} {
+		b, err := ioutil.ReadFile(filepath.Join(tmp, f))
+		if err != nil {
+			return "", err
+		}
+		if err := ioutil.WriteFile(filepath.Join(cachePath, f), b, 0644); err != nil {
+			return "", err
+		}
+	}
+	return filepath.Join(cachePath, hypperpath.CacheIndexFile(r.Config.Name)), nil
+}
+
+func (r *ChartRepository) downloadIndexSignature() ([]byte, error) {
+	parsedURL, err := url.Parse(r.Config.URL)
+	if err != nil {
+		return nil, err
+	}
+	parsedURL.RawPath = path.Join(parsedURL.RawPath, "index.yaml"+IndexSignatureExt)
+	parsedURL.Path = path.Join(parsedURL.Path, "index.yaml"+IndexSignatureExt)
+	return r.get(parsedURL.String())
+}
+
+// get fetches u with the TLS settings of the repository.
+//
+// The credentials of the repository are only sent along when u is on the
+// same scheme and host as the repository, so that index entries pointing
+// elsewhere do not get them.
+func (r *ChartRepository) get(u string) ([]byte, error) {
+	// Getters keep the options of previous calls, so the credentials have to
+	// be cleared explicitly
+	username, password := "", ""
+	if sameHost(r.Config.URL, u) {
+		username, password = r.Config.Username, r.Config.Password
+	}
+	resp, err := r.Client.Get(u,
+		getter.WithURL(r.Config.URL),
+		getter.WithInsecureSkipVerifyTLS(r.Config.InsecureSkipTLSverify),
+		getter.WithTLSClientConfig(r.Config.CertFile, r.Config.KeyFile, r.Config.CAFile),
+		getter.WithBasicAuth(username, password),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(resp)
+}
+
+// sameHost returns true if both URLs have the same scheme and host
+func sameHost(a, b string) bool {
+	ua, err := url.Parse(a)
+	if err != nil {
+		return false
+	}
+	ub, err := url.Parse(b)
+	if err != nil {
+		return false
+	}
+	return ua.Scheme == ub.Scheme && ua.Host == ub.Host
+}
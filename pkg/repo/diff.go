@@ -0,0 +1,158 @@
+/*
+Copyright SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package repo
+
+import (
+	"reflect"
+	"sort"
+
+	"github.com/Masterminds/semver/v3"
+	helmRepo "helm.sh/helm/v3/pkg/repo"
+
+	"github.com/rancher-sandbox/hypper/pkg/chartcache"
+)
+
+// ChangeType is the kind of change of a chart version between two indexes
+type ChangeType string
+
+const (
+	// ChangeAdded is a chart version only present in the new index
+	ChangeAdded ChangeType = "added"
+	// ChangeRemoved is a chart version only present in the old index
+	ChangeRemoved ChangeType = "removed"
+	// ChangeModified is a chart version present in both indexes, with
+	// different contents
+	ChangeModified ChangeType = "modified"
+)
+
+// ChartVersionChange is a chart version that differs between two indexes
+type ChartVersionChange struct {
+	Name    string     `json:"name"`
+	Version string     `json:"version"`
+	Change  ChangeType `json:"change"`
+
+	// OldDigest and NewDigest are the digests of the archive in the old and
+	// new index. Only one of them is set for added and removed versions.
+	OldDigest string `json:"old_digest,omitempty"`
+	NewDigest string `json:"new_digest,omitempty"`
+
+	// Fields are the parts of a modified entry that changed: "digest",
+	// "urls" and "metadata".
+	Fields []string `json:"fields,omitempty"`
+}
+
+// DigestChanged returns true when the archive of a modified chart version
+// is not the same in both indexes.
+func (c *ChartVersionChange) DigestChanged() bool {
+	return c.Change == ChangeModified && chartcache.NormalizeDigest(c.OldDigest) != chartcache.NormalizeDigest(c.NewDigest)
+}
+
+// DiffIndex lists the chart versions added, removed or modified from old to
+// new, sorted by chart name and version.
+//
+// The creation time of the entries is not compared, as it changes every time
+// a repository is indexed.
+func DiffIndex(old, new *IndexFile) []*ChartVersionChange {
+	oldVersions := indexVersions(old)
+	newVersions := indexVersions(new)
+
+	changes := []*ChartVersionChange{}
+	for key, o := range oldVersions {
+		n, ok := newVersions[key]
+		if !ok {
+			changes = append(changes, &ChartVersionChange{
+				Name:      o.Name,
+				Version:   o.Version,
+				Change:    ChangeRemoved,
+				OldDigest: o.Digest,
+			})
+			continue
+		}
+		if fields := changedFields(o, n); len(fields) > 0 {
+			changes = append(changes, &ChartVersionChange{
+				Name:      o.Name,
+				Version:   o.Version,
+				Change:    ChangeModified,
+				OldDigest: o.Digest,
+				NewDigest: n.Digest,
+				Fields:    fields,
+			})
+		}
+	}
+	for key, n := range newVersions {
+		if _, ok := oldVersions[key]; !ok {
+			changes = append(changes, &ChartVersionChange{
+				Name:      n.Name,
+				Version:   n.Version,
+				Change:    ChangeAdded,
+				NewDigest: n.Digest,
+			})
+		}
+	}
+
+	sort.SliceStable(changes, func(a, b int) bool {
+		if changes[a].Name != changes[b].Name {
+			return changes[a].Name < changes[b].Name
+		}
+		return lessVersion(changes[a].Version, changes[b].Version)
+	})
+	return changes
+}
+
+type chartVersionKey struct {
+	name, version string
+}
+
+func indexVersions(index *IndexFile) map[chartVersionKey]*helmRepo.ChartVersion {
+	versions := map[chartVersionKey]*helmRepo.ChartVersion{}
+	if index == nil || index.IndexFile == nil {
+		return versions
+	}
+	for name, cvs := range index.Entries {
+		for _, cv := range cvs {
+			versions[chartVersionKey{name, cv.Version}] = cv
+		}
+	}
+	return versions
+}
+
+func changedFields(o, n *helmRepo.ChartVersion) []string {
+	fields := []string{}
+	if chartcache.NormalizeDigest(o.Digest) != chartcache.NormalizeDigest(n.Digest) {
+		fields = append(fields, "digest")
+	}
+	if !reflect.DeepEqual(o.URLs, n.URLs) {
+		fields = append(fields, "urls")
+	}
+	if !reflect.DeepEqual(o.Metadata, n.Metadata) {
+		fields = append(fields, "metadata")
+	}
+	return fields
+}
+
+// lessVersion orders semantic versions, falling back to plain strings for
+// versions that do not parse.
+func lessVersion(a, b string) bool {
+	va, erra := semver.NewVersion(a)
+	vb, errb := semver.NewVersion(b)
+	if erra != nil || errb != nil || va.Equal(vb) {
+		// Versions equal as semver (e.g: 1.0.0 and v1.0.0) are ordered by
+		// their raw string, so the order does not depend on the map order
+		return a < b
+	}
+	return va.LessThan(vb)
+}
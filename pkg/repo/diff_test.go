@@ -0,0 +1,83 @@
+/*
+Copyright SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package repo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"helm.sh/helm/v3/pkg/chart"
+)
+
+func TestDiffIndex(t *testing.T) {
+	is := assert.New(t)
+
+	md := func(name, version, description string) *chart.Metadata {
+		return &chart.Metadata{APIVersion: chart.APIVersionV2, Name: name, Version: version, Description: description}
+	}
+
+	old := NewIndexFile()
+	old.Add(md("mariadb", "9.0.0", ""), "mariadb-9.0.0.tgz", "", "sha256:aaa")
+	old.Add(md("mariadb", "10.0.0", ""), "mariadb-10.0.0.tgz", "", "sha256:bbb")
+	old.Add(md("mariadb", "9.1.0", ""), "mariadb-9.1.0.tgz", "", "sha256:ccc")
+	old.Add(md("nginx", "1.0.0", ""), "nginx-1.0.0.tgz", "", "sha256:ddd")
+
+	new := NewIndexFile()
+	// unchanged, apart from the digest prefix and the creation time
+	new.Add(md("mariadb", "9.0.0", ""), "mariadb-9.0.0.tgz", "", "aaa")
+	// rebuilt archive
+	new.Add(md("mariadb", "10.0.0", ""), "mariadb-10.0.0.tgz", "", "sha256:eee")
+	// only the metadata changed
+	new.Add(md("mariadb", "9.1.0", "new description"), "mariadb-9.1.0.tgz", "", "sha256:ccc")
+	new.Add(md("nginx", "1.1.0", ""), "nginx-1.1.0.tgz", "", "sha256:fff")
+
+	changes := DiffIndex(old, new)
+	is.Equal([]*ChartVersionChange{
+		{Name: "mariadb", Version: "9.1.0", Change: ChangeModified, OldDigest: "sha256:ccc", NewDigest: "sha256:ccc", Fields: []string{"metadata"}},
+		{Name: "mariadb", Version: "10.0.0", Change: ChangeModified, OldDigest: "sha256:bbb", NewDigest: "sha256:eee", Fields: []string{"digest"}},
+		{Name: "nginx", Version: "1.0.0", Change: ChangeRemoved, OldDigest: "sha256:ddd"},
+		{Name: "nginx", Version: "1.1.0", Change: ChangeAdded, NewDigest: "sha256:fff"},
+	}, changes)
+
+	is.False(changes[0].DigestChanged())
+	is.True(changes[1].DigestChanged())
+	is.False(changes[2].DigestChanged())
+
+	is.Empty(DiffIndex(old, old))
+	is.Len(DiffIndex(NewIndexFile(), old), 4)
+}
+
+func TestDiffIndexEqualVersions(t *testing.T) {
+	md := func(version string) *chart.Metadata {
+		return &chart.Metadata{APIVersion: chart.APIVersionV2, Name: "mariadb", Version: version}
+	}
+
+	old := NewIndexFile()
+	new := NewIndexFile()
+	for _, v := range []string{"v1.0.0", "1.0.0+b", "1.0.0", "1.0.0+a"} {
+		new.Add(md(v), "mariadb-"+v+".tgz", "", "sha256:aaa")
+	}
+
+	// the order must not depend on the order of the map iteration
+	for n := 0; n < 20; n++ {
+		var versions []string
+		for _, c := range DiffIndex(old, new) {
+			versions = append(versions, c.Version)
+		}
+		assert.Equal(t, []string{"1.0.0", "1.0.0+a", "1.0.0+b", "v1.0.0"}, versions)
+	}
+}
@@ -22,10 +22,14 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"runtime"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/rancher-sandbox/hypper/internal/third-party/helm/urlutil"
+	"github.com/rancher-sandbox/hypper/pkg/chartcache"
 	"helm.sh/helm/v3/pkg/chart"
 	helmRepo "helm.sh/helm/v3/pkg/repo"
 	"sigs.k8s.io/yaml"
@@ -95,52 +99,324 @@ func (i *IndexFile) Merge(f *IndexFile) {
 	i.IndexFile.Merge(f.IndexFile)
 }
 
-// IndexDirectory reads a (flat) directory and generates an index.
+// IndexOptions tunes how IndexDirectoryWithOptions generates an index
+type IndexOptions struct {
+	// Previous is an index generated before for the same directory, e.g: the
+	// one passed to --merge. The entries of archives not modified since it
+	// was generated, and whose digest still matches, are reused instead of
+	// loading the archives again.
+	Previous *IndexFile
+
+	// Cache remembers the entries of the archives by size and modification
+	// time. Unchanged archives are not loaded again, and the cache is updated
+	// with the archives that had to be loaded.
+	Cache *IndexCache
+
+	// Include, if not empty, restricts the archives indexed to those matching
+	// at least one of these glob patterns.
+	Include []string
+
+	// Exclude lists glob patterns of archives and directories to skip.
+	Exclude []string
+
+	// Jobs is the number of archives loaded in parallel. When lower than 1,
+	// the number of CPUs is used.
+	Jobs int
+}
+
+// IndexReport describes how the archives of a directory were indexed
+type IndexReport struct {
+	// Loaded are the archives that were read from disk
+	Loaded []string
+	// Reused are the archives whose entries came from the previous index or the cache
+	Reused []string
+	// Skipped are the archives that could not be loaded as charts
+	Skipped []SkippedArchive
+}
+
+// SkippedArchive is an archive left out of an index, and the reason for it
+type SkippedArchive struct {
+	Path string
+	Err  error
+}
+
+// IndexDirectory reads a directory and its subdirectories, at any depth, and
+// generates an index.
 //
 // It indexes only charts that have been packaged (*.tgz).
 //
 // The index returned will be in an unsorted state
 func IndexDirectory(dir, baseURL string) (*IndexFile, error) {
-	archives, err := filepath.Glob(filepath.Join(dir, "*.tgz"))
+	index, _, err := IndexDirectoryWithOptions(dir, baseURL, IndexOptions{})
+	return index, err
+}
+
+// IndexDirectoryWithOptions reads a directory and generates an index, skipping
+// the archives that did not change according to the given options.
+//
+// The entries are created at the modification time of their archives, or at
+// the creation time of their previous entries when the archives did not change.
+//
+// Include and exclude patterns use the filepath.Match syntax. Patterns without
+// a slash are matched against the file or directory name, otherwise against
+// the slash separated path relative to dir.
+//
+// The index returned will be in an unsorted state
+func IndexDirectoryWithOptions(dir, baseURL string, opts IndexOptions) (*IndexFile, *IndexReport, error) {
+	report := &IndexReport{}
+	archives, err := findArchives(dir, opts.Include, opts.Exclude)
 	if err != nil {
-		return nil, err
+		return nil, report, err
 	}
-	moreArchives, err := filepath.Glob(filepath.Join(dir, "**/*.tgz"))
-	if err != nil {
-		return nil, err
+
+	previous := map[string]*helmRepo.ChartVersion{}
+	if opts.Previous != nil {
+		for _, cvs := range opts.Previous.Entries {
+			for _, cv := range cvs {
+				if len(cv.URLs) > 0 {
+					previous[cv.URLs[0]] = cv
+				}
+			}
+		}
+	}
+
+	// Archives are loaded by a pool of workers, but the results are added to
+	// the index in the order the archives were found, so the index is the same
+	// no matter how many jobs are used.
+	results := make([]archiveResult, len(archives))
+	jobs := opts.Jobs
+	if jobs < 1 {
+		jobs = runtime.NumCPU()
+	}
+	queue := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < jobs; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := range queue {
+				results[n] = loadArchive(dir, baseURL, archives[n], opts, previous)
+			}
+		}()
 	}
-	archives = append(archives, moreArchives...)
+	for n := range archives {
+		queue <- n
+	}
+	close(queue)
+	wg.Wait()
 
 	index := NewIndexFile()
-	for _, arch := range archives {
-		fname, err := filepath.Rel(dir, arch)
-		if err != nil {
-			return index, err
+	for _, r := range results {
+		if r.err != nil {
+			return index, report, r.err
+		}
+		switch {
+		case r.skipErr != nil:
+			// Assume this is not a chart.
+			report.Skipped = append(report.Skipped, SkippedArchive{Path: r.rel, Err: r.skipErr})
+			continue
+		case r.reused:
+			report.Reused = append(report.Reused, r.rel)
+		default:
+			report.Loaded = append(report.Loaded, r.rel)
+		}
+		if err := index.MustAdd(r.metadata, r.fname, r.parentURL, r.digest); err != nil {
+			return index, report, errors.Wrapf(err, "failed adding to %s to index", r.fname)
 		}
+		// MustAdd sets the creation time to now
+		cvs := index.Entries[r.metadata.Name]
+		cvs[len(cvs)-1].Created = r.created
+	}
+	if opts.Cache != nil {
+		opts.Cache.Retain(append(report.Loaded, report.Reused...))
+	}
+	return index, report, nil
+}
 
-		var parentDir string
-		parentDir, fname = filepath.Split(fname)
-		// filepath.Split appends an extra slash to the end of parentDir. We want to strip that out.
-		parentDir = strings.TrimSuffix(parentDir, string(os.PathSeparator))
-		parentURL, err := urlutil.URLJoin(baseURL, parentDir)
-		if err != nil {
-			parentURL = path.Join(baseURL, parentDir)
+// archiveResult is the outcome of loading an archive for IndexDirectoryWithOptions
+type archiveResult struct {
+	rel       string
+	fname     string
+	parentURL string
+	metadata  *chart.Metadata
+	digest    string
+	created   time.Time
+	reused    bool
+	// skipErr is set when the archive is not a chart
+	skipErr error
+	err     error
+}
+
+// loadArchive gets the index information of an archive, either from the
+// previous index and cache or by loading it.
+func loadArchive(dir, baseURL, arch string, opts IndexOptions, previous map[string]*helmRepo.ChartVersion) archiveResult {
+	r := archiveResult{}
+	rel, err := filepath.Rel(dir, arch)
+	if err != nil {
+		r.err = err
+		return r
+	}
+	r.rel = rel
+
+	var parentDir string
+	parentDir, r.fname = filepath.Split(rel)
+	// filepath.Split appends an extra slash to the end of parentDir. We want to strip that out.
+	parentDir = strings.TrimSuffix(parentDir, string(os.PathSeparator))
+	r.parentURL, err = urlutil.URLJoin(baseURL, parentDir)
+	if err != nil {
+		r.parentURL = path.Join(baseURL, parentDir)
+	}
+
+	fi, err := os.Stat(arch)
+	if err != nil {
+		r.err = err
+		return r
+	}
+
+	url := archiveURL(r.fname, r.parentURL)
+	r.metadata, r.digest, err = reusableEntry(opts, previous, arch, rel, url, fi)
+	if err != nil {
+		r.err = err
+		return r
+	}
+	if r.metadata != nil {
+		r.reused = true
+		r.created = creationTime(previous[url], r.digest, fi)
+		return r
+	}
+
+	c, err := loader.Load(arch)
+	if err != nil {
+		r.skipErr = err
+		return r
+	}
+	r.digest, err = provenance.DigestFile(arch)
+	if err != nil {
+		r.err = err
+		return r
+	}
+	r.metadata = c.Metadata
+	r.created = creationTime(previous[url], r.digest, fi)
+	if opts.Cache != nil {
+		opts.Cache.Set(rel, fi, r.metadata, r.digest)
+	}
+	return r
+}
+
+// creationTime returns the creation time of the index entry of an archive:
+// the one of its previous entry when the archive did not change, so that
+// entries keep their age across runs, or the modification time of the
+// archive otherwise.
+func creationTime(prev *helmRepo.ChartVersion, digest string, fi os.FileInfo) time.Time {
+	if prev != nil && !prev.Created.IsZero() && chartcache.NormalizeDigest(prev.Digest) == chartcache.NormalizeDigest(digest) {
+		return prev.Created
+	}
+	return fi.ModTime()
+}
+
+// findArchives walks dir and returns the packaged charts (*.tgz) found at any
+// depth, filtered by the include and exclude patterns.
+func findArchives(dir string, include, exclude []string) ([]string, error) {
+	for _, pattern := range append(append([]string{}, include...), exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, errors.Wrapf(err, "invalid pattern %q", pattern)
 		}
+	}
 
-		c, err := loader.Load(arch)
+	var archives []string
+	err := filepath.Walk(dir, func(p string, fi os.FileInfo, err error) error {
 		if err != nil {
-			// Assume this is not a chart.
-			continue
+			return err
 		}
-		hash, err := provenance.DigestFile(arch)
+		rel, err := filepath.Rel(dir, p)
 		if err != nil {
-			return index, err
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+		if matchAny(exclude, rel) {
+			if fi.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if fi.IsDir() || filepath.Ext(p) != ".tgz" {
+			return nil
+		}
+		if len(include) > 0 && !matchAny(include, rel) {
+			return nil
 		}
-		if err := index.MustAdd(c.Metadata, fname, parentURL, hash); err != nil {
-			return index, errors.Wrapf(err, "failed adding to %s to index", fname)
+		archives = append(archives, p)
+		return nil
+	})
+	return archives, err
+}
+
+// matchAny reports whether the slash separated path rel matches any of the patterns
+func matchAny(patterns []string, rel string) bool {
+	for _, pattern := range patterns {
+		name := rel
+		if !strings.Contains(pattern, "/") {
+			name = path.Base(rel)
+		}
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
 		}
 	}
-	return index, nil
+	return false
+}
+
+// reusableEntry returns the chart metadata and digest of an archive that did
+// not change since it was last indexed, or a nil metadata otherwise.
+//
+// The previous index records neither the size nor the modification time of
+// the archives, and an archive may be replaced keeping its modification time
+// (e.g: cp -p, rsync -t), so its entries are only reused when the digest of
+// the archive matches too.
+func reusableEntry(opts IndexOptions, previous map[string]*helmRepo.ChartVersion, arch, rel, url string, fi os.FileInfo) (*chart.Metadata, string, error) {
+	if opts.Cache != nil {
+		if md, digest, ok := opts.Cache.Get(rel, fi); ok {
+			return md, digest, nil
+		}
+	}
+	cv, ok := previous[url]
+	if !ok || cv.Digest == "" || cv.Created.IsZero() || fi.ModTime().After(cv.Created) {
+		return nil, "", nil
+	}
+	digest, err := provenance.DigestFile(arch)
+	if err != nil {
+		return nil, "", err
+	}
+	if digest != cv.Digest {
+		return nil, "", nil
+	}
+	// Copy the metadata, so that the previous index is left untouched
+	md := *cv.Metadata
+	if opts.Cache != nil {
+		opts.Cache.Set(rel, fi, &md, cv.Digest)
+	}
+	return &md, cv.Digest, nil
+}
+
+// archiveURL returns the URL that IndexFile.MustAdd sets for an archive
+func archiveURL(fname, baseURL string) string {
+	if baseURL == "" {
+		return fname
+	}
+	u, err := urlutil.URLJoin(baseURL, fname)
+	if err != nil {
+		u = path.Join(baseURL, fname)
+	}
+	return u
+}
+
+// InvalidEntry is an index entry that failed validation
+type InvalidEntry struct {
+	Name    string
+	Version string
+	Err     error
 }
 
 // loadIndex loads an index file and does minimal validity checking.
@@ -148,25 +424,37 @@ func IndexDirectory(dir, baseURL string) (*IndexFile, error) {
 // The source parameter is only used for logging.
 // This will fail if API Version is not set (ErrNoAPIVersion) or if the unmarshal fails.
 func loadIndex(data []byte, source string) (*IndexFile, error) {
+	i, invalid, err := parseIndex(data)
+	for _, e := range invalid {
+		log.Printf("skipping loading invalid entry for chart %q %q from %s: %s", e.Name, e.Version, source, e.Err)
+	}
+	return i, err
+}
+
+// parseIndex loads an index file, leaving out and returning the entries
+// failing validation.
+func parseIndex(data []byte) (*IndexFile, []InvalidEntry, error) {
 	i := helmRepo.IndexFile{}
 	if err := yaml.UnmarshalStrict(data, &i); err != nil {
-		return &IndexFile{}, err
+		return &IndexFile{}, nil, err
 	}
 
+	var invalid []InvalidEntry
 	for name, cvs := range i.Entries {
 		for idx := len(cvs) - 1; idx >= 0; idx-- {
 			if cvs[idx].APIVersion == "" {
 				cvs[idx].APIVersion = chart.APIVersionV1
 			}
 			if err := cvs[idx].Validate(); err != nil {
-				log.Printf("skipping loading invalid entry for chart %q %q from %s: %s", name, cvs[idx].Version, source, err)
+				invalid = append(invalid, InvalidEntry{Name: name, Version: cvs[idx].Version, Err: err})
 				cvs = append(cvs[:idx], cvs[idx+1:]...)
 			}
 		}
+		i.Entries[name] = cvs
 	}
 	i.SortEntries()
 	if i.APIVersion == "" {
-		return &IndexFile{&i}, ErrNoAPIVersion
+		return &IndexFile{&i}, invalid, ErrNoAPIVersion
 	}
-	return &IndexFile{&i}, nil
+	return &IndexFile{&i}, invalid, nil
 }
@@ -17,11 +17,20 @@ limitations under the License.
 package repo
 
 import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/stretchr/testify/assert"
 	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
 	helmRepo "helm.sh/helm/v3/pkg/repo"
+
+	"github.com/rancher-sandbox/hypper/internal/test/ensure"
 )
 
 const (
@@ -152,6 +161,165 @@ func TestLoadUnorderedIndex(t *testing.T) {
 	verifyLocalIndex(t, i)
 }
 
+// saveChart packages a minimal chart into dir and returns the archive path
+func saveChart(t *testing.T, dir, name, version string) string {
+	t.Helper()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	p, err := chartutil.Save(&chart.Chart{
+		Metadata: &chart.Metadata{APIVersion: "v2", Name: name, Version: version},
+	}, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestIndexDirectoryIncremental(t *testing.T) {
+	is := assert.New(t)
+	dir := ensure.TempDir(t)
+	defer os.RemoveAll(dir)
+
+	saveChart(t, dir, "clipper", "0.1.0")
+	cutter := saveChart(t, dir, "cutter", "0.1.0")
+
+	cacheFile := filepath.Join(dir, "cache", "index-cache.json")
+	cache, err := LoadIndexCache(cacheFile)
+	is.NoError(err)
+
+	i, report, err := IndexDirectoryWithOptions(dir, "http://example.com/charts", IndexOptions{Cache: cache})
+	is.NoError(err)
+	is.Len(report.Loaded, 2)
+	is.Len(report.Reused, 0)
+	is.NoError(cache.WriteFile(cacheFile, 0644))
+
+	// nothing changed: everything comes from the cache
+	cache, err = LoadIndexCache(cacheFile)
+	is.NoError(err)
+	i2, report, err := IndexDirectoryWithOptions(dir, "http://example.com/charts", IndexOptions{Cache: cache})
+	is.NoError(err)
+	is.Len(report.Loaded, 0)
+	is.Len(report.Reused, 2)
+	is.Equal(i.Entries["cutter"][0].Digest, i2.Entries["cutter"][0].Digest)
+	is.Equal("http://example.com/charts/cutter-0.1.0.tgz", i2.Entries["cutter"][0].URLs[0])
+
+	// a modified archive is loaded again
+	later := time.Now().Add(time.Minute)
+	is.NoError(os.Chtimes(cutter, later, later))
+	_, report, err = IndexDirectoryWithOptions(dir, "http://example.com/charts", IndexOptions{Cache: cache})
+	is.NoError(err)
+	is.Equal([]string{"cutter-0.1.0.tgz"}, report.Loaded)
+	is.Equal([]string{"clipper-0.1.0.tgz"}, report.Reused)
+
+	// entries of a previous index are reused for archives older than them
+	_, report, err = IndexDirectoryWithOptions(dir, "http://example.com/charts", IndexOptions{Previous: i})
+	is.NoError(err)
+	is.Equal([]string{"cutter-0.1.0.tgz"}, report.Loaded)
+	is.Equal([]string{"clipper-0.1.0.tgz"}, report.Reused)
+
+	// an archive replaced keeping its modification time is loaded again
+	clipper := filepath.Join(dir, "clipper-0.1.0.tgz")
+	fi, err := os.Stat(clipper)
+	is.NoError(err)
+	is.NoError(os.Remove(clipper))
+	_, err = chartutil.Save(&chart.Chart{
+		Metadata: &chart.Metadata{APIVersion: "v2", Name: "clipper", Version: "0.1.0", Description: "replaced"},
+	}, dir)
+	is.NoError(err)
+	is.NoError(os.Chtimes(clipper, fi.ModTime(), fi.ModTime()))
+	i3, report, err := IndexDirectoryWithOptions(dir, "http://example.com/charts", IndexOptions{Previous: i})
+	is.NoError(err)
+	is.Len(report.Loaded, 2)
+	is.Equal("replaced", i3.Entries["clipper"][0].Description)
+	is.NotEqual(i.Entries["clipper"][0].Digest, i3.Entries["clipper"][0].Digest)
+
+	// a different base URL does not match the previous entries
+	_, report, err = IndexDirectoryWithOptions(dir, "http://example.com/other", IndexOptions{Previous: i})
+	is.NoError(err)
+	is.Len(report.Loaded, 2)
+
+	// removed archives are dropped from the cache
+	is.NoError(os.Remove(cutter))
+	_, _, err = IndexDirectoryWithOptions(dir, "http://example.com/charts", IndexOptions{Cache: cache})
+	is.NoError(err)
+	is.Len(cache.Entries, 1)
+}
+
+func TestIndexDirectoryRecursive(t *testing.T) {
+	is := assert.New(t)
+	dir := ensure.TempDir(t)
+	defer os.RemoveAll(dir)
+
+	saveChart(t, dir, "clipper", "0.1.0")
+	saveChart(t, filepath.Join(dir, "a"), "cutter", "0.1.0")
+	saveChart(t, filepath.Join(dir, "a", "b", "c"), "cutter", "0.2.0")
+	saveChart(t, filepath.Join(dir, "old"), "setter", "0.1.0")
+	is.NoError(ioutil.WriteFile(filepath.Join(dir, "a", "b", "broken-0.1.0.tgz"), []byte("not a chart"), 0644))
+
+	i, report, err := IndexDirectoryWithOptions(dir, "http://example.com/charts", IndexOptions{})
+	is.NoError(err)
+	is.Len(i.Entries, 3)
+	is.Len(i.Entries["cutter"], 2)
+	is.Len(report.Skipped, 1)
+	is.Equal("a/b/broken-0.1.0.tgz", filepath.ToSlash(report.Skipped[0].Path))
+	is.Error(report.Skipped[0].Err)
+
+	found := false
+	for _, cv := range i.Entries["cutter"] {
+		if cv.URLs[0] == "http://example.com/charts/a/b/c/cutter-0.2.0.tgz" {
+			found = true
+		}
+	}
+	is.True(found, "expected the deeply nested chart to be indexed: %#v", i.Entries["cutter"])
+
+	// exclude by directory name and by relative path
+	i, _, err = IndexDirectoryWithOptions(dir, "", IndexOptions{Exclude: []string{"old", "a/b/*"}})
+	is.NoError(err)
+	is.Len(i.Entries, 2)
+	is.Len(i.Entries["cutter"], 1)
+
+	// include by file name
+	i, report, err = IndexDirectoryWithOptions(dir, "", IndexOptions{Include: []string{"cutter-*.tgz"}})
+	is.NoError(err)
+	is.Len(i.Entries, 1)
+	is.Len(i.Entries["cutter"], 2)
+	is.Len(report.Skipped, 0)
+
+	_, _, err = IndexDirectoryWithOptions(dir, "", IndexOptions{Include: []string{"[a-"}})
+	is.Error(err)
+}
+
+func TestIndexDirectoryParallel(t *testing.T) {
+	is := assert.New(t)
+	dir := ensure.TempDir(t)
+	defer os.RemoveAll(dir)
+
+	for n := 0; n < 20; n++ {
+		saveChart(t, filepath.Join(dir, fmt.Sprintf("dir%d", n%3)), fmt.Sprintf("chart%d", n%7), fmt.Sprintf("0.%d.0", n))
+	}
+	is.NoError(ioutil.WriteFile(filepath.Join(dir, "broken.tgz"), []byte("not a chart"), 0644))
+
+	serial, serialReport, err := IndexDirectoryWithOptions(dir, "http://example.com", IndexOptions{Jobs: 1})
+	is.NoError(err)
+	for _, jobs := range []int{0, 4, 32} {
+		parallel, report, err := IndexDirectoryWithOptions(dir, "http://example.com", IndexOptions{Jobs: jobs})
+		is.NoError(err)
+		is.Equal(serialReport.Loaded, report.Loaded)
+		is.Equal(len(serialReport.Skipped), len(report.Skipped))
+		is.Equal(len(serial.Entries), len(parallel.Entries))
+		for name, cvs := range serial.Entries {
+			is.Equal(len(cvs), len(parallel.Entries[name]))
+			for n, cv := range cvs {
+				got := parallel.Entries[name][n]
+				is.Equal(cv.Version, got.Version)
+				is.Equal(cv.Digest, got.Digest)
+				is.Equal(cv.URLs, got.URLs)
+			}
+		}
+	}
+}
+
 func verifyLocalIndex(t *testing.T, i *IndexFile) {
 	numEntries := len(i.Entries)
 	if numEntries != 3 {
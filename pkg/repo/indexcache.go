@@ -0,0 +1,132 @@
+/*
+Copyright SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package repo
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"helm.sh/helm/v3/pkg/chart"
+)
+
+// IndexCache is a sidecar cache for IndexDirectoryWithOptions.
+//
+// It records the metadata and digest of each archive, keyed by its path
+// relative to the indexed directory. An entry is only valid while the size
+// and modification time of the archive stay the same.
+type IndexCache struct {
+	APIVersion string                      `json:"apiVersion"`
+	Entries    map[string]*IndexCacheEntry `json:"entries"`
+
+	mu sync.Mutex
+}
+
+// IndexCacheEntry is the cached information of an archive
+type IndexCacheEntry struct {
+	Size     int64           `json:"size"`
+	ModTime  time.Time       `json:"modTime"`
+	Digest   string          `json:"digest"`
+	Metadata *chart.Metadata `json:"metadata"`
+}
+
+// NewIndexCache returns an empty IndexCache
+func NewIndexCache() *IndexCache {
+	return &IndexCache{
+		APIVersion: APIVersionV1,
+		Entries:    map[string]*IndexCacheEntry{},
+	}
+}
+
+// LoadIndexCache loads the cache stored at path.
+//
+// A missing file results in an empty cache.
+func LoadIndexCache(path string) (*IndexCache, error) {
+	c := NewIndexCache()
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, c); err != nil {
+		return nil, errors.Wrapf(err, "error loading index cache %s", path)
+	}
+	if c.Entries == nil {
+		c.Entries = map[string]*IndexCacheEntry{}
+	}
+	return c, nil
+}
+
+// WriteFile writes the cache to path
+func (c *IndexCache) WriteFile(path string, perm os.FileMode) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	b, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, b, perm)
+}
+
+// Get returns the metadata and digest of the archive at rel, if it has not
+// changed since it was cached.
+func (c *IndexCache) Get(rel string, fi os.FileInfo) (*chart.Metadata, string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.Entries[filepath.ToSlash(rel)]
+	if !ok || e.Metadata == nil || e.Size != fi.Size() || !e.ModTime.Equal(fi.ModTime()) {
+		return nil, "", false
+	}
+	md := *e.Metadata
+	return &md, e.Digest, true
+}
+
+// Set records the metadata and digest of the archive at rel
+func (c *IndexCache) Set(rel string, fi os.FileInfo, md *chart.Metadata, digest string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Entries[filepath.ToSlash(rel)] = &IndexCacheEntry{
+		Size:     fi.Size(),
+		ModTime:  fi.ModTime(),
+		Digest:   digest,
+		Metadata: md,
+	}
+}
+
+// Retain drops the entries of the archives not in rels, e.g: deleted ones
+func (c *IndexCache) Retain(rels []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	keep := make(map[string]bool, len(rels))
+	for _, rel := range rels {
+		keep[filepath.ToSlash(rel)] = true
+	}
+	for rel := range c.Entries {
+		if !keep[rel] {
+			delete(c.Entries, rel)
+		}
+	}
+}
@@ -0,0 +1,274 @@
+/*
+Copyright SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package repo
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	helmRepo "helm.sh/helm/v3/pkg/repo"
+	"sigs.k8s.io/yaml"
+)
+
+// LazyIndex is an index file whose entries are only decoded when looked up.
+//
+// Opening a LazyIndex reads the file once, line by line, remembering where the
+// entries of every chart are, so a chart can be looked up without decoding the
+// whole index. This is what index files written by hypper and Helm look like:
+// block style YAML, with the charts of the "entries" key on their own lines.
+// Index files with any other layout are fully loaded instead.
+type LazyIndex struct {
+	path   string
+	charts map[string]indexChunk
+
+	// full is the loaded index, for files whose layout is not supported
+	full *IndexFile
+}
+
+// indexChunk is the part of an index file with the entries of a chart
+type indexChunk struct {
+	offset int64
+	length int64
+}
+
+// errUnsupportedLayout is returned when scanning an index file that has to be
+// fully loaded
+var errUnsupportedLayout = errors.New("unsupported index layout")
+
+// OpenLazyIndex scans the index file at path
+func OpenLazyIndex(path string) (*LazyIndex, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	l := &LazyIndex{path: path}
+	l.charts, err = scanIndex(f)
+	if err == errUnsupportedLayout {
+		l.charts = nil
+		l.full, err = LoadIndexFile(path)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "error loading %s", path)
+	}
+	return l, nil
+}
+
+// Names returns the names of the charts of the index, sorted
+func (l *LazyIndex) Names() []string {
+	var names []string
+	if l.full != nil {
+		for name := range l.full.Entries {
+			names = append(names, name)
+		}
+	} else {
+		for name := range l.charts {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Has returns true if the index has the named chart
+func (l *LazyIndex) Has(name string) bool {
+	if l.full != nil {
+		_, ok := l.full.Entries[name]
+		return ok
+	}
+	_, ok := l.charts[name]
+	return ok
+}
+
+// ChartVersions decodes the versions of the named chart, newest first. As
+// when loading the whole index, invalid versions are left out.
+func (l *LazyIndex) ChartVersions(name string) (helmRepo.ChartVersions, error) {
+	if l.full != nil {
+		cvs, ok := l.full.Entries[name]
+		if !ok {
+			return nil, helmRepo.ErrNoChartName
+		}
+		return cvs, nil
+	}
+
+	c, ok := l.charts[name]
+	if !ok {
+		return nil, helmRepo.ErrNoChartName
+	}
+	f, err := os.Open(l.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	chunk := make([]byte, c.length)
+	if _, err := f.ReadAt(chunk, c.offset); err != nil {
+		return nil, errors.Wrapf(err, "error loading %s", l.path)
+	}
+
+	// The chunk is decoded as an index of its own, to validate the entries
+	// like loadIndex does
+	doc := append([]byte("apiVersion: "+APIVersionV1+"\nentries:\n"), chunk...)
+	i, err := loadIndex(doc, l.path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error loading %s", l.path)
+	}
+	return i.Entries[name], nil
+}
+
+// Get returns the version of the named chart matching the version
+// constraint, like IndexFile.Get does.
+func (l *LazyIndex) Get(name, version string) (*helmRepo.ChartVersion, error) {
+	cvs, err := l.ChartVersions(name)
+	if err != nil {
+		return nil, err
+	}
+	return getChartVersion(name, version, cvs)
+}
+
+// scanIndex returns where the entries of every chart are in the index file
+// read from r. It fails with errUnsupportedLayout when the file does not have
+// the layout of the index files written by hypper and Helm.
+func scanIndex(r io.Reader) (map[string]indexChunk, error) {
+	charts := map[string]indexChunk{}
+	br := bufio.NewReader(r)
+
+	var (
+		offset     int64
+		inEntries  bool
+		hasAPI     bool
+		indent     = -1
+		current    string
+		start, end int64
+	)
+	closeChart := func() {
+		if current != "" {
+			charts[current] = indexChunk{offset: start, length: end - start}
+			current = ""
+		}
+	}
+
+	for {
+		line, err := br.ReadBytes('\n')
+		if len(line) > 0 {
+			lineStart := offset
+			offset += int64(len(line))
+
+			text := strings.TrimRight(string(line), "\r\n")
+			trimmed := strings.TrimLeft(text, " ")
+			n := len(text) - len(trimmed)
+
+			switch {
+			case trimmed == "" || strings.HasPrefix(trimmed, "#"):
+				// Blank lines and comments belong to whatever they are in
+				if current != "" {
+					end = offset
+				}
+			case strings.HasPrefix(trimmed, "\t"):
+				return nil, errUnsupportedLayout
+			case n == 0:
+				// A top level key
+				closeChart()
+				inEntries = false
+				key, value, ok := splitKey(trimmed)
+				if !ok {
+					return nil, errUnsupportedLayout
+				}
+				switch key {
+				case "apiVersion":
+					hasAPI = value != ""
+				case "entries":
+					switch value {
+					case "":
+						inEntries = true
+					case "{}":
+					default:
+						return nil, errUnsupportedLayout
+					}
+				}
+			case !inEntries:
+				// The value of another top level key
+			case indent == -1 || n == indent && !strings.HasPrefix(trimmed, "-"):
+				// A chart
+				if indent == -1 {
+					indent = n
+				}
+				closeChart()
+				name, err := chartKey(trimmed)
+				if err != nil {
+					return nil, errUnsupportedLayout
+				}
+				if _, ok := charts[name]; ok {
+					return nil, errUnsupportedLayout
+				}
+				current, start, end = name, lineStart, offset
+			case n < indent:
+				return nil, errUnsupportedLayout
+			default:
+				// The versions of the current chart
+				end = offset
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	closeChart()
+
+	if !hasAPI {
+		return nil, ErrNoAPIVersion
+	}
+	return charts, nil
+}
+
+// splitKey splits a "key: value" line of a mapping, dropping comments from
+// simple values
+func splitKey(line string) (string, string, bool) {
+	p := strings.SplitN(line, ":", 2)
+	if len(p) != 2 || strings.ContainsAny(p[0], "\"'{[") {
+		return "", "", false
+	}
+	value := strings.TrimSpace(p[1])
+	if strings.HasPrefix(value, "#") {
+		value = ""
+	}
+	return strings.TrimSpace(p[0]), value, true
+}
+
+// chartKey returns the chart name of a line of the entries mapping. The line
+// is decoded as YAML, so quoted names are supported.
+func chartKey(line string) (string, error) {
+	m := map[string]interface{}{}
+	if err := yaml.Unmarshal(bytes.TrimSpace([]byte(line)), &m); err != nil {
+		return "", err
+	}
+	if len(m) != 1 {
+		return "", errUnsupportedLayout
+	}
+	for name := range m {
+		return name, nil
+	}
+	return "", errUnsupportedLayout
+}
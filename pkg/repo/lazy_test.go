@@ -0,0 +1,122 @@
+/*
+Copyright SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package repo
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"helm.sh/helm/v3/pkg/chart"
+	helmRepo "helm.sh/helm/v3/pkg/repo"
+
+	"github.com/rancher-sandbox/hypper/internal/test/ensure"
+)
+
+func TestLazyIndexMatchesLoadIndexFile(t *testing.T) {
+	for _, path := range []string{testfile, annotationstestfile, chartmuseumtestfile, unorderedTestfile} {
+		t.Run(path, func(t *testing.T) {
+			is := assert.New(t)
+
+			full, err := LoadIndexFile(path)
+			is.NoError(err)
+			lazy, err := OpenLazyIndex(path)
+			is.NoError(err)
+			is.Nil(lazy.full, "the index should be lazily loaded")
+
+			names := []string{}
+			for name := range full.Entries {
+				names = append(names, name)
+			}
+			is.ElementsMatch(names, lazy.Names())
+			for name, cvs := range full.Entries {
+				lazyCvs, err := lazy.ChartVersions(name)
+				is.NoError(err)
+				is.Equal(cvs, lazyCvs)
+			}
+		})
+	}
+}
+
+func TestLazyIndexGet(t *testing.T) {
+	is := assert.New(t)
+
+	dir := ensure.TempDir(t)
+	defer os.RemoveAll(dir)
+
+	index := NewIndexFile()
+	for _, v := range []string{"1.0.0", "1.1.0", "2.0.0-rc.1"} {
+		index.Add(&chart.Metadata{APIVersion: chart.APIVersionV2, Name: "mariadb", Version: v}, "mariadb-"+v+".tgz", "", "")
+	}
+	index.Add(&chart.Metadata{APIVersion: chart.APIVersionV2, Name: "my:chart", Version: "0.1.0"}, "my-chart-0.1.0.tgz", "", "")
+	path := filepath.Join(dir, "index.yaml")
+	is.NoError(index.WriteFile(path, 0644))
+
+	lazy, err := OpenLazyIndex(path)
+	is.NoError(err)
+	is.True(lazy.Has("mariadb"))
+	is.True(lazy.Has("my:chart"))
+	is.False(lazy.Has("nginx"))
+
+	cv, err := lazy.Get("mariadb", "")
+	is.NoError(err)
+	is.Equal("1.1.0", cv.Version)
+	cv, err = lazy.Get("mariadb", "^1.0.0-0 < 1.1.0")
+	is.NoError(err)
+	is.Equal("1.0.0", cv.Version)
+	cv, err = lazy.Get("mariadb", "2.0.0-rc.1")
+	is.NoError(err)
+	is.Equal("2.0.0-rc.1", cv.Version)
+	_, err = lazy.Get("nginx", "")
+	is.Equal(helmRepo.ErrNoChartName, err)
+
+	cv, err = lazy.Get("my:chart", "")
+	is.NoError(err)
+	is.Equal("0.1.0", cv.Version)
+}
+
+func TestLazyIndexFallback(t *testing.T) {
+	is := assert.New(t)
+
+	dir := ensure.TempDir(t)
+	defer os.RemoveAll(dir)
+
+	// JSON is valid YAML, but not the layout the lazy index scans
+	full, err := LoadIndexFile(testfile)
+	is.NoError(err)
+	b, err := json.Marshal(full.IndexFile)
+	is.NoError(err)
+	path := filepath.Join(dir, "index.json")
+	is.NoError(ioutil.WriteFile(path, b, 0644))
+
+	lazy, err := OpenLazyIndex(path)
+	is.NoError(err)
+	is.NotNil(lazy.full)
+	cv, err := lazy.Get("nginx", "0.1.0")
+	is.NoError(err)
+	is.Equal("0.1.0", cv.Version)
+
+	path = filepath.Join(dir, "no-api.yaml")
+	is.NoError(ioutil.WriteFile(path, []byte("entries:\n  nginx: []\n"), 0644))
+	_, err = OpenLazyIndex(path)
+	is.Error(err)
+	is.True(strings.HasSuffix(err.Error(), ErrNoAPIVersion.Error()))
+}
@@ -0,0 +1,104 @@
+/*
+Copyright SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package repo
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"helm.sh/helm/v3/pkg/getter"
+	"sigs.k8s.io/yaml"
+)
+
+// FileScheme is the URL scheme of local repositories
+const FileScheme = "file"
+
+// IsLocalURL returns true if u is the file:// URL of a local repository or chart
+func IsLocalURL(u string) bool {
+	parsed, err := url.Parse(u)
+	return err == nil && parsed.Scheme == FileScheme
+}
+
+// LocalPath returns the path of a file:// URL
+func LocalPath(u string) string {
+	parsed, err := url.Parse(u)
+	if err != nil || parsed.Scheme != FileScheme {
+		return u
+	}
+	return filepath.FromSlash(parsed.Path)
+}
+
+// LocalURL returns the file:// URL of a directory. URLs with a scheme are
+// returned as they are.
+func LocalURL(dir string) (string, error) {
+	if strings.Contains(dir, "://") {
+		return dir, nil
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	fi, err := os.Stat(abs)
+	if err != nil {
+		return "", err
+	}
+	if !fi.IsDir() {
+		return "", errors.Errorf("%s is not a directory", dir)
+	}
+	return (&url.URL{Scheme: FileScheme, Path: filepath.ToSlash(abs)}).String(), nil
+}
+
+// fileGetter reads files of local repositories.
+//
+// A directory without index.yaml is indexed on demand when its index is
+// requested, so any directory of charts can be used as a repository.
+type fileGetter struct{}
+
+// Get reads the file at the file:// URL href
+func (g *fileGetter) Get(href string, options ...getter.Option) (*bytes.Buffer, error) {
+	p := LocalPath(href)
+	b, err := ioutil.ReadFile(p)
+	if os.IsNotExist(err) && filepath.Base(p) == "index.yaml" {
+		return indexLocalDirectory(filepath.Dir(p))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewBuffer(b), nil
+}
+
+func indexLocalDirectory(dir string) (*bytes.Buffer, error) {
+	baseURL, err := LocalURL(dir)
+	if err != nil {
+		return nil, err
+	}
+	i, err := IndexDirectory(dir, baseURL)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed indexing %s", dir)
+	}
+	i.SortEntries()
+	b, err := yaml.Marshal(i.IndexFile)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewBuffer(b), nil
+}
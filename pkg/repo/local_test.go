@@ -0,0 +1,85 @@
+/*
+Copyright SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package repo
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	helmCli "helm.sh/helm/v3/pkg/cli"
+	"helm.sh/helm/v3/pkg/getter"
+	helmRepo "helm.sh/helm/v3/pkg/repo"
+
+	"github.com/rancher-sandbox/hypper/internal/test/ensure"
+)
+
+func TestLocalURL(t *testing.T) {
+	is := assert.New(t)
+	dir := ensure.TempDir(t)
+
+	u, err := LocalURL(dir)
+	is.NoError(err)
+	is.True(IsLocalURL(u))
+	is.Equal(dir, LocalPath(u))
+
+	u, err = LocalURL("https://example.com/charts")
+	is.NoError(err)
+	is.Equal("https://example.com/charts", u)
+	is.False(IsLocalURL(u))
+
+	_, err = LocalURL(filepath.Join(dir, "missing"))
+	is.Error(err)
+}
+
+func TestLocalRepository(t *testing.T) {
+	is := assert.New(t)
+
+	dir := ensure.TempDir(t)
+	saveChart(t, filepath.Join(dir, "nested"), "mariadb", "9.0.0")
+	saveChart(t, dir, "nginx", "1.0.0")
+	u, err := LocalURL(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewChartRepository(&helmRepo.Entry{Name: "local", URL: u}, getter.All(helmCli.New()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.CachePath = ensure.TempDir(t)
+
+	// without index.yaml, the directory is indexed on demand
+	fname, err := r.DownloadIndexFile()
+	is.NoError(err)
+	index, err := LoadIndexFile(fname)
+	is.NoError(err)
+	is.Len(index.Entries, 2)
+	is.Equal(u+"/nested/mariadb-9.0.0.tgz", index.Entries["mariadb"][0].URLs[0])
+	is.FileExists(LocalPath(index.Entries["mariadb"][0].URLs[0]))
+
+	// an existing index.yaml is used as it is
+	i := NewIndexFile()
+	i.Add(index.Entries["nginx"][0].Metadata, "nginx-1.0.0.tgz", "", index.Entries["nginx"][0].Digest)
+	is.NoError(i.WriteFile(filepath.Join(dir, "index.yaml"), 0644))
+	fname, err = r.DownloadIndexFile()
+	is.NoError(err)
+	index, err = LoadIndexFile(fname)
+	is.NoError(err)
+	is.Len(index.Entries, 1)
+	is.Equal("nginx-1.0.0.tgz", index.Entries["nginx"][0].URLs[0])
+}
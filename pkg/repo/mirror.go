@@ -0,0 +1,200 @@
+/*
+Copyright SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package repo
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/pkg/errors"
+	"helm.sh/helm/v3/pkg/provenance"
+	helmRepo "helm.sh/helm/v3/pkg/repo"
+
+	"github.com/rancher-sandbox/hypper/pkg/chartcache"
+)
+
+// MirrorOptions selects the charts to mirror and how the mirror is indexed
+type MirrorOptions struct {
+	// Charts restricts the mirrored charts to these names. All the charts are
+	// mirrored when empty.
+	Charts []string
+
+	// Version is a semver constraint restricting the mirrored versions. All
+	// the versions are mirrored when empty.
+	Version string
+
+	// URL is the base URL the mirror is served from, used in its index
+	URL string
+}
+
+// MirrorReport describes how the charts of a repository were mirrored
+type MirrorReport struct {
+	// Downloaded are the archives fetched from the repository
+	Downloaded []string
+	// Present are the archives already in the mirror, with the right digest
+	Present []string
+	// Unverified are the archives without digest in the source index
+	Unverified []string
+}
+
+// Mirror downloads the charts of index, the index of the repository, into
+// dir, and generates an index of dir with opts.URL as base URL.
+//
+// The digest of every archive, downloaded or already in dir, is checked
+// against index. Archives whose entry has no digest are reported as
+// unverified.
+func (r *ChartRepository) Mirror(index *IndexFile, dir string, opts MirrorOptions) (*IndexFile, *MirrorReport, error) {
+	selected, err := selectCharts(index, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, nil, err
+	}
+
+	report := &MirrorReport{}
+	expected := map[string]string{}
+	for _, cv := range selected {
+		if len(cv.URLs) == 0 {
+			return nil, nil, errors.Errorf("chart %s %s has no URL", cv.Name, cv.Version)
+		}
+		u, err := helmRepo.ResolveReferenceURL(r.Config.URL, cv.URLs[0])
+		if err != nil {
+			return nil, nil, err
+		}
+		// Name archives after the chart, as archives of different charts
+		// may share the base name of their URLs
+		fname := fmt.Sprintf("%s-%s.tgz", cv.Name, cv.Version)
+		digest := chartcache.NormalizeDigest(cv.Digest)
+		expected[fname] = digest
+		dest := filepath.Join(dir, fname)
+
+		if digest != "" {
+			if d, err := provenance.DigestFile(dest); err == nil && d == digest {
+				report.Present = append(report.Present, fname)
+				continue
+			}
+		} else {
+			report.Unverified = append(report.Unverified, fname)
+		}
+
+		if err := r.download(u, dest, digest); err != nil {
+			return nil, nil, errors.Wrapf(err, "failed mirroring chart %s %s", cv.Name, cv.Version)
+		}
+		report.Downloaded = append(report.Downloaded, fname)
+	}
+
+	mirror, _, err := IndexDirectoryWithOptions(dir, opts.URL, IndexOptions{})
+	if err != nil {
+		return nil, nil, err
+	}
+	// The archives went through the digest check, but double check that the
+	// mirror index matches the source one.
+	for _, cvs := range mirror.Entries {
+		for _, cv := range cvs {
+			fname := path.Base(cv.URLs[0])
+			if d, ok := expected[fname]; ok && d != "" && d != chartcache.NormalizeDigest(cv.Digest) {
+				return nil, nil, errors.Errorf("digest of %s does not match the source index", fname)
+			}
+		}
+	}
+	mirror.SortEntries()
+	return mirror, report, nil
+}
+
+// download fetches u into dest, checking that it matches digest when not empty
+func (r *ChartRepository) download(u, dest, digest string) error {
+	data, err := r.get(u)
+	if err != nil {
+		return err
+	}
+	if digest != "" {
+		d, err := provenance.Digest(bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		if d != digest {
+			return errors.Errorf("digest mismatch for %s: expected %s, got %s", u, digest, d)
+		}
+	}
+
+	// Write to a temporary file first, so an interrupted mirror never
+	// leaves a partial archive behind
+	tmp, err := ioutil.TempFile(filepath.Dir(dest), ".mirror-")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), dest)
+}
+
+// selectCharts returns the entries of index matching opts, sorted by name
+// and version
+func selectCharts(index *IndexFile, opts MirrorOptions) ([]*helmRepo.ChartVersion, error) {
+	var constraint *semver.Constraints
+	if opts.Version != "" {
+		c, err := semver.NewConstraint(opts.Version)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid version constraint %q", opts.Version)
+		}
+		constraint = c
+	}
+
+	names := append([]string{}, opts.Charts...)
+	if len(names) == 0 {
+		for name := range index.Entries {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var selected []*helmRepo.ChartVersion
+	for _, name := range names {
+		cvs, ok := index.Entries[name]
+		if !ok {
+			return nil, errors.Errorf("chart %q not found in the repository", name)
+		}
+		for _, cv := range cvs {
+			if constraint != nil {
+				v, err := semver.NewVersion(cv.Version)
+				if err != nil || !constraint.Check(v) {
+					continue
+				}
+			}
+			selected = append(selected, cv)
+		}
+	}
+	return selected, nil
+}
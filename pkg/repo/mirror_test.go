@@ -0,0 +1,194 @@
+/*
+Copyright SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package repo
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	helmCli "helm.sh/helm/v3/pkg/cli"
+	"helm.sh/helm/v3/pkg/getter"
+	helmRepo "helm.sh/helm/v3/pkg/repo"
+
+	"github.com/rancher-sandbox/hypper/internal/test/ensure"
+)
+
+func TestMirror(t *testing.T) {
+	is := assert.New(t)
+
+	srvDir := ensure.TempDir(t)
+	saveChart(t, srvDir, "mariadb", "9.0.0")
+	saveChart(t, srvDir, "mariadb", "9.1.0")
+	saveChart(t, srvDir, "mariadb", "10.0.0")
+	saveChart(t, srvDir, "nginx", "1.0.0")
+	srv := httptest.NewServer(http.FileServer(http.Dir(srvDir)))
+	defer srv.Close()
+
+	// relative URLs in the source index
+	index, err := IndexDirectory(srvDir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	index.SortEntries()
+
+	r, err := NewChartRepository(&helmRepo.Entry{Name: "upstream", URL: srv.URL}, getter.All(helmCli.New()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := ensure.TempDir(t)
+	opts := MirrorOptions{
+		Charts:  []string{"mariadb"},
+		Version: "^9.0.0",
+		URL:     "https://charts.internal.example.com",
+	}
+	mirror, report, err := r.Mirror(index, dir, opts)
+	is.NoError(err)
+	is.Equal([]string{"mariadb-9.1.0.tgz", "mariadb-9.0.0.tgz"}, report.Downloaded)
+	is.Len(mirror.Entries, 1)
+	is.Len(mirror.Entries["mariadb"], 2)
+	is.Equal("https://charts.internal.example.com/mariadb-9.1.0.tgz", mirror.Entries["mariadb"][0].URLs[0])
+	is.Equal(index.Entries["mariadb"][1].Digest, mirror.Entries["mariadb"][0].Digest)
+
+	// already mirrored archives are not downloaded again
+	mirror, report, err = r.Mirror(index, dir, MirrorOptions{URL: opts.URL})
+	is.NoError(err)
+	is.ElementsMatch([]string{"mariadb-9.0.0.tgz", "mariadb-9.1.0.tgz"}, report.Present)
+	is.ElementsMatch([]string{"mariadb-10.0.0.tgz", "nginx-1.0.0.tgz"}, report.Downloaded)
+	is.Len(mirror.Entries, 2)
+
+	// archives not matching the source index are rejected
+	index.Entries["nginx"][0].Digest = "sha256:0000"
+	_, _, err = r.Mirror(index, ensure.TempDir(t), MirrorOptions{Charts: []string{"nginx"}})
+	is.Error(err)
+	is.Contains(err.Error(), "digest mismatch")
+
+	_, _, err = r.Mirror(index, dir, MirrorOptions{Charts: []string{"postgresql"}})
+	is.EqualError(err, `chart "postgresql" not found in the repository`)
+
+	_, _, err = r.Mirror(index, dir, MirrorOptions{Version: "not a range"})
+	is.Error(err)
+}
+
+func TestMirrorUnverified(t *testing.T) {
+	is := assert.New(t)
+
+	srvDir := ensure.TempDir(t)
+	saveChart(t, srvDir, "nginx", "1.0.0")
+	srv := httptest.NewServer(http.FileServer(http.Dir(srvDir)))
+	defer srv.Close()
+
+	index, err := IndexDirectory(srvDir, srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	index.Entries["nginx"][0].Digest = ""
+
+	r, err := NewChartRepository(&helmRepo.Entry{Name: "upstream", URL: srv.URL}, getter.All(helmCli.New()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := ensure.TempDir(t)
+	_, report, err := r.Mirror(index, dir, MirrorOptions{})
+	is.NoError(err)
+	is.Equal([]string{"nginx-1.0.0.tgz"}, report.Unverified)
+	is.Equal([]string{"nginx-1.0.0.tgz"}, report.Downloaded)
+
+	files, err := ioutil.ReadDir(dir)
+	is.NoError(err)
+	is.Len(files, 1, "expected no temporary files left in %s", filepath.Base(dir))
+}
+
+func TestMirrorFileNames(t *testing.T) {
+	is := assert.New(t)
+
+	// archives of different charts sharing the base name of their URLs
+	srvDir := ensure.TempDir(t)
+	for _, name := range []string{"alpha", "beta"} {
+		p := saveChart(t, filepath.Join(srvDir, name), name, "1.0.0")
+		is.NoError(os.Rename(p, filepath.Join(srvDir, name, "chart.tgz")))
+	}
+	srv := httptest.NewServer(http.FileServer(http.Dir(srvDir)))
+	defer srv.Close()
+
+	index, err := IndexDirectory(srvDir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewChartRepository(&helmRepo.Entry{Name: "upstream", URL: srv.URL}, getter.All(helmCli.New()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	charts := []string{"beta", "alpha"}
+	mirror, report, err := r.Mirror(index, ensure.TempDir(t), MirrorOptions{Charts: charts})
+	is.NoError(err)
+	is.Equal([]string{"alpha-1.0.0.tgz", "beta-1.0.0.tgz"}, report.Downloaded)
+	is.Len(mirror.Entries, 2)
+	is.Equal([]string{"beta", "alpha"}, charts, "expected the charts of the options to be left untouched")
+}
+
+func TestMirrorCredentials(t *testing.T) {
+	is := assert.New(t)
+
+	srvDir := ensure.TempDir(t)
+	saveChart(t, srvDir, "nginx", "1.0.0")
+
+	var leaked bool
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if _, _, ok := req.BasicAuth(); ok {
+			leaked = true
+		}
+		http.FileServer(http.Dir(srvDir)).ServeHTTP(w, req)
+	}))
+	defer other.Close()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if u, p, ok := req.BasicAuth(); !ok || u != "user" || p != "pass" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		http.FileServer(http.Dir(srvDir)).ServeHTTP(w, req)
+	}))
+	defer srv.Close()
+
+	r, err := NewChartRepository(&helmRepo.Entry{Name: "upstream", URL: srv.URL, Username: "user", Password: "pass"}, getter.All(helmCli.New()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// credentials are sent to the repository
+	index, err := IndexDirectory(srvDir, srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = r.Mirror(index, ensure.TempDir(t), MirrorOptions{})
+	is.NoError(err)
+
+	// but not to other hosts
+	index, err = IndexDirectory(srvDir, other.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = r.Mirror(index, ensure.TempDir(t), MirrorOptions{})
+	is.NoError(err)
+	is.False(leaked, "expected no credentials to be sent to %s", other.URL)
+}
@@ -0,0 +1,265 @@
+/*
+Copyright SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package repo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	helmRepo "helm.sh/helm/v3/pkg/repo"
+)
+
+// parsedIndexVersion is the version of the format of parsed indexes. Parsed
+// indexes of other versions are rebuilt.
+const parsedIndexVersion = 1
+
+func init() {
+	// Types found in the interface{} values of chart metadata, e.g: the
+	// import-values of dependencies
+	gob.Register(map[string]interface{}{})
+	gob.Register([]interface{}{})
+}
+
+// ChartIndex looks up charts in a repository index
+type ChartIndex interface {
+	// Names returns the names of the charts of the index, sorted
+	Names() []string
+	// Has returns true if the index has the named chart
+	Has(name string) bool
+	// ChartVersions returns the versions of the named chart, newest first
+	ChartVersions(name string) (helmRepo.ChartVersions, error)
+	// Get returns the version of the named chart matching the version
+	// constraint, like IndexFile.Get does
+	Get(name, version string) (*helmRepo.ChartVersion, error)
+}
+
+// ParsedIndex is a pre-parsed, binary, copy of an index file, kept next to
+// it so charts can be looked up without parsing YAML.
+//
+// The file has the gob encoded versions of every chart, one after the other,
+// followed by a table of the charts sorted by name, with where their versions
+// are, and by the size of the table. Only the table and the versions of the
+// charts looked up are decoded.
+type ParsedIndex struct {
+	path   string
+	header parsedIndexHeader
+}
+
+type parsedIndexHeader struct {
+	Version int
+
+	// SourceSize and SourceModTime identify the index file the parsed index
+	// was built from
+	SourceSize    int64
+	SourceModTime int64
+
+	Names   []string
+	Offsets []int64
+	Lengths []int64
+}
+
+// ParsedIndexPath returns the path of the parsed index of the index file at
+// indexPath
+func ParsedIndexPath(indexPath string) string {
+	return strings.TrimSuffix(indexPath, filepath.Ext(indexPath)) + ".gob"
+}
+
+// OpenChartIndex returns the fastest way of looking up charts in the index
+// file at indexPath: its parsed index, rebuilt if the index file changed since
+// it was written. When the parsed index cannot be written, the index file is
+// lazily loaded instead.
+func OpenChartIndex(indexPath string) (ChartIndex, error) {
+	if p, err := OpenParsedIndex(indexPath); err == nil {
+		return p, nil
+	}
+	if p, err := WriteParsedIndex(indexPath); err == nil {
+		return p, nil
+	}
+	return OpenLazyIndex(indexPath)
+}
+
+// OpenParsedIndex opens the parsed index of the index file at indexPath. It
+// fails if the parsed index is missing or out of date.
+func OpenParsedIndex(indexPath string) (*ParsedIndex, error) {
+	fi, err := os.Stat(indexPath)
+	if err != nil {
+		return nil, err
+	}
+	path := ParsedIndexPath(indexPath)
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	pfi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	var size [8]byte
+	if pfi.Size() < int64(len(size)) {
+		return nil, errors.Errorf("%s is not a parsed index", path)
+	}
+	if _, err := f.ReadAt(size[:], pfi.Size()-int64(len(size))); err != nil {
+		return nil, err
+	}
+	headerSize := int64(binary.BigEndian.Uint64(size[:]))
+	if headerSize > pfi.Size()-int64(len(size)) {
+		return nil, errors.Errorf("%s is not a parsed index", path)
+	}
+	b := make([]byte, headerSize)
+	if _, err := f.ReadAt(b, pfi.Size()-int64(len(size))-headerSize); err != nil {
+		return nil, err
+	}
+
+	p := &ParsedIndex{path: path}
+	if err := gob.NewDecoder(bytes.NewReader(b)).Decode(&p.header); err != nil {
+		return nil, errors.Wrapf(err, "%s is not a parsed index", path)
+	}
+	if p.header.Version != parsedIndexVersion || p.header.SourceSize != fi.Size() || p.header.SourceModTime != fi.ModTime().UnixNano() {
+		return nil, errors.Errorf("%s is out of date", path)
+	}
+	return p, nil
+}
+
+// WriteParsedIndex builds the parsed index of the index file at indexPath.
+//
+// The index file is read through a LazyIndex, so only the versions of one
+// chart at a time are decoded.
+func WriteParsedIndex(indexPath string) (*ParsedIndex, error) {
+	fi, err := os.Stat(indexPath)
+	if err != nil {
+		return nil, err
+	}
+	lazy, err := OpenLazyIndex(indexPath)
+	if err != nil {
+		return nil, err
+	}
+
+	path := ParsedIndexPath(indexPath)
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".parsed-index-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	header := parsedIndexHeader{
+		Version:       parsedIndexVersion,
+		SourceSize:    fi.Size(),
+		SourceModTime: fi.ModTime().UnixNano(),
+		Names:         lazy.Names(),
+	}
+	var offset int64
+	for _, name := range header.Names {
+		cvs, err := lazy.ChartVersions(name)
+		if err != nil {
+			return nil, err
+		}
+		var b bytes.Buffer
+		if err := gob.NewEncoder(&b).Encode(cvs); err != nil {
+			return nil, errors.Wrapf(err, "failed encoding chart %q", name)
+		}
+		if _, err := tmp.Write(b.Bytes()); err != nil {
+			return nil, err
+		}
+		header.Offsets = append(header.Offsets, offset)
+		header.Lengths = append(header.Lengths, int64(b.Len()))
+		offset += int64(b.Len())
+	}
+
+	var b bytes.Buffer
+	if err := gob.NewEncoder(&b).Encode(header); err != nil {
+		return nil, err
+	}
+	var size [8]byte
+	binary.BigEndian.PutUint64(size[:], uint64(b.Len()))
+	if _, err := tmp.Write(append(b.Bytes(), size[:]...)); err != nil {
+		return nil, err
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return nil, err
+	}
+	return &ParsedIndex{path: path, header: header}, nil
+}
+
+// Names implements ChartIndex
+func (p *ParsedIndex) Names() []string {
+	return append([]string{}, p.header.Names...)
+}
+
+// Has implements ChartIndex
+func (p *ParsedIndex) Has(name string) bool {
+	_, ok := p.find(name)
+	return ok
+}
+
+// ChartVersions implements ChartIndex
+func (p *ParsedIndex) ChartVersions(name string) (helmRepo.ChartVersions, error) {
+	n, ok := p.find(name)
+	if !ok {
+		return nil, helmRepo.ErrNoChartName
+	}
+	f, err := os.Open(p.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	b := make([]byte, p.header.Lengths[n])
+	if _, err := f.ReadAt(b, p.header.Offsets[n]); err != nil {
+		return nil, errors.Wrapf(err, "error loading %s", p.path)
+	}
+	var cvs helmRepo.ChartVersions
+	if err := gob.NewDecoder(bytes.NewReader(b)).Decode(&cvs); err != nil {
+		return nil, errors.Wrapf(err, "error loading %s", p.path)
+	}
+	return cvs, nil
+}
+
+// Get implements ChartIndex
+func (p *ParsedIndex) Get(name, version string) (*helmRepo.ChartVersion, error) {
+	cvs, err := p.ChartVersions(name)
+	if err != nil {
+		return nil, err
+	}
+	return getChartVersion(name, version, cvs)
+}
+
+func (p *ParsedIndex) find(name string) (int, bool) {
+	n := sort.SearchStrings(p.header.Names, name)
+	return n, n < len(p.header.Names) && p.header.Names[n] == name
+}
+
+// getChartVersion returns the version of cvs, the versions of the named
+// chart, matching the version constraint
+func getChartVersion(name, version string, cvs helmRepo.ChartVersions) (*helmRepo.ChartVersion, error) {
+	i := helmRepo.IndexFile{Entries: map[string]helmRepo.ChartVersions{name: cvs}}
+	return i.Get(name, version)
+}
@@ -0,0 +1,146 @@
+/*
+Copyright SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package repo
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"helm.sh/helm/v3/pkg/chart"
+	helmRepo "helm.sh/helm/v3/pkg/repo"
+
+	"github.com/rancher-sandbox/hypper/internal/test/ensure"
+)
+
+func TestParsedIndexMatchesLoadIndexFile(t *testing.T) {
+	for _, src := range []string{testfile, annotationstestfile, chartmuseumtestfile, unorderedTestfile} {
+		t.Run(src, func(t *testing.T) {
+			is := assert.New(t)
+
+			dir := ensure.TempDir(t)
+			defer os.RemoveAll(dir)
+			path := filepath.Join(dir, "test-index.yaml")
+			is.NoError(copyIndexFile(src, path))
+
+			_, err := WriteParsedIndex(path)
+			is.NoError(err)
+			is.FileExists(filepath.Join(dir, "test-index.gob"))
+			parsed, err := OpenParsedIndex(path)
+			is.NoError(err)
+
+			full, err := LoadIndexFile(path)
+			is.NoError(err)
+			names := []string{}
+			for name := range full.Entries {
+				names = append(names, name)
+			}
+			is.ElementsMatch(names, parsed.Names())
+			for name, cvs := range full.Entries {
+				is.True(parsed.Has(name))
+				parsedCvs, err := parsed.ChartVersions(name)
+				is.NoError(err)
+				is.Len(parsedCvs, len(cvs))
+				for n, cv := range cvs {
+					is.Equal(cv.Metadata, parsedCvs[n].Metadata)
+					is.Equal(cv.URLs, parsedCvs[n].URLs)
+					is.Equal(cv.Digest, parsedCvs[n].Digest)
+					is.True(cv.Created.Equal(parsedCvs[n].Created))
+				}
+			}
+			is.False(parsed.Has("no-such-chart"))
+			_, err = parsed.Get("no-such-chart", "")
+			is.Equal(helmRepo.ErrNoChartName, err)
+		})
+	}
+}
+
+func TestOpenChartIndexRebuildsStaleParsedIndex(t *testing.T) {
+	is := assert.New(t)
+
+	dir := ensure.TempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "index.yaml")
+
+	index := NewIndexFile()
+	index.Add(&chart.Metadata{APIVersion: chart.APIVersionV2, Name: "mariadb", Version: "1.0.0"}, "mariadb-1.0.0.tgz", "", "")
+	is.NoError(index.WriteFile(path, 0644))
+
+	// without a parsed index, one is written
+	idx, err := OpenChartIndex(path)
+	is.NoError(err)
+	is.IsType(&ParsedIndex{}, idx)
+	cv, err := idx.Get("mariadb", "")
+	is.NoError(err)
+	is.Equal("1.0.0", cv.Version)
+
+	// once the index changes, the parsed index is out of date
+	index.Add(&chart.Metadata{APIVersion: chart.APIVersionV2, Name: "mariadb", Version: "1.1.0"}, "mariadb-1.1.0.tgz", "", "")
+	index.Add(&chart.Metadata{APIVersion: chart.APIVersionV2, Name: "nginx", Version: "0.1.0"}, "nginx-0.1.0.tgz", "", "")
+	is.NoError(index.WriteFile(path, 0644))
+	later := time.Now().Add(time.Minute)
+	is.NoError(os.Chtimes(path, later, later))
+	_, err = OpenParsedIndex(path)
+	is.Error(err)
+
+	idx, err = OpenChartIndex(path)
+	is.NoError(err)
+	is.Equal([]string{"mariadb", "nginx"}, idx.Names())
+	cv, err = idx.Get("mariadb", "")
+	is.NoError(err)
+	is.Equal("1.1.0", cv.Version)
+	_, err = OpenParsedIndex(path)
+	is.NoError(err)
+
+	// a corrupt parsed index is rebuilt too
+	is.NoError(ioutil.WriteFile(ParsedIndexPath(path), []byte("not a parsed index"), 0644))
+	_, err = OpenParsedIndex(path)
+	is.Error(err)
+	idx, err = OpenChartIndex(path)
+	is.NoError(err)
+	is.True(idx.Has("nginx"))
+}
+
+func TestOpenChartIndexFallsBackToLazyIndex(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("the parsed index can be written as root")
+	}
+	is := assert.New(t)
+
+	dir := ensure.TempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "index.yaml")
+	is.NoError(copyIndexFile(testfile, path))
+	is.NoError(os.Chmod(dir, 0555))
+	defer os.Chmod(dir, 0755)
+
+	idx, err := OpenChartIndex(path)
+	is.NoError(err)
+	is.IsType(&LazyIndex{}, idx)
+	is.True(idx.Has("nginx"))
+}
+
+func copyIndexFile(src, dst string) error {
+	b, err := ioutil.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(dst, b, 0644)
+}
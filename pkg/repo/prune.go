@@ -0,0 +1,108 @@
+/*
+Copyright SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package repo
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	helmRepo "helm.sh/helm/v3/pkg/repo"
+)
+
+// PruneOptions is the policy trimming the entries of an index
+type PruneOptions struct {
+	// KeepVersions is the number of versions kept for each chart, the most
+	// recent ones. All the versions are kept when lower than 1.
+	KeepVersions int
+
+	// DropPrereleaseOlderThan drops the prerelease versions created longer
+	// than this ago, as recorded in their entries, see
+	// IndexDirectoryWithOptions. Prereleases are kept when 0.
+	DropPrereleaseOlderThan time.Duration
+
+	// DropDeprecated drops the versions marked as deprecated
+	DropDeprecated bool
+
+	// Now is the time prerelease ages are computed from. When zero, the
+	// current time is used.
+	Now time.Time
+}
+
+// PrunedVersion is a chart version removed from an index, and why
+type PrunedVersion struct {
+	Name    string
+	Version string
+	Reason  string
+}
+
+// Prune removes the entries of the index not satisfying opts, and returns
+// them sorted by chart name and version. Charts left without versions are
+// removed from the index.
+//
+// The entries are left sorted, as with SortEntries.
+func (i *IndexFile) Prune(opts PruneOptions) []PrunedVersion {
+	now := opts.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	i.SortEntries()
+	pruned := []PrunedVersion{}
+	for name, cvs := range i.Entries {
+		kept := make(helmRepo.ChartVersions, 0, len(cvs))
+		for _, cv := range cvs {
+			reason := pruneReason(cv, opts, now)
+			if reason == "" && opts.KeepVersions > 0 && len(kept) >= opts.KeepVersions {
+				reason = fmt.Sprintf("more than %d newer versions", opts.KeepVersions)
+			}
+			if reason != "" {
+				pruned = append(pruned, PrunedVersion{Name: name, Version: cv.Version, Reason: reason})
+				continue
+			}
+			kept = append(kept, cv)
+		}
+		if len(kept) == 0 {
+			delete(i.Entries, name)
+			continue
+		}
+		i.Entries[name] = kept
+	}
+
+	sort.Slice(pruned, func(a, b int) bool {
+		if pruned[a].Name != pruned[b].Name {
+			return pruned[a].Name < pruned[b].Name
+		}
+		return lessVersion(pruned[a].Version, pruned[b].Version)
+	})
+	return pruned
+}
+
+// pruneReason returns why cv does not satisfy the drop options, or an empty
+// string if it does
+func pruneReason(cv *helmRepo.ChartVersion, opts PruneOptions, now time.Time) string {
+	if opts.DropDeprecated && cv.Deprecated {
+		return "deprecated"
+	}
+	if opts.DropPrereleaseOlderThan > 0 && !cv.Created.IsZero() && now.Sub(cv.Created) > opts.DropPrereleaseOlderThan {
+		if v, err := semver.NewVersion(cv.Version); err == nil && v.Prerelease() != "" {
+			return fmt.Sprintf("prerelease older than %s", opts.DropPrereleaseOlderThan)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,75 @@
+/*
+Copyright SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package repo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"helm.sh/helm/v3/pkg/chart"
+)
+
+func pruneTestIndex(now time.Time) *IndexFile {
+	index := NewIndexFile()
+	add := func(name, version string, age time.Duration, deprecated bool) {
+		md := &chart.Metadata{APIVersion: chart.APIVersionV2, Name: name, Version: version, Deprecated: deprecated}
+		index.Add(md, name+"-"+version+".tgz", "", "")
+		cvs := index.Entries[name]
+		cvs[len(cvs)-1].Created = now.Add(-age)
+	}
+	day := 24 * time.Hour
+	add("mariadb", "9.0.0", 100*day, false)
+	add("mariadb", "9.1.0", 50*day, false)
+	add("mariadb", "10.0.0-rc.1", 40*day, false)
+	add("mariadb", "10.0.0", 30*day, false)
+	add("mariadb", "10.1.0-beta.1", 2*day, false)
+	add("nginx", "1.0.0", 10*day, true)
+	return index
+}
+
+func TestPrune(t *testing.T) {
+	is := assert.New(t)
+	now := time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	index := pruneTestIndex(now)
+	pruned := index.Prune(PruneOptions{Now: now})
+	is.Empty(pruned)
+	is.Len(index.Entries["mariadb"], 5)
+
+	index = pruneTestIndex(now)
+	pruned = index.Prune(PruneOptions{
+		KeepVersions:            2,
+		DropPrereleaseOlderThan: 7 * 24 * time.Hour,
+		DropDeprecated:          true,
+		Now:                     now,
+	})
+	is.Equal([]PrunedVersion{
+		{Name: "mariadb", Version: "9.0.0", Reason: "more than 2 newer versions"},
+		{Name: "mariadb", Version: "9.1.0", Reason: "more than 2 newer versions"},
+		{Name: "mariadb", Version: "10.0.0-rc.1", Reason: "prerelease older than 168h0m0s"},
+		{Name: "nginx", Version: "1.0.0", Reason: "deprecated"},
+	}, pruned)
+
+	// recent prereleases count as kept versions
+	versions := []string{}
+	for _, cv := range index.Entries["mariadb"] {
+		versions = append(versions, cv.Version)
+	}
+	is.Equal([]string{"10.1.0-beta.1", "10.0.0"}, versions)
+	is.NotContains(index.Entries, "nginx")
+}
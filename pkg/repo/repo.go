@@ -18,26 +18,180 @@ package repo
 
 import (
 	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
 
 	"github.com/pkg/errors"
-	"gopkg.in/yaml.v2"
+	"github.com/rancher-sandbox/hypper/pkg/credentials"
 	helmRepo "helm.sh/helm/v3/pkg/repo"
+	"sigs.k8s.io/yaml"
 )
 
 // File represents the repositories.yaml file
 //
-// File is a composite type of helm/pkg/repo.File
+// File mirrors helm/pkg/repo.File, holding hypper's repository entries
 type File struct {
-	helmRepo.File
+	APIVersion   string    `json:"apiVersion"`
+	Generated    time.Time `json:"generated"`
+	Repositories []*Entry  `json:"repositories"`
+}
+
+// Entry represents a collection of parameters for chart repository
+//
+// Entry is a composite type of helm/pkg/repo.Entry, with the hypper specific settings
+type Entry struct {
+	helmRepo.Entry
+
+	// Verify requires the index of the repository to be signed by a key in Keyring
+	Verify bool `json:"verify,omitempty"`
+	// Keyring is the path to the public keyring used to verify the index signature
+	Keyring string `json:"keyring,omitempty"`
+	// Priority of the repository when resolving charts by name. Repositories
+	// with a higher priority are preferred.
+	Priority int `json:"priority,omitempty"`
+	// Enabled can disable a repository, so it is neither updated nor used to
+	// resolve charts. Repositories are enabled unless set to false.
+	Enabled *bool `json:"enabled,omitempty"`
+	// CredentialHelper is the name of the credential helper keeping the
+	// username and password of the repository, instead of this file
+	CredentialHelper string `json:"credentialHelper,omitempty"`
+	// Pinned are the names of the charts pinned to the repository. Charts
+	// pinned are only installed by name from the repositories they are
+	// pinned to, whatever their priority.
+	Pinned []string `json:"pinned,omitempty"`
+}
+
+// IsEnabled returns true unless the repository has been disabled
+func (e *Entry) IsEnabled() bool {
+	return e.Enabled == nil || *e.Enabled
+}
+
+// SetEnabled enables or disables the repository
+func (e *Entry) SetEnabled(enabled bool) {
+	if enabled {
+		// enabled is the default, keep it out of the repositories file
+		e.Enabled = nil
+		return
+	}
+	e.Enabled = &enabled
+}
+
+// Pins returns true if the chart called name is pinned to the repository
+func (e *Entry) Pins(name string) bool {
+	for _, p := range e.Pinned {
+		if p == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Pin pins the chart called name to the repository
+func (e *Entry) Pin(name string) {
+	if !e.Pins(name) {
+		e.Pinned = append(e.Pinned, name)
+		sort.Strings(e.Pinned)
+	}
+}
+
+// Unpin unpins the chart called name from the repository
+func (e *Entry) Unpin(name string) {
+	pinned := e.Pinned[:0]
+	for _, p := range e.Pinned {
+		if p != name {
+			pinned = append(pinned, p)
+		}
+	}
+	if len(pinned) == 0 {
+		pinned = nil
+	}
+	e.Pinned = pinned
+}
+
+// Equal returns true if both entries have the same configuration
+func (e *Entry) Equal(o *Entry) bool {
+	if len(e.Pinned) != len(o.Pinned) {
+		return false
+	}
+	for _, p := range e.Pinned {
+		if !o.Pins(p) {
+			return false
+		}
+	}
+	return e.Entry == o.Entry &&
+		e.Verify == o.Verify &&
+		e.Keyring == o.Keyring &&
+		e.Priority == o.Priority &&
+		e.IsEnabled() == o.IsEnabled() &&
+		e.CredentialHelper == o.CredentialHelper
+}
+
+// Credentials returns the username and password of the repository, from its
+// credential helper if it has one
+func (e *Entry) Credentials() (string, string, error) {
+	if e.CredentialHelper == "" {
+		return e.Username, e.Password, nil
+	}
+	h, err := credentials.NewHelper(e.CredentialHelper)
+	if err != nil {
+		return "", "", err
+	}
+	username, password, err := h.Get(e.credentialsKey())
+	if err != nil {
+		return "", "", errors.Wrapf(err, "cannot get the credentials of %q from credential helper %q", e.Name, e.CredentialHelper)
+	}
+	return username, password, nil
+}
+
+// StoreCredentials moves the username and password of the repository to the
+// credential helper called helper
+func (e *Entry) StoreCredentials(helper string) error {
+	h, err := credentials.NewHelper(helper)
+	if err != nil {
+		return err
+	}
+	if err := h.Add(&credentials.Credentials{ServerURL: e.credentialsKey(), Username: e.Username, Secret: e.Password}); err != nil {
+		return errors.Wrapf(err, "cannot store the credentials of %q in credential helper %q", e.Name, helper)
+	}
+	e.CredentialHelper = helper
+	e.Username = ""
+	e.Password = ""
+	return nil
+}
+
+// EraseCredentials removes the credentials of the repository from its
+// credential helper
+func (e *Entry) EraseCredentials() error {
+	if e.CredentialHelper == "" {
+		return nil
+	}
+	h, err := credentials.NewHelper(e.CredentialHelper)
+	if err != nil {
+		return err
+	}
+	if err := h.Delete(e.credentialsKey()); err != nil && err != credentials.ErrCredentialsNotFound {
+		return err
+	}
+	return nil
+}
+
+// credentialsKey is the key the credentials of the repository are kept by in
+// its credential helper. It includes the name, so that repositories of the
+// same URL, e.g: with different users, do not overwrite each other.
+func (e *Entry) credentialsKey() string {
+	return e.URL + "#" + e.Name
 }
 
 // NewFile generates an empty repositories file.
 //
 // Generated and APIVersion are automatically set.
 func NewFile() *File {
-	helmFile := helmRepo.NewFile()
 	return &File{
-		*helmFile,
+		APIVersion:   APIVersionV1,
+		Generated:    time.Now(),
+		Repositories: []*Entry{},
 	}
 }
 
@@ -49,6 +203,72 @@ func LoadFile(path string) (*File, error) {
 		return r, errors.Wrapf(err, "couldn't load repositories file (%s)", path)
 	}
 
-	err = yaml.Unmarshal(b, &r.File)
+	err = yaml.Unmarshal(b, r)
 	return r, err
 }
+
+// Add adds one or more repo entries to a repo file.
+func (r *File) Add(re ...*Entry) {
+	r.Repositories = append(r.Repositories, re...)
+}
+
+// Update attempts to replace one or more repo entries in a repo file. If an
+// entry with the same name doesn't exist in the repo file it will add it.
+func (r *File) Update(re ...*Entry) {
+	for _, target := range re {
+		r.update(target)
+	}
+}
+
+func (r *File) update(e *Entry) {
+	for j, repo := range r.Repositories {
+		if repo.Name == e.Name {
+			r.Repositories[j] = e
+			return
+		}
+	}
+	r.Add(e)
+}
+
+// Has returns true if the given name is already a repository name.
+func (r *File) Has(name string) bool {
+	entry := r.Get(name)
+	return entry != nil
+}
+
+// Get returns an entry with the given name if it exists, otherwise returns nil
+func (r *File) Get(name string) *Entry {
+	for _, entry := range r.Repositories {
+		if entry.Name == name {
+			return entry
+		}
+	}
+	return nil
+}
+
+// Remove removes the entry from the list of repositories.
+func (r *File) Remove(name string) bool {
+	cp := []*Entry{}
+	found := false
+	for _, rf := range r.Repositories {
+		if rf.Name == name {
+			found = true
+			continue
+		}
+		cp = append(cp, rf)
+	}
+	r.Repositories = cp
+	return found
+}
+
+// WriteFile writes a repositories file to the given path.
+func (r *File) WriteFile(path string, perm os.FileMode) error {
+	data, err := yaml.Marshal(r)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, perm)
+}
@@ -17,10 +17,18 @@ limitations under the License.
 package repo
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
 	helmRepo "helm.sh/helm/v3/pkg/repo"
+
+	"github.com/rancher-sandbox/hypper/internal/test/ensure"
+	"github.com/rancher-sandbox/hypper/pkg/credentials"
 )
 
 const testRepositoriesFile = "testdata/repositories.yaml"
@@ -28,14 +36,14 @@ const testRepositoriesFile = "testdata/repositories.yaml"
 func TestFile(t *testing.T) {
 	rf := NewFile()
 	rf.Add(
-		&helmRepo.Entry{
+		&Entry{Entry: helmRepo.Entry{
 			Name: "stable",
 			URL:  "https://example.com/stable/charts",
-		},
-		&helmRepo.Entry{
+		}},
+		&Entry{Entry: helmRepo.Entry{
 			Name: "incubator",
 			URL:  "https://example.com/incubator",
-		},
+		}},
 	)
 
 	if len(rf.Repositories) != 2 {
@@ -61,14 +69,14 @@ func TestFile(t *testing.T) {
 func TestNewFile(t *testing.T) {
 	expects := NewFile()
 	expects.Add(
-		&helmRepo.Entry{
+		&Entry{Entry: helmRepo.Entry{
 			Name: "stable",
 			URL:  "https://example.com/stable/charts",
-		},
-		&helmRepo.Entry{
+		}},
+		&Entry{Entry: helmRepo.Entry{
 			Name: "incubator",
 			URL:  "https://example.com/incubator",
-		},
+		}},
 	)
 
 	file, err := LoadFile(testRepositoriesFile)
@@ -98,3 +106,73 @@ func TestRepoNotExists(t *testing.T) {
 		t.Errorf("expected prompt `couldn't load repositories file`")
 	}
 }
+
+func TestEntryPriorityAndEnabled(t *testing.T) {
+	rf := NewFile()
+	rf.Add(
+		&Entry{Entry: helmRepo.Entry{Name: "stable", URL: "https://example.com/stable/charts"}},
+		&Entry{Entry: helmRepo.Entry{Name: "incubator", URL: "https://example.com/incubator"}, Priority: 5},
+	)
+	rf.Get("incubator").SetEnabled(false)
+
+	path := filepath.Join(ensure.TempDir(t), "repositories.yaml")
+	if err := rf.WriteFile(path, 0644); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(string(b), "enabled:") != 1 {
+		t.Errorf("expected only the disabled repository to be marked, got:\n%s", b)
+	}
+
+	f, err := LoadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stable := f.Get("stable"); stable.Priority != 0 || !stable.IsEnabled() {
+		t.Errorf("expected stable to be enabled with default priority, got %#v", stable)
+	}
+	incubator := f.Get("incubator")
+	if incubator.Priority != 5 || incubator.IsEnabled() {
+		t.Errorf("expected incubator to be disabled with priority 5, got %#v", incubator)
+	}
+	if !incubator.Equal(rf.Get("incubator")) || incubator.Equal(f.Get("stable")) {
+		t.Error("unexpected entries equality")
+	}
+}
+
+func TestEntryCredentials(t *testing.T) {
+	is := assert.New(t)
+
+	dir := ensure.TempDir(t)
+	defer os.RemoveAll(dir)
+	defer os.Unsetenv("HYPPER_CREDENTIALS_FILE")
+	os.Setenv("HYPPER_CREDENTIALS_FILE", filepath.Join(dir, "credentials.enc"))
+	defer os.Unsetenv("HYPPER_CREDENTIALS_PASSPHRASE")
+	os.Setenv("HYPPER_CREDENTIALS_PASSPHRASE", "passphrase")
+
+	// repositories of the same URL keep their own credentials
+	one := &Entry{Entry: helmRepo.Entry{Name: "one", URL: "https://charts.example.com", Username: "alice", Password: "a"}}
+	two := &Entry{Entry: helmRepo.Entry{Name: "two", URL: "https://charts.example.com", Username: "bob", Password: "b"}}
+	is.NoError(one.StoreCredentials(credentials.DefaultHelper))
+	is.NoError(two.StoreCredentials(credentials.DefaultHelper))
+	is.Empty(one.Username)
+	is.Empty(one.Password)
+
+	username, password, err := one.Credentials()
+	is.NoError(err)
+	is.Equal("alice", username)
+	is.Equal("a", password)
+	username, password, err = two.Credentials()
+	is.NoError(err)
+	is.Equal("bob", username)
+	is.Equal("b", password)
+
+	is.NoError(one.EraseCredentials())
+	_, _, err = one.Credentials()
+	is.Equal(credentials.ErrCredentialsNotFound, errors.Cause(err))
+	_, _, err = two.Credentials()
+	is.NoError(err)
+}
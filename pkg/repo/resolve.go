@@ -0,0 +1,102 @@
+/*
+Copyright SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package repo
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/pkg/errors"
+	"github.com/rancher-sandbox/hypper/pkg/hypperpath"
+	helmRepo "helm.sh/helm/v3/pkg/repo"
+)
+
+// ChartMatch is a version of a chart provided by a repository
+type ChartMatch struct {
+	// Repo is the name of the repository providing the chart
+	Repo string
+	// URL is the URL of the repository providing the chart
+	URL string
+	// Priority is the priority of the repository
+	Priority int
+	// Chart is the entry of the chart in the repository index
+	Chart *helmRepo.ChartVersion
+}
+
+// Ref returns the repo/chart reference of the match
+func (m *ChartMatch) Ref() string {
+	return m.Repo + "/" + m.Chart.Name
+}
+
+// FindChart looks for a chart by name in the cached indexes of all the
+// repositories of f, as charts of the same name are the same chart no matter
+// where they come from.
+//
+// It returns the newest version of each repository matching the version
+// constraint, best match first. Matches are sorted by repository priority,
+// highest first; then by version, newest first; and last by repository name.
+//
+// Charts pinned to some repositories are only looked for in them. Disabled
+// repositories and repositories without a cached index are skipped.
+func FindChart(f *File, repoCache, name, version string) ([]*ChartMatch, error) {
+	var pinned []string
+	for _, re := range f.Repositories {
+		if re.IsEnabled() && re.Pins(name) {
+			pinned = append(pinned, re.Name)
+		}
+	}
+
+	var matches []*ChartMatch
+	for _, re := range f.Repositories {
+		if !re.IsEnabled() || (len(pinned) > 0 && !re.Pins(name)) {
+			continue
+		}
+		idx, err := OpenChartIndex(filepath.Join(repoCache, hypperpath.CacheIndexFile(re.Name)))
+		if err != nil {
+			continue
+		}
+		cv, err := idx.Get(name, version)
+		if err != nil {
+			continue
+		}
+		matches = append(matches, &ChartMatch{Repo: re.Name, URL: re.URL, Priority: re.Priority, Chart: cv})
+	}
+	if len(matches) == 0 {
+		if len(pinned) > 0 {
+			return nil, errors.Errorf("chart %q is pinned to repositories %s, which do not provide it", name, strings.Join(pinned, ", "))
+		}
+		if version != "" {
+			return nil, errors.Errorf("chart %q version %q not found in any repository", name, version)
+		}
+		return nil, errors.Errorf("chart %q not found in any repository", name)
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].Priority != matches[j].Priority {
+			return matches[i].Priority > matches[j].Priority
+		}
+		vi, erri := semver.NewVersion(matches[i].Chart.Version)
+		vj, errj := semver.NewVersion(matches[j].Chart.Version)
+		if erri == nil && errj == nil && !vi.Equal(vj) {
+			return vi.GreaterThan(vj)
+		}
+		return matches[i].Repo < matches[j].Repo
+	})
+	return matches, nil
+}
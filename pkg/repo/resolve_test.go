@@ -0,0 +1,109 @@
+/*
+Copyright SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package repo
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	helmRepo "helm.sh/helm/v3/pkg/repo"
+
+	"github.com/rancher-sandbox/hypper/internal/test/ensure"
+	"github.com/rancher-sandbox/hypper/pkg/hypperpath"
+)
+
+// writeCachedIndex writes the cached index of repository name, with the
+// given versions of the mariadb chart.
+func writeCachedIndex(t *testing.T, cache, name string, versions ...string) {
+	t.Helper()
+	var b strings.Builder
+	b.WriteString("apiVersion: v1\nentries:\n  mariadb:\n")
+	for _, v := range versions {
+		fmt.Fprintf(&b, "    - name: mariadb\n      version: %s\n      apiVersion: v2\n      urls:\n        - https://%s.example.com/mariadb-%s.tgz\n", v, name, v)
+	}
+	if err := ioutil.WriteFile(filepath.Join(cache, hypperpath.CacheIndexFile(name)), []byte(b.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFindChart(t *testing.T) {
+	is := assert.New(t)
+	cache := ensure.TempDir(t)
+
+	f := NewFile()
+	for _, name := range []string{"zeta", "alpha", "beta", "uncached"} {
+		f.Add(&Entry{Entry: helmRepo.Entry{Name: name, URL: "https://" + name + ".example.com"}})
+	}
+	writeCachedIndex(t, cache, "zeta", "9.3.1", "9.2.0")
+	writeCachedIndex(t, cache, "alpha", "9.3.1")
+	writeCachedIndex(t, cache, "beta", "9.2.0", "10.0.0-rc.1")
+
+	// newest version first, ties broken by repository name
+	matches, err := FindChart(f, cache, "mariadb", "")
+	is.NoError(err)
+	is.Len(matches, 3)
+	is.Equal("alpha/mariadb", matches[0].Ref())
+	is.Equal("9.3.1", matches[0].Chart.Version)
+	is.Equal("zeta", matches[1].Repo)
+	is.Equal("beta", matches[2].Repo)
+	is.Equal("9.2.0", matches[2].Chart.Version)
+
+	// version constraints are applied per repository
+	matches, err = FindChart(f, cache, "mariadb", "~9.2.0")
+	is.NoError(err)
+	is.Len(matches, 2)
+	is.Equal("beta", matches[0].Repo)
+	is.Equal("zeta", matches[1].Repo)
+
+	matches, err = FindChart(f, cache, "mariadb", ">0.0.0-0")
+	is.NoError(err)
+	is.Equal("beta", matches[0].Repo)
+	is.Equal("10.0.0-rc.1", matches[0].Chart.Version)
+
+	// higher priorities win over newer versions, disabled repositories are skipped
+	f.Get("beta").Priority = 10
+	f.Get("alpha").SetEnabled(false)
+	matches, err = FindChart(f, cache, "mariadb", "")
+	is.NoError(err)
+	is.Len(matches, 2)
+	is.Equal("beta", matches[0].Repo)
+	is.Equal("9.2.0", matches[0].Chart.Version)
+	is.Equal("zeta", matches[1].Repo)
+
+	// pinned charts are only looked for in the repositories they are pinned to
+	f.Get("zeta").Pin("mariadb")
+	matches, err = FindChart(f, cache, "mariadb", "")
+	is.NoError(err)
+	is.Len(matches, 1)
+	is.Equal("zeta", matches[0].Repo)
+	is.Equal("9.3.1", matches[0].Chart.Version)
+
+	_, err = FindChart(f, cache, "mariadb", "~10.0.0-0")
+	is.EqualError(err, `chart "mariadb" is pinned to repositories zeta, which do not provide it`)
+	f.Get("zeta").Unpin("mariadb")
+	is.Nil(f.Get("zeta").Pinned)
+
+	_, err = FindChart(f, cache, "postgresql", "")
+	is.EqualError(err, `chart "postgresql" not found in any repository`)
+
+	_, err = FindChart(f, cache, "mariadb", "11.0.0")
+	is.EqualError(err, `chart "mariadb" version "11.0.0" not found in any repository`)
+}
@@ -0,0 +1,80 @@
+/*
+Copyright SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package repo
+
+import (
+	"bytes"
+	"os"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/openpgp"
+	"helm.sh/helm/v3/pkg/provenance"
+)
+
+// IndexSignatureExt is the extension appended to an index file name for its
+// detached signature, e.g: index.yaml.asc
+const IndexSignatureExt = ".asc"
+
+var (
+	// ErrNoIndexSignature indicates that a repository index is not signed.
+	ErrNoIndexSignature = errors.New("index signature not found")
+
+	// ErrInvalidIndexSignature indicates that the signature of a repository index does not verify.
+	ErrInvalidIndexSignature = errors.New("invalid index signature")
+)
+
+// SignIndexFile writes a detached, armored signature of the index file at
+// path into path + IndexSignatureExt.
+//
+// The Signatory must have a decrypted private key.
+func SignIndexFile(path string, signer *provenance.Signatory) error {
+	if signer.Entity == nil || signer.Entity.PrivateKey == nil {
+		return errors.New("private key not found")
+	}
+	index, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer index.Close()
+
+	sig, err := os.Create(path + IndexSignatureExt)
+	if err != nil {
+		return err
+	}
+	if err := openpgp.ArmoredDetachSign(sig, signer.Entity, index, nil); err != nil {
+		sig.Close()
+		return errors.Wrap(err, "failed signing index")
+	}
+	return sig.Close()
+}
+
+// VerifyIndex checks that signature is a valid detached signature of index,
+// made by one of the keys in the keyring file. It returns the signing key.
+func VerifyIndex(index, signature []byte, keyring string) (*openpgp.Entity, error) {
+	if len(signature) == 0 {
+		return nil, ErrNoIndexSignature
+	}
+	s, err := provenance.NewFromKeyring(keyring, "")
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed loading keyring %s", keyring)
+	}
+	signer, err := openpgp.CheckArmoredDetachedSignature(s.KeyRing, bytes.NewReader(index), bytes.NewReader(signature))
+	if err != nil {
+		return nil, errors.Wrap(ErrInvalidIndexSignature, err.Error())
+	}
+	return signer, nil
+}
@@ -0,0 +1,157 @@
+/*
+Copyright SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package repo
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/openpgp"
+	helmCli "helm.sh/helm/v3/pkg/cli"
+	"helm.sh/helm/v3/pkg/getter"
+	"helm.sh/helm/v3/pkg/provenance"
+	helmRepo "helm.sh/helm/v3/pkg/repo"
+
+	"github.com/rancher-sandbox/hypper/internal/test/ensure"
+)
+
+// writeTestKeyrings creates a new key and writes its secret and public
+// keyrings into dir, returning their paths.
+func writeTestKeyrings(t *testing.T, dir, name string) (string, string) {
+	t.Helper()
+	e, err := openpgp.NewEntity(name, "", name+"@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := filepath.Join(dir, name+".secret")
+	public := filepath.Join(dir, name+".pub")
+	for path, serialize := range map[string]func(*os.File) error{
+		secret: func(f *os.File) error { return e.SerializePrivate(f, nil) },
+		public: func(f *os.File) error { return e.Serialize(f) },
+	} {
+		f, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := serialize(f); err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+	}
+	return secret, public
+}
+
+func signTestIndex(t *testing.T, path, secret string) {
+	t.Helper()
+	signer, err := provenance.NewFromKeyring(secret, "signer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := SignIndexFile(path, signer); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSignAndVerifyIndex(t *testing.T) {
+	dir := ensure.TempDir(t)
+	secret, public := writeTestKeyrings(t, dir, "signer")
+	_, otherPublic := writeTestKeyrings(t, dir, "other")
+
+	index := filepath.Join(dir, "index.yaml")
+	data, err := ioutil.ReadFile(testfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(index, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	signTestIndex(t, index, secret)
+
+	sig, err := ioutil.ReadFile(index + IndexSignatureExt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signer, err := VerifyIndex(data, sig, public)
+	assert.NoError(t, err)
+	assert.Contains(t, signer.Identities, "signer <signer@example.com>")
+
+	_, err = VerifyIndex(data, sig, otherPublic)
+	assert.True(t, errors.Is(err, ErrInvalidIndexSignature))
+
+	_, err = VerifyIndex(append(data, []byte("\n# tampered\n")...), sig, public)
+	assert.True(t, errors.Is(err, ErrInvalidIndexSignature))
+
+	_, err = VerifyIndex(data, nil, public)
+	assert.True(t, errors.Is(err, ErrNoIndexSignature))
+}
+
+func TestDownloadIndexFileVerify(t *testing.T) {
+	srvDir := ensure.TempDir(t)
+	secret, public := writeTestKeyrings(t, ensure.TempDir(t), "signer")
+	srv := httptest.NewServer(http.FileServer(http.Dir(srvDir)))
+	defer srv.Close()
+
+	data, err := ioutil.ReadFile(testfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	index := filepath.Join(srvDir, "index.yaml")
+	if err := ioutil.WriteFile(index, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cache := ensure.TempDir(t)
+	r, err := NewChartRepositoryFromEntry(&Entry{
+		Entry:   helmRepo.Entry{Name: "signed", URL: srv.URL},
+		Verify:  true,
+		Keyring: public,
+	}, getter.All(helmCli.New()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.CachePath = cache
+	cached := filepath.Join(cache, "signed-index.yaml")
+
+	// no signature
+	_, err = r.DownloadIndexFile()
+	assert.True(t, errors.Is(err, ErrNoIndexSignature))
+	assert.NoFileExists(t, cached)
+
+	// valid signature
+	signTestIndex(t, index, secret)
+	fname, err := r.DownloadIndexFile()
+	assert.NoError(t, err)
+	assert.Equal(t, cached, fname)
+	assert.FileExists(t, filepath.Join(cache, "signed-charts.txt"))
+
+	// index changed after signing, the cached index is kept
+	if err := ioutil.WriteFile(index, append(data, []byte("\n# tampered\n")...), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err = r.DownloadIndexFile()
+	assert.True(t, errors.Is(err, ErrInvalidIndexSignature))
+	b, err := ioutil.ReadFile(cached)
+	assert.NoError(t, err)
+	assert.Equal(t, data, b)
+}
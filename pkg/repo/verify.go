@@ -0,0 +1,257 @@
+/*
+Copyright SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package repo
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/getter"
+	"helm.sh/helm/v3/pkg/provenance"
+	helmRepo "helm.sh/helm/v3/pkg/repo"
+
+	"github.com/rancher-sandbox/hypper/pkg/chartcache"
+)
+
+// ProblemKind is the kind of problem found verifying a repository
+type ProblemKind string
+
+const (
+	// ProblemInvalidEntry is an index entry failing validation, that would
+	// be skipped when loading the index
+	ProblemInvalidEntry ProblemKind = "invalid-entry"
+	// ProblemNoURL is an index entry without URLs
+	ProblemNoURL ProblemKind = "no-url"
+	// ProblemUnresolvable is an entry URL that could not be fetched
+	ProblemUnresolvable ProblemKind = "unresolvable-url"
+	// ProblemNoDigest is an index entry without digest
+	ProblemNoDigest ProblemKind = "missing-digest"
+	// ProblemDigestMismatch is an archive not matching the digest of its entry
+	ProblemDigestMismatch ProblemKind = "digest-mismatch"
+	// ProblemInvalidArchive is an entry URL that is not a chart archive
+	ProblemInvalidArchive ProblemKind = "invalid-archive"
+	// ProblemMetadataMismatch is an archive whose chart name or version does
+	// not match its entry
+	ProblemMetadataMismatch ProblemKind = "metadata-mismatch"
+	// ProblemNotIndexed is an archive of a local repository missing from
+	// its index
+	ProblemNotIndexed ProblemKind = "not-indexed"
+)
+
+// VerifyProblem is a problem found verifying a repository
+type VerifyProblem struct {
+	Chart   string      `json:"chart,omitempty"`
+	Version string      `json:"version,omitempty"`
+	URL     string      `json:"url,omitempty"`
+	Kind    ProblemKind `json:"problem"`
+	Detail  string      `json:"detail"`
+}
+
+// VerifyReport describes how a repository matches its index
+type VerifyReport struct {
+	// Verified are the URLs of the archives matching their entry
+	Verified []string
+	// Problems are the problems found, sorted by chart name and version
+	Problems []*VerifyProblem
+}
+
+// ReadIndex returns the raw index of the repository.
+//
+// ref is the path or URL of the index. When empty, the index.yaml at the root
+// of the repository is read. Unlike fetching the index of a local repository,
+// a missing index.yaml is an error instead of being generated.
+func (r *ChartRepository) ReadIndex(ref string) ([]byte, error) {
+	if ref == "" {
+		if IsLocalURL(r.Config.URL) {
+			return ioutil.ReadFile(filepath.Join(LocalPath(r.Config.URL), "index.yaml"))
+		}
+		u, err := helmRepo.ResolveReferenceURL(r.Config.URL, "index.yaml")
+		if err != nil {
+			return nil, err
+		}
+		return r.get(u)
+	}
+	if !strings.Contains(ref, "://") {
+		return ioutil.ReadFile(ref)
+	}
+	return r.fetch(ref)
+}
+
+// VerifyArchives checks index, the raw index of the repository, against the
+// archives the repository serves.
+//
+// The URLs of every entry have to resolve to a chart archive with the digest,
+// name and version of the entry. The entries that loading the index would
+// skip are reported too, and so are, for local repositories, the archives
+// missing from the index.
+func (r *ChartRepository) VerifyArchives(index []byte) (*VerifyReport, error) {
+	i, invalid, err := parseIndex(index)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed loading the index")
+	}
+
+	report := &VerifyReport{}
+	for _, e := range invalid {
+		report.Problems = append(report.Problems, &VerifyProblem{
+			Chart:   e.Name,
+			Version: e.Version,
+			Kind:    ProblemInvalidEntry,
+			Detail:  e.Err.Error(),
+		})
+	}
+
+	indexed := map[string]bool{}
+	for name, cvs := range i.Entries {
+		for _, cv := range cvs {
+			if len(cv.URLs) == 0 {
+				report.Problems = append(report.Problems, &VerifyProblem{
+					Chart:   name,
+					Version: cv.Version,
+					Kind:    ProblemNoURL,
+					Detail:  "the entry has no URLs",
+				})
+				continue
+			}
+			for _, ref := range cv.URLs {
+				u, err := helmRepo.ResolveReferenceURL(r.Config.URL, ref)
+				if err != nil {
+					u = ref
+				}
+				if IsLocalURL(u) {
+					indexed[filepath.Clean(LocalPath(u))] = true
+				}
+				if problem := r.verifyArchive(name, cv, u); problem != nil {
+					report.Problems = append(report.Problems, problem)
+				} else {
+					report.Verified = append(report.Verified, u)
+				}
+			}
+		}
+	}
+
+	if IsLocalURL(r.Config.URL) {
+		archives, err := findArchives(LocalPath(r.Config.URL), nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range archives {
+			if !indexed[filepath.Clean(a)] {
+				report.Problems = append(report.Problems, &VerifyProblem{
+					URL:    (&url.URL{Scheme: FileScheme, Path: filepath.ToSlash(a)}).String(),
+					Kind:   ProblemNotIndexed,
+					Detail: "the archive is not in the index",
+				})
+			}
+		}
+	}
+
+	sort.SliceStable(report.Problems, func(a, b int) bool {
+		pa, pb := report.Problems[a], report.Problems[b]
+		if pa.Chart != pb.Chart {
+			return pa.Chart < pb.Chart
+		}
+		if pa.Version != pb.Version {
+			return lessVersion(pa.Version, pb.Version)
+		}
+		return pa.URL < pb.URL
+	})
+	sort.Strings(report.Verified)
+	return report, nil
+}
+
+// verifyArchive checks the archive at u against its entry cv, listed under
+// name in the index
+func (r *ChartRepository) verifyArchive(name string, cv *helmRepo.ChartVersion, u string) *VerifyProblem {
+	problem := func(kind ProblemKind, format string, a ...interface{}) *VerifyProblem {
+		return &VerifyProblem{
+			Chart:   name,
+			Version: cv.Version,
+			URL:     u,
+			Kind:    kind,
+			Detail:  fmt.Sprintf(format, a...),
+		}
+	}
+
+	data, err := r.fetch(u)
+	if err != nil {
+		return problem(ProblemUnresolvable, "%s", err)
+	}
+
+	if cv.Digest == "" {
+		return problem(ProblemNoDigest, "the entry has no digest")
+	}
+	digest, err := provenance.Digest(bytes.NewReader(data))
+	if err != nil {
+		return problem(ProblemUnresolvable, "%s", err)
+	}
+	if digest != chartcache.NormalizeDigest(cv.Digest) {
+		return problem(ProblemDigestMismatch, "expected %s, got %s", chartcache.NormalizeDigest(cv.Digest), digest)
+	}
+
+	ch, err := loader.LoadArchive(bytes.NewReader(data))
+	if err != nil {
+		return problem(ProblemInvalidArchive, "%s", err)
+	}
+	if ch.Name() != name || ch.Name() != cv.Name {
+		return problem(ProblemMetadataMismatch, "the archive contains chart %q", ch.Name())
+	}
+	if ch.Metadata.Version != cv.Version {
+		return problem(ProblemMetadataMismatch, "the archive contains version %q", ch.Metadata.Version)
+	}
+	return nil
+}
+
+// fetch gets u with the client of the repository, or the one for the scheme
+// of u when an entry points outside of the repository
+func (r *ChartRepository) fetch(u string) ([]byte, error) {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return nil, err
+	}
+	base, err := url.Parse(r.Config.URL)
+	if err != nil {
+		return nil, err
+	}
+	if parsed.Scheme == base.Scheme {
+		return r.get(u)
+	}
+
+	var client getter.Getter
+	switch parsed.Scheme {
+	case FileScheme:
+		client = &fileGetter{}
+	case "http", "https":
+		client, err = getter.NewHTTPGetter()
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.Errorf("could not find protocol handler for: %s", parsed.Scheme)
+	}
+	resp, err := client.Get(u)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(resp)
+}
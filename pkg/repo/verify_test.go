@@ -0,0 +1,141 @@
+/*
+Copyright SUSE.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package repo
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"helm.sh/helm/v3/pkg/chart"
+	helmCli "helm.sh/helm/v3/pkg/cli"
+	"helm.sh/helm/v3/pkg/getter"
+	"helm.sh/helm/v3/pkg/provenance"
+	helmRepo "helm.sh/helm/v3/pkg/repo"
+	"sigs.k8s.io/yaml"
+
+	"github.com/rancher-sandbox/hypper/internal/test/ensure"
+)
+
+// brokenIndex indexes the charts of dir, with a few broken entries
+func brokenIndex(t *testing.T, dir string) []byte {
+	t.Helper()
+	saveChart(t, dir, "clipper", "0.1.0")
+	saveChart(t, dir, "cutter", "0.1.0")
+	saveChart(t, dir, "cutter", "0.2.0")
+
+	index := NewIndexFile()
+	add := func(name, version, fname string) {
+		digest, err := provenance.DigestFile(filepath.Join(dir, fname))
+		if err != nil {
+			t.Fatal(err)
+		}
+		index.Add(&chart.Metadata{APIVersion: chart.APIVersionV2, Name: name, Version: version}, fname, "", digest)
+	}
+	add("clipper", "0.1.0", "clipper-0.1.0.tgz")
+	// the archive of another version
+	add("cutter", "0.1.0", "cutter-0.2.0.tgz")
+	// the archive of another chart
+	add("trimmer", "0.1.0", "clipper-0.1.0.tgz")
+	index.Add(&chart.Metadata{APIVersion: chart.APIVersionV2, Name: "cutter", Version: "0.3.0"}, "cutter-0.3.0.tgz", "", "sha256:1234")
+	index.Add(&chart.Metadata{APIVersion: chart.APIVersionV2, Name: "clipper", Version: "0.2.0"}, "cutter-0.1.0.tgz", "", "sha256:1234")
+	index.Entries["shears"] = helmRepo.ChartVersions{{
+		Metadata: &chart.Metadata{APIVersion: chart.APIVersionV2, Name: "shears", Version: "not-semver"},
+		URLs:     []string{"shears-not-semver.tgz"},
+	}}
+
+	b, err := yaml.Marshal(index.IndexFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestVerifyArchives(t *testing.T) {
+	is := assert.New(t)
+
+	dir := ensure.TempDir(t)
+	index := brokenIndex(t, dir)
+	u, err := LocalURL(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewChartRepository(&helmRepo.Entry{Name: "local", URL: u}, getter.All(helmCli.New()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := r.VerifyArchives(index)
+	is.NoError(err)
+	is.Equal([]string{u + "/clipper-0.1.0.tgz"}, report.Verified)
+
+	kinds := []ProblemKind{}
+	for _, p := range report.Problems {
+		kinds = append(kinds, p.Kind)
+	}
+	is.Equal([]ProblemKind{
+		ProblemDigestMismatch,   // clipper 0.2.0
+		ProblemMetadataMismatch, // cutter 0.1.0
+		ProblemUnresolvable,     // cutter 0.3.0
+		ProblemInvalidEntry,     // shears
+		ProblemMetadataMismatch, // trimmer 0.1.0
+	}, kinds)
+	is.Equal(`the archive contains version "0.2.0"`, report.Problems[1].Detail)
+	is.Equal(`the archive contains chart "clipper"`, report.Problems[4].Detail)
+	is.Equal("shears", report.Problems[3].Chart)
+
+	// without the entries of clipper and trimmer, the archives of clipper
+	// 0.1.0 and cutter 0.1.0 are not referenced by the index anymore
+	var loaded helmRepo.IndexFile
+	is.NoError(yaml.Unmarshal(index, &loaded))
+	delete(loaded.Entries, "clipper")
+	delete(loaded.Entries, "trimmer")
+	b, err := yaml.Marshal(loaded)
+	is.NoError(err)
+	report, err = r.VerifyArchives(b)
+	is.NoError(err)
+	is.Equal(ProblemNotIndexed, report.Problems[0].Kind)
+	is.Equal(u+"/clipper-0.1.0.tgz", report.Problems[0].URL)
+	is.Equal(ProblemNotIndexed, report.Problems[1].Kind)
+	is.Equal(u+"/cutter-0.1.0.tgz", report.Problems[1].URL)
+}
+
+func TestVerifyArchivesRemote(t *testing.T) {
+	is := assert.New(t)
+
+	dir := ensure.TempDir(t)
+	index := brokenIndex(t, dir)
+	srv := httptest.NewServer(http.FileServer(http.Dir(dir)))
+	defer srv.Close()
+
+	r, err := NewChartRepository(&helmRepo.Entry{Name: "remote", URL: srv.URL}, getter.All(helmCli.New()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := r.VerifyArchives(index)
+	is.NoError(err)
+	is.Equal([]string{srv.URL + "/clipper-0.1.0.tgz"}, report.Verified)
+	// archives missing from the index can only be found in directories
+	is.Len(report.Problems, 5)
+
+	_, err = r.ReadIndex("")
+	is.Error(err)
+	_, err = r.VerifyArchives([]byte("entries: {}"))
+	is.EqualError(err, "failed loading the index: no API version specified")
+}